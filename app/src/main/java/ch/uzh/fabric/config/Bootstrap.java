@@ -45,20 +45,21 @@ public class Bootstrap implements ApplicationRunner {
                                 null,
                                 null,
                                 null,
+                                null,
                                 "white",
                                 "C350",
                                 "Mercedes"), 0, TEST_VIN),
                 new ProposalData(
-                        "4+1",
+                        5,
                         4,
                         2,
                         200));
-        dotService.register(BOOTSTRAP_GARAGE_USER, BOOTSTRAP_DOT_ROLE, TEST_VIN);
+        dotService.register(BOOTSTRAP_DOT_USER, BOOTSTRAP_DOT_ROLE, TEST_VIN, true);
         carService.insureProposal(BOOTSTRAP_GARAGE_USER, BOOTSTRAP_GARAGE_ROLE, TEST_VIN, TEST_INSURANCE_COMPANY);
         insuranceService.acceptInsurance(BOOTSTRAP_INSURANCE_USER, BOOTSTRAP_INSURANCE_ROLE, BOOTSTRAP_GARAGE_USER, TEST_VIN, TEST_INSURANCE_COMPANY);
         dotService.confirm(BOOTSTRAP_DOT_USER, BOOTSTRAP_DOT_ROLE, TEST_VIN, "ZH 99837");
         carService.createSellingOffer(BOOTSTRAP_GARAGE_USER, BOOTSTRAP_GARAGE_ROLE, "5", TEST_VIN, BOOTSTRAP_PRIVATE_USER);
-        dotService.revoke(BOOTSTRAP_GARAGE_USER, BOOTSTRAP_DOT_ROLE, TEST_VIN);
+        dotService.revoke(BOOTSTRAP_DOT_USER, BOOTSTRAP_DOT_ROLE, TEST_VIN);
 
         // create an unregistered car
         // with insurance proposal
@@ -70,11 +71,12 @@ public class Bootstrap implements ApplicationRunner {
                                 null,
                                 null,
                                 null,
+                                null,
                                 "blue",
                                 "A8",
                                 "Audi"), 0, TEST_VIN2),
                 new ProposalData(
-                        "5",
+                        5,
                         8,
                         2,
                         200));
@@ -90,15 +92,16 @@ public class Bootstrap implements ApplicationRunner {
                                 null,
                                 null,
                                 null,
+                                null,
                                 "red",
                                 "Golf TDI",
                                 "VW"), 0, TEST_VIN3),
                 new ProposalData(
-                        "5",
+                        5,
                         4,
                         2,
                         150));
-        dotService.register(BOOTSTRAP_GARAGE_USER, BOOTSTRAP_DOT_ROLE, TEST_VIN3);
+        dotService.register(BOOTSTRAP_DOT_USER, BOOTSTRAP_DOT_ROLE, TEST_VIN3, true);
 
         // create a registered and insured batmobile
         // ready to be confirmed
@@ -110,15 +113,16 @@ public class Bootstrap implements ApplicationRunner {
                                 null,
                                 null,
                                 null,
+                                null,
                                 "black",
                                 "Batmobile",
                                 "Wayne Enterprises"), 0, TEST_VIN4),
                 new ProposalData(
-                        "5",
+                        5,
                         8,
                         2,
                         250));
-        dotService.register(BOOTSTRAP_PRIVATE_USER, BOOTSTRAP_DOT_ROLE, TEST_VIN4);
+        dotService.register(BOOTSTRAP_DOT_USER, BOOTSTRAP_DOT_ROLE, TEST_VIN4, true);
         carService.insureProposal(BOOTSTRAP_PRIVATE_USER, BOOTSTRAP_PRIVATE_USER_ROLE, TEST_VIN4, TEST_INSURANCE_COMPANY);
         insuranceService.acceptInsurance(BOOTSTRAP_INSURANCE_USER, BOOTSTRAP_INSURANCE_ROLE, BOOTSTRAP_PRIVATE_USER, TEST_VIN4, TEST_INSURANCE_COMPANY);
 
@@ -64,11 +64,12 @@ public class DotController {
     public String registrationAccept(RedirectAttributes redirAttr,
                                      Authentication auth,
                                      @RequestParam String vin,
-                                     @RequestParam String owner) {
+                                     @RequestParam(defaultValue = "false") boolean individual) {
+        String username = auth.getName();
         String role = userService.getRole(auth);
 
         try {
-            dotService.register(owner, role, vin);
+            dotService.register(username, role, vin, individual);
         } catch (Exception e) {
             redirAttr.addAttribute("error", e.getMessage());
             return "redirect:/dot/";
@@ -152,17 +153,18 @@ public class DotController {
     }
 
     @RequestMapping(value = "/revocation", method = RequestMethod.POST)
-    public String revocationAccept(RedirectAttributes redirAttr, Authentication auth, @RequestParam String vin, @RequestParam String owner) {
+    public String revocationAccept(RedirectAttributes redirAttr, Authentication auth, @RequestParam String vin, @RequestParam String keeper) {
+        String username = auth.getName();
         String role = userService.getRole(auth);
 
         try {
-            dotService.revoke(owner, role, vin);
+            dotService.revoke(username, role, vin);
         } catch (Exception e) {
             redirAttr.addAttribute("error", e.getMessage());
             return "redirect:/dot/revocation";
         }
 
-        redirAttr.addAttribute("success", "Successfully revoked car with VIN '" + vin + "' of user '" + owner + "'");
+        redirAttr.addAttribute("success", "Successfully revoked car with VIN '" + vin + "' of keeper '" + keeper + "'");
         return "redirect:/dot/revocation";
     }
 
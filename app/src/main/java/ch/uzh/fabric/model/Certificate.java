@@ -1,7 +1,8 @@
 package ch.uzh.fabric.model;
 
 public class Certificate {
-    private String username;
+    private String owner;
+    private String keeper;
     private String insurer;
     private String numberplate;
     private String vin;
@@ -13,9 +14,10 @@ public class Certificate {
 
     }
 
-    public Certificate(String username, String insurer, String numberplate, String vin, String color, String type, String brand) {
+    public Certificate(String owner, String keeper, String insurer, String numberplate, String vin, String color, String type, String brand) {
         this();
-        this.username = username;
+        this.owner = owner;
+        this.keeper = keeper;
         this.insurer = insurer;
         this.numberplate = numberplate;
         this.vin = vin;
@@ -24,12 +26,20 @@ public class Certificate {
         this.brand = brand;
     }
 
-    public String getUsername() {
-        return username;
+    public String getOwner() {
+        return owner;
     }
 
-    public void setUsername(String username) {
-        this.username = username;
+    public void setOwner(String owner) {
+        this.owner = owner;
+    }
+
+    public String getKeeper() {
+        return keeper;
+    }
+
+    public void setKeeper(String keeper) {
+        this.keeper = keeper;
     }
 
     public String getInsurer() {
@@ -3,7 +3,7 @@ package ch.uzh.fabric.model;
 public class ProposalData {
     private String car;
     private String username;
-    private String numberOfDoors;
+    private Integer numberOfDoors;
     private Integer numberOfCylinders;
     private Integer numberOfAxis;
     private Integer maxSpeed;
@@ -11,17 +11,17 @@ public class ProposalData {
     public ProposalData() {
     }
 
-    public ProposalData(String car, String numberOfDoors, Integer numberOfCylinders, Integer numberOfAxis, Integer maxSpeed) {
+    public ProposalData(String car, Integer numberOfDoors, Integer numberOfCylinders, Integer numberOfAxis, Integer maxSpeed) {
         this(numberOfDoors, numberOfCylinders, numberOfAxis, maxSpeed);
         this.car = car;
     }
 
-    public ProposalData(String car, String username, String numberOfDoors, Integer numberOfCylinders, Integer numberOfAxis, Integer maxSpeed) {
+    public ProposalData(String car, String username, Integer numberOfDoors, Integer numberOfCylinders, Integer numberOfAxis, Integer maxSpeed) {
         this(car, numberOfDoors, numberOfCylinders, numberOfAxis, maxSpeed);
         this.username = username;
     }
 
-    public ProposalData(String numberOfDoors, Integer numberOfCylinders, Integer numberOfAxis, Integer maxSpeed) {
+    public ProposalData(Integer numberOfDoors, Integer numberOfCylinders, Integer numberOfAxis, Integer maxSpeed) {
         this();
         this.numberOfDoors = numberOfDoors;
         this.numberOfCylinders = numberOfCylinders;
@@ -45,11 +45,11 @@ public class ProposalData {
         this.username = username;
     }
 
-    public String getNumberOfDoors() {
+    public Integer getNumberOfDoors() {
         return numberOfDoors;
     }
 
-    public void setNumberOfDoors(String numberOfDoors) {
+    public void setNumberOfDoors(Integer numberOfDoors) {
         this.numberOfDoors = numberOfDoors;
     }
 
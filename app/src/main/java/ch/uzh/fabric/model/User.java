@@ -6,6 +6,7 @@ public class User {
     private String name;
     private Integer balance;
     private ArrayList<String> cars;
+    private ArrayList<String> keptCars;
     private ArrayList<Offer> offers;
 
     public User(String name, ArrayList<String> cars, Integer balance, ArrayList<Offer> offers) {
@@ -35,6 +36,14 @@ public class User {
         this.cars = cars;
     }
 
+    public ArrayList<String> getKeptCars() {
+        return keptCars;
+    }
+
+    public void setKeptCars(ArrayList<String> keptCars) {
+        this.keptCars = keptCars;
+    }
+
     public void setBalance(Integer balance) {
         this.balance = balance;
     }
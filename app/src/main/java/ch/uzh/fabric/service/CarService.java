@@ -25,6 +25,13 @@ public class CarService extends TrxService {
             cars.add(car);
         }
 
+        // cars of other owners the user keeps, e.g. leased cars
+        if (user.getKeptCars() != null) {
+            for (String vin : user.getKeptCars()) {
+                cars.add(getCar(username, role, vin));
+            }
+        }
+
         return cars;
     }
 
@@ -21,10 +21,14 @@ public class DotService extends TrxService {
         return query(request, hfc.getChain(), new TypeToken<Collection<ProposalData>>(){}.getType());
     }
 
-    public void register(String owner, String role, String vin) throws Exception {
+    public void register(String owner, String role, String vin, boolean individual) throws Exception {
         TransactionProposalRequest request = hfc.getClient().newTransactionProposalRequest();
         request.setFcn("register");
-        request.setArgs(new String[]{owner, role, vin});
+        if (individual) {
+            request.setArgs(new String[]{owner, role, vin, "individual"});
+        } else {
+            request.setArgs(new String[]{owner, role, vin});
+        }
         executeTrx(request, hfc.getChain());
     }
 
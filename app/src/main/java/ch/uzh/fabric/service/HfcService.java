@@ -361,7 +361,7 @@ public class HfcService {
         instantiateProposalRequest.setProposalWaitTime(60000);
         instantiateProposalRequest.setChaincodeID(chainCodeID);
         instantiateProposalRequest.setFcn("init");
-        instantiateProposalRequest.setArgs(new String[]{"999"});
+        instantiateProposalRequest.setArgs(new String[]{"999", SecurityConfig.BOOTSTRAP_DOT_USER});
         Map<String, byte[]> tm = new HashMap<>();
         tm.put("HyperLedgerFabric", "InstantiateProposalRequest:JavaSDK".getBytes(UTF_8));
         tm.put("method", "InstantiateProposalRequest".getBytes(UTF_8));
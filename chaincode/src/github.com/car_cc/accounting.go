@@ -0,0 +1,335 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+/*
+ * Returns the account index with all accounts
+ * holding a balance, including the system accounts.
+ */
+func (t *CarChaincode) getAccountIndex(stub shim.ChaincodeStubInterface) (map[string]string, error) {
+	response := t.read(stub, accountIndexStr)
+	accountIndex := make(map[string]string)
+	err := json.Unmarshal(response.Payload, &accountIndex)
+	if err != nil {
+		return nil, errors.New("Error parsing account index")
+	}
+
+	return accountIndex, nil
+}
+
+/*
+ * Adds or removes an account from the account index
+ */
+func (t *CarChaincode) updateAccountIndex(stub shim.ChaincodeStubInterface, account string, open bool) error {
+	accountIndex, err := t.getAccountIndex(stub)
+	if err != nil {
+		return err
+	}
+
+	if open {
+		accountIndex[account] = account
+	} else {
+		delete(accountIndex, account)
+	}
+
+	indexAsBytes, _ := json.Marshal(accountIndex)
+	err = stub.PutState(accountIndexStr, indexAsBytes)
+	if err != nil {
+		return errors.New("Error writing account index")
+	}
+
+	return nil
+}
+
+/*
+ * Returns the journal with all balance movements
+ */
+func (t *CarChaincode) getJournal(stub shim.ChaincodeStubInterface) ([]JournalEntry, error) {
+	entries, err := readLog(journalStr, stub)
+	if err != nil {
+		return nil, errors.New("Error reading journal")
+	}
+
+	journal := []JournalEntry{}
+	for _, entryAsBytes := range entries {
+		entry := JournalEntry{}
+		err = json.Unmarshal(entryAsBytes, &entry)
+		if err != nil {
+			return nil, errors.New("Error parsing journal")
+		}
+		journal = append(journal, entry)
+	}
+
+	return journal, nil
+}
+
+/*
+ * Moves money from one account to another and
+ * records the movement in the journal.
+ *
+ * Every balance change has to go through this function.
+ * The debit account is charged, the credit account receives
+ * the amount. No balance checks are performed, accounts
+ * may be overdrawn, e.g. when buying a car on credit.
+ * The amount has to be in the currency of both accounts.
+ *
+ * The balances are changed on the given users only,
+ * the caller writes them back to the ledger once.
+ *
+ * On success,
+ * returns the journal entry.
+ */
+func (t *CarChaincode) transfer(stub shim.ChaincodeStubInterface, debitAccount *User, creditAccount *User, amount Money, reason string, reference string) (JournalEntry, error) {
+	debit := debitAccount.Name
+	credit := creditAccount.Name
+	if amount.Amount <= 0 {
+		return JournalEntry{}, errors.New("Transfer amount has to be positive")
+	} else if debit == credit {
+		return JournalEntry{}, errors.New("Cannot transfer money to the same account")
+	}
+
+	debitBalance, err := debitAccount.Balance.Sub(amount)
+	if err != nil {
+		return JournalEntry{}, err
+	}
+
+	creditBalance, err := creditAccount.Balance.Add(amount)
+	if err != nil {
+		return JournalEntry{}, err
+	}
+
+	debitAccount.Balance = debitBalance
+	creditAccount.Balance = creditBalance
+
+	entry := JournalEntry{
+		Debit:     debit,
+		Credit:    credit,
+		Amount:    amount,
+		Reason:    reason,
+		Reference: reference,
+		TxId:      stub.GetTxID(),
+		CreatedTs: txTimestamp(stub)}
+
+	// append the movement to the journal under its own key
+	key, err := logEntryKey(journalStr, t.nextLogSequence(stub), stub)
+	if err != nil {
+		return JournalEntry{}, errors.New("Error creating journal key")
+	}
+
+	entryAsBytes, _ := json.Marshal(entry)
+	err = stub.PutState(key, entryAsBytes)
+	if err != nil {
+		return JournalEntry{}, errors.New("Error writing journal")
+	}
+
+	fmt.Printf("Transferred %s from '%s' to '%s' (%s)\n", amount, debit, credit, reason)
+	return entry, nil
+}
+
+/*
+ * Transfers money from one user to another.
+ *
+ * Unlike car purchases, a transfer cannot overdraw
+ * the account of the sender.
+ *
+ * Arguments required:
+ * [0] Recipient username      (string)
+ * [1] Amount                  (string, e.g. '12.50 CHF')
+ * [2] (optional) Reference    (string)
+ *
+ * On success,
+ * returns the journal entry.
+ */
+func (t *CarChaincode) transferToUser(stub shim.ChaincodeStubInterface, sender string, args []string) pb.Response {
+	recipient := args[0]
+	amount, err := ParsePositiveMoney(args[1])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	reference := ""
+	if len(args) > 2 {
+		reference = args[2]
+	}
+
+	// only transfers between users are allowed,
+	// system accounts are not in the user index
+	userIndex, err := t.getUserIndex(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	} else if _, exists := userIndex[recipient]; !exists {
+		return shim.Error(fmt.Sprintf("Could not find user %s", recipient))
+	}
+
+	users := make(map[string]*User)
+	user, err := t.loadUser(stub, users, sender)
+	if err != nil {
+		return shim.Error(err.Error())
+	} else if !user.Balance.Covers(amount) {
+		return shim.Error("Insufficient balance for this transfer")
+	}
+
+	recipientAsUser, err := t.loadUser(stub, users, recipient)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	entry, err := t.transfer(stub, user, recipientAsUser, amount, "transfer", reference)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	err = t.saveUsers(stub, users)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	entryAsBytes, _ := json.Marshal(entry)
+	return shim.Success(entryAsBytes)
+}
+
+/*
+ * Returns the statement of a user account.
+ *
+ * The statement lists all balance movements in the time range
+ * with the running balance. Accounts start with a zero balance,
+ * the opening balance is the sum of all earlier movements.
+ *
+ * Arguments (optional):
+ * [0] From timestamp          (int, unix seconds, default 0)
+ * [1] To timestamp            (int, unix seconds, default now)
+ *
+ * On success,
+ * returns the statement.
+ */
+func (t *CarChaincode) readStatement(stub shim.ChaincodeStubInterface, username string, args []string) pb.Response {
+	from := int64(0)
+	to := txTimestamp(stub)
+	var err error
+
+	// time range input sanitation
+	if len(args) > 0 && args[0] != "" {
+		from, err = strconv.ParseInt(args[0], 10, 64)
+		if err != nil {
+			return shim.Error("'readStatement' expects a unix timestamp as start of the range")
+		}
+	}
+	if len(args) > 1 && args[1] != "" {
+		to, err = strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			return shim.Error("'readStatement' expects a unix timestamp as end of the range")
+		}
+	}
+	if from > to {
+		return shim.Error("Start of the range has to be before its end")
+	}
+
+	user, err := t.getUser(stub, username)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	journal, err := t.getJournal(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// replay the journal to get the running balance
+	balance := Money{Currency: user.Balance.currency()}
+	statement := Statement{Account: username, From: from, To: to, Lines: []StatementLine{}}
+	for _, entry := range journal {
+		if entry.CreatedTs > to {
+			break
+		}
+
+		line := StatementLine{
+			CreatedTs: entry.CreatedTs,
+			TxId:      entry.TxId,
+			Reason:    entry.Reason,
+			Reference: entry.Reference}
+
+		if entry.Credit == username {
+			line.Counterparty = entry.Debit
+			line.Amount = entry.Amount
+		} else if entry.Debit == username {
+			line.Counterparty = entry.Credit
+			line.Amount = entry.Amount.Neg()
+		} else {
+			continue
+		}
+
+		// movements before the range make up the opening balance
+		if entry.CreatedTs < from {
+			balance, err = balance.Add(line.Amount)
+			if err != nil {
+				return shim.Error(err.Error())
+			}
+			continue
+		}
+
+		if len(statement.Lines) == 0 {
+			statement.OpeningBalance = balance
+		}
+
+		balance, err = balance.Add(line.Amount)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+
+		line.Balance = balance
+		statement.Lines = append(statement.Lines, line)
+	}
+
+	if len(statement.Lines) == 0 {
+		statement.OpeningBalance = balance
+	}
+	statement.ClosingBalance = balance
+
+	statementAsBytes, _ := json.Marshal(statement)
+	return shim.Success(statementAsBytes)
+}
+
+/*
+ * Checks that no money got lost or created out of thin air.
+ *
+ * Minted money is booked against the mint account, therefore
+ * the sum of all other balances has to equal the money minted.
+ *
+ * On success,
+ * returns the balance check.
+ */
+func (t *CarChaincode) checkBalances(stub shim.ChaincodeStubInterface) pb.Response {
+	accountIndex, err := t.getAccountIndex(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	check := BalanceCheck{TotalBalances: NewMoney(0), TotalMinted: NewMoney(0)}
+	for account := range accountIndex {
+		user, err := t.getUser(stub, account)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+
+		if account == mintUsername {
+			check.TotalMinted = user.Balance.Neg()
+		} else {
+			check.TotalBalances, err = check.TotalBalances.Add(user.Balance)
+			if err != nil {
+				return shim.Error(err.Error())
+			}
+		}
+	}
+	check.Balanced = check.TotalBalances == check.TotalMinted
+
+	checkAsBytes, _ := json.Marshal(check)
+	return shim.Success(checkAsBytes)
+}
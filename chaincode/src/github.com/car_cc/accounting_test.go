@@ -0,0 +1,154 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/hyperledger/fabric/common/util"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+func TestTransferAndJournal(t *testing.T) {
+	alice := "alice"
+	bob := "bob"
+
+	// create and name a new chaincode mock
+	carChaincode := &CarChaincode{}
+	stub := shim.NewMockStub("car", carChaincode)
+
+	ccSetup(t, stub)
+
+	stub.MockInvoke(uuid, util.ToChaincodeArgs("createUser", alice, "user", alice))
+	stub.MockInvoke(uuid, util.ToChaincodeArgs("createUser", alice, "user", bob))
+	stub.MockInvoke(uuid, util.ToChaincodeArgs("deposit", "ubs", "bank", alice, "100", "ubs-0001"))
+
+	// transfers cannot overdraw the account
+	response := stub.MockInvoke(uuid, util.ToChaincodeArgs("transfer", alice, "user", bob, "101"))
+	if response.Status != shim.ERROR {
+		t.Error("Transfer should not overdraw the account")
+	}
+
+	// system accounts cannot receive transfers
+	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("transfer", alice, "user", treasuryUsername, "10"))
+	if response.Status != shim.ERROR {
+		t.Error("Transfer to system accounts should not be possible")
+	}
+
+	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("transfer", alice, "user", bob, "40", "rent"))
+	entry := JournalEntry{}
+	err := json.Unmarshal(response.Payload, &entry)
+	if err != nil {
+		t.Error(response.Message)
+		return
+	}
+
+	if entry.Debit != alice || entry.Credit != bob || entry.Amount != NewMoney(4000) || entry.Reference != "rent" {
+		t.Error("Wrong journal entry for transfer")
+	}
+
+	// the journal records the deposit and the transfer
+	journal, err := carChaincode.getJournal(stub)
+	if err != nil {
+		t.Error(err.Error())
+	}
+
+	fmt.Printf("Journal: %v\n", journal)
+
+	if len(journal) != 2 || journal[0].Debit != mintUsername || journal[0].Reason != "deposit" {
+		t.Error("Balance movements not recorded in the journal")
+	}
+
+	// bob leaves and hands his balance over to alice
+	stub.MockInvoke(uuid, util.ToChaincodeArgs("deleteUser", bob, "user", bob, alice))
+
+	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("readUser", alice, "user"))
+	user := User{}
+	json.Unmarshal(response.Payload, &user)
+	if user.Balance != NewMoney(10000) {
+		t.Error("Remaining balance not transferred")
+	}
+
+	// no money got lost on the way
+	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("checkBalances", "dot-user", "dot"))
+	check := BalanceCheck{}
+	err = json.Unmarshal(response.Payload, &check)
+	if err != nil {
+		t.Error("Error checking balances")
+	} else if !check.Balanced || check.TotalMinted != NewMoney(10000) {
+		t.Error(fmt.Sprintf("Balances do not add up: %v", check))
+	}
+}
+
+func TestStatement(t *testing.T) {
+	alice := "alice"
+	bob := "bob"
+
+	// create and name a new chaincode mock
+	carChaincode := &CarChaincode{}
+	stub := shim.NewMockStub("car", carChaincode)
+
+	ccSetup(t, stub)
+
+	stub.MockInvoke(uuid, util.ToChaincodeArgs("createUser", alice, "user", alice))
+	stub.MockInvoke(uuid, util.ToChaincodeArgs("createUser", alice, "user", bob))
+	stub.MockInvoke(uuid, util.ToChaincodeArgs("deposit", "ubs", "bank", alice, "100", "ubs-0001"))
+	stub.MockInvoke(uuid, util.ToChaincodeArgs("transfer", alice, "user", bob, "40", "rent"))
+
+	response := stub.MockInvoke(uuid, util.ToChaincodeArgs("readStatement", alice, "user", "abc"))
+	if response.Status != shim.ERROR {
+		t.Error("Statement range should be validated")
+	}
+
+	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("readStatement", alice, "user"))
+	statement := Statement{}
+	err := json.Unmarshal(response.Payload, &statement)
+	if err != nil {
+		t.Error(response.Message)
+		return
+	}
+
+	fmt.Printf("Statement: %v\n", statement)
+
+	if statement.OpeningBalance != NewMoney(0) || statement.ClosingBalance != NewMoney(6000) {
+		t.Error("Wrong opening or closing balance")
+	} else if len(statement.Lines) != 2 {
+		t.Error("Balance movements missing on the statement")
+	} else if statement.Lines[1].Counterparty != bob || statement.Lines[1].Amount != NewMoney(-4000) || statement.Lines[1].Balance != NewMoney(6000) {
+		t.Error("Wrong statement line for transfer")
+	}
+
+	// movements before the range make up the opening balance
+	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("readStatement", bob, "user", "99999999999", "99999999999"))
+	statement = Statement{}
+	json.Unmarshal(response.Payload, &statement)
+	if len(statement.Lines) != 0 || statement.OpeningBalance != NewMoney(4000) {
+		t.Error("Earlier movements not included in the opening balance")
+	}
+}
+
+func TestBankTransactionsOnPeer(t *testing.T) {
+	alice := "alice"
+
+	// writes only show up in later transactions
+	stub := newPeerStub(t)
+
+	stub.invoke("tx1", "createUser", alice, "user", alice)
+	stub.invoke("tx2", "deposit", "ubs", "bank", alice, "100", "ubs-0001")
+	response := stub.invoke("tx3", "withdraw", "ubs", "bank", alice, "30", "ubs-0002")
+	if response.Status != shim.OK {
+		t.Error(response.Message)
+		return
+	}
+
+	// balance and receipts are kept together
+	user, _ := stub.cc.getUser(stub, alice)
+	if user.Balance.String() != "70.00 CHF" || len(user.BankReceipts) != 2 {
+		t.Errorf("Bank transactions not booked on the account: %v", user)
+	}
+
+	mint, _ := stub.cc.getUser(stub, mintUsername)
+	if mint.Balance.String() != "-70.00 CHF" {
+		t.Errorf("Bank transactions not booked against the mint, balance is %s", mint.Balance)
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+/*
+ * Returns the access log, oldest entries first.
+ */
+func (t *CarChaincode) getAccessLog(stub shim.ChaincodeStubInterface) ([]AccessLogEntry, error) {
+	entries, err := readLog(accessLogStr, stub)
+	if err != nil {
+		return nil, errors.New("Error reading access log")
+	}
+
+	accessLog := []AccessLogEntry{}
+	for _, entryAsBytes := range entries {
+		entry := AccessLogEntry{}
+		err = json.Unmarshal(entryAsBytes, &entry)
+		if err != nil {
+			return nil, errors.New("Error parsing access log")
+		}
+		accessLog = append(accessLog, entry)
+	}
+
+	return accessLog, nil
+}
+
+/*
+ * Records an access to personal data on the ledger.
+ *
+ * Only lookups submitted as transactions are written,
+ * plain queries are not committed and leave no trace.
+ */
+func (t *CarChaincode) logAccess(stub shim.ChaincodeStubInterface, username string, role string, function string, subject string) error {
+	entry := AccessLogEntry{
+		Username:  username,
+		Role:      role,
+		Function:  function,
+		Subject:   subject,
+		TxId:      stub.GetTxID(),
+		CreatedTs: txTimestamp(stub)}
+
+	// append the access to the log under its own key
+	key, err := logEntryKey(accessLogStr, t.nextLogSequence(stub), stub)
+	if err != nil {
+		return errors.New("Error creating access log key")
+	}
+
+	entryAsBytes, _ := json.Marshal(entry)
+	err = stub.PutState(key, entryAsBytes)
+	if err != nil {
+		return errors.New("Error writing access log")
+	}
+
+	return nil
+}
+
+/*
+ * Reads the access log for a data-protection audit.
+ *
+ * Arguments (optional):
+ * [0] Username             (string, only accesses of this user)
+ *
+ * On success,
+ * returns the access log entries.
+ */
+func (t *CarChaincode) readAccessLog(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	accessLog, err := t.getAccessLog(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	if len(args) > 0 && args[0] != "" {
+		filtered := []AccessLogEntry{}
+		for _, entry := range accessLog {
+			if entry.Username == args[0] {
+				filtered = append(filtered, entry)
+			}
+		}
+		accessLog = filtered
+	}
+
+	accessLogAsBytes, _ := json.Marshal(accessLog)
+	return shim.Success(accessLogAsBytes)
+}
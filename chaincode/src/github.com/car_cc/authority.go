@@ -0,0 +1,236 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+/*
+ * Returns the cantons of the registration authorities by DOT user.
+ */
+func (t *CarChaincode) getAuthorities(stub shim.ChaincodeStubInterface) (map[string]string, error) {
+	response := t.read(stub, authorityIndexStr)
+	authorityIndex := make(map[string]string)
+	err := json.Unmarshal(response.Payload, &authorityIndex)
+	if err != nil {
+		return nil, errors.New("Error parsing authority index")
+	}
+
+	return authorityIndex, nil
+}
+
+/*
+ * Returns the canton a DOT user acts for.
+ *
+ * DOT users of the federal office act on cars of all
+ * cantons, their canton is empty. DOT users without
+ * assignment cannot act at all.
+ */
+func (t *CarChaincode) getAuthority(stub shim.ChaincodeStubInterface, username string) (string, error) {
+	authorityIndex, err := t.getAuthorities(stub)
+	if err != nil {
+		return "", err
+	}
+
+	authority, assigned := authorityIndex[username]
+	if !assigned {
+		return "", fmt.Errorf("DOT user '%s' is not assigned to a registration authority", username)
+	} else if authority == federalOffice {
+		return "", nil
+	}
+
+	return authority, nil
+}
+
+/*
+ * Validates and normalises a canton code, e.g. 'zh' to 'ZH'.
+ *
+ * An empty canton stays empty.
+ */
+func NormalizeCanton(canton string) (string, error) {
+	canton = strings.ToUpper(strings.TrimSpace(canton))
+	if _, exists := cantonPlateDigits[canton]; canton != "" && !exists {
+		return "", fmt.Errorf("Unknown canton '%s'", canton)
+	}
+
+	return canton, nil
+}
+
+/*
+ * Checks if an authority is in charge of a canton.
+ *
+ * The federal office is in charge of all cantons,
+ * items without canton are open to all authorities.
+ */
+func inJurisdiction(authority string, canton string) bool {
+	return authority == "" || canton == "" || authority == canton
+}
+
+/*
+ * Checks that a DOT user may act on a car.
+ *
+ * Registered cars are handled by the authority
+ * of the canton they are registered in.
+ */
+func (t *CarChaincode) checkAuthority(stub shim.ChaincodeStubInterface, username string, car *Car) error {
+	authority, err := t.getAuthority(stub, username)
+	if err != nil {
+		return err
+	}
+
+	if !inJurisdiction(authority, car.Authority) {
+		return fmt.Errorf("Car with VIN '%s' is registered in canton %s, not in %s", car.Vin, car.Authority, authority)
+	}
+
+	return nil
+}
+
+/*
+ * Assigns a DOT user to the registration authority of a canton
+ * or, with an empty canton, to the federal office.
+ *
+ * Only the federal office assigns DOT users.
+ *
+ * Arguments required:
+ * [0] DOT username         (string)
+ * [1] Canton               (string, e.g. 'ZH', empty for the federal office)
+ *
+ * On success,
+ * returns the authority index.
+ */
+func (t *CarChaincode) assignAuthority(stub shim.ChaincodeStubInterface, username string, args []string) pb.Response {
+	dotUser := args[0]
+	canton, err := NormalizeCanton(args[1])
+	if err != nil {
+		return shim.Error(err.Error())
+	} else if dotUser == "" {
+		return shim.Error("'assignAuthority' expects a non-empty DOT username")
+	}
+
+	authorityIndex, err := t.getAuthorities(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	} else if authorityIndex[username] != federalOffice {
+		return shim.Error(fmt.Sprintf("Only the federal office can assign authorities, '%s' acts for canton %s", username, authorityIndex[username]))
+	}
+
+	if canton == "" {
+		authorityIndex[dotUser] = federalOffice
+	} else {
+		authorityIndex[dotUser] = canton
+	}
+
+	indexAsBytes, _ := json.Marshal(authorityIndex)
+	err = stub.PutState(authorityIndexStr, indexAsBytes)
+	if err != nil {
+		return shim.Error("Error writing authority index")
+	}
+
+	return shim.Success(indexAsBytes)
+}
+
+/*
+ * Re-registers a car in another canton when its keeper moves.
+ *
+ * The authority of the new canton takes over the car. A confirmed
+ * car hands in its numberplate and gets a plate of the new canton,
+ * the given one or the next free one. The keeper is charged the
+ * confirmation fee for the new plate.
+ *
+ * Arguments required:
+ * [0] Vin                  (string)
+ * [1] Canton               (string, e.g. 'BE')
+ * [2] Numberplate          (string, optional)
+ *
+ * On success,
+ * returns the car.
+ */
+func (t *CarChaincode) reregisterCar(stub shim.ChaincodeStubInterface, username string, args []string) pb.Response {
+	vin := args[0]
+	canton, err := NormalizeCanton(args[1])
+	if err != nil {
+		return shim.Error(err.Error())
+	} else if canton == "" {
+		return shim.Error("'reregister' expects the canton of the new authority")
+	}
+
+	// only the authority of the new canton takes over the car
+	authority, err := t.getAuthority(stub, username)
+	if err != nil {
+		return shim.Error(err.Error())
+	} else if !inJurisdiction(authority, canton) {
+		return shim.Error(fmt.Sprintf("Authority of canton %s cannot re-register cars in canton %s", authority, canton))
+	}
+
+	car, err := t.getCarAsDot(stub, vin)
+	if err != nil {
+		return shim.Error(err.Error())
+	} else if !IsRegistered(&car) {
+		return shim.Error("Only registered cars can be re-registered")
+	} else if IsStolen(&car) {
+		return shim.Error(fmt.Sprintf("Car with VIN '%s' is reported stolen", vin))
+	} else if IsDisposed(&car) {
+		return shim.Error(fmt.Sprintf("Car with VIN '%s' is %s", vin, CarStatus(&car)))
+	} else if car.Authority == canton {
+		return shim.Error(fmt.Sprintf("Car with VIN '%s' is already registered in canton %s", vin, canton))
+	}
+
+	reregistration := Reregistration{
+		From:           car.Authority,
+		To:             canton,
+		OldNumberplate: car.Certificate.Numberplate,
+		By:             username,
+		TxId:           stub.GetTxID(),
+		CreatedTs:      txTimestamp(stub)}
+
+	if car.Certificate.Numberplate != "" {
+		numberplate := ""
+		if len(args) > 2 && args[2] != "" {
+			numberplate, err = NormalizeNumberplate(args[2])
+			if err != nil {
+				return shim.Error(err.Error())
+			} else if !strings.HasPrefix(numberplate, canton+" ") {
+				return shim.Error(fmt.Sprintf("Numberplate '%s' is not from canton %s", numberplate, canton))
+			}
+		}
+
+		// the old plate returns to the pool of its canton
+		err = t.releaseNumberplate(stub, &car, false)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+
+		if numberplate == "" {
+			numberplate, err = t.nextFreeNumberplate(stub, canton)
+			if err != nil {
+				return shim.Error(err.Error())
+			}
+		}
+
+		err = t.issueNumberplate(stub, &car, numberplate, false)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+
+		reregistration.NewNumberplate = numberplate
+	} else if len(args) > 2 && args[2] != "" {
+		return shim.Error("Only confirmed cars get a new numberplate")
+	}
+
+	car.Authority = canton
+	car.Reregistrations = append(car.Reregistrations, reregistration)
+
+	err = t.saveCar(stub, car)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Printf("Car with VIN '%s' moved from canton '%s' to '%s'\n", vin, reregistration.From, canton)
+	carAsBytes, _ := json.Marshal(car)
+	return shim.Success(carAsBytes)
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric/common/util"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+func TestRegistrationAuthorities(t *testing.T) {
+	username := "amag"
+	insuranceCompany := "axa"
+	vin := "WVWZZZ6RZHY260780"
+	bernVin := "WVWZZZ6RZHY260781"
+
+	// create and name a new chaincode mock
+	carChaincode := &CarChaincode{}
+	stub := shim.NewMockStub("car", carChaincode)
+
+	ccSetup(t, stub)
+
+	// the federal office assigns the cantonal authorities
+	stub.MockInvoke(uuid, util.ToChaincodeArgs("assignAuthority", "federal-user", "dot", "zurich-user", "zh"))
+	stub.MockInvoke(uuid, util.ToChaincodeArgs("assignAuthority", "federal-user", "dot", "bern-user", "BE"))
+
+	response := stub.MockInvoke(uuid, util.ToChaincodeArgs("assignAuthority", "zurich-user", "dot", "zurich-user", ""))
+	if response.Status != shim.ERROR {
+		t.Error("Cantonal authorities should not assign authorities")
+	}
+
+	// unassigned DOT users cannot act
+	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("assignAuthority", "geneva-user", "dot", "geneva-user", ""))
+	if response.Status != shim.ERROR {
+		t.Error("Unassigned DOT users should not assign themselves")
+	}
+
+	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("readRegistrationProposalsAsList", "geneva-user", "dot"))
+	if response.Status != shim.ERROR {
+		t.Error("Unassigned DOT users should not act for the DOT")
+	}
+
+	// the federal office is assigned explicitly
+	stub.MockInvoke(uuid, util.ToChaincodeArgs("assignAuthority", "federal-user", "dot", "geneva-user", ""))
+	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("readRegistrationProposalsAsList", "geneva-user", "dot"))
+	if response.Status == shim.ERROR {
+		t.Error(response.Message)
+	}
+
+	stub.MockInvoke(uuid, util.ToChaincodeArgs("create", username, "garage", `{ "vin": "`+vin+`" }`, `{ "canton": "ZH" }`))
+	stub.MockInvoke(uuid, util.ToChaincodeArgs("create", username, "garage", `{ "vin": "`+bernVin+`" }`, `{ "canton": "BE" }`))
+
+	// every authority sees its own queue
+	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("readRegistrationProposalsAsList", "zurich-user", "dot"))
+	var proposals []RegistrationProposal
+	json.Unmarshal(response.Payload, &proposals)
+	if len(proposals) != 1 || proposals[0].Car != vin {
+		t.Errorf("Wrong registration queue of canton ZH: %v", proposals)
+	}
+
+	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("register", "bern-user", "dot", vin, "individual"))
+	if response.Status != shim.ERROR {
+		t.Error("Bern should not register cars of Zurich")
+	}
+
+	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("register", "zurich-user", "dot", vin, "individual"))
+	car := Car{}
+	json.Unmarshal(response.Payload, &car)
+	if car.Authority != "ZH" {
+		t.Errorf("Car should be tied to canton ZH, got '%s'", car.Authority)
+	}
+
+	stub.MockInvoke(uuid, util.ToChaincodeArgs("insureProposal", username, "user", vin, insuranceCompany))
+	stub.MockInvoke(uuid, util.ToChaincodeArgs("insuranceAccept", "insurance-user", "insurer", username, vin, insuranceCompany))
+
+	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("getCarsToConfirmAsList", "bern-user", "dot"))
+	var cars []Car
+	json.Unmarshal(response.Payload, &cars)
+	if len(cars) != 0 {
+		t.Error("Bern should not see cars of Zurich to confirm")
+	}
+
+	// plates come from the canton of registration
+	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("confirm", "zurich-user", "dot", vin, "BE 4711"))
+	if response.Status != shim.ERROR {
+		t.Error("A car of Zurich should not get a plate of Bern")
+	}
+
+	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("confirm", "zurich-user", "dot", vin, "ZH 4711"))
+	if response.Status == shim.ERROR {
+		t.Error(response.Message)
+	}
+
+	// the keeper moves to Bern
+	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("reregister", "zurich-user", "dot", vin, "BE"))
+	if response.Status != shim.ERROR {
+		t.Error("Only the authority of the new canton should re-register the car")
+	}
+
+	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("reregister", "bern-user", "dot", vin, "BE"))
+	car = Car{}
+	err := json.Unmarshal(response.Payload, &car)
+	if err != nil {
+		t.Error(response.Message)
+		return
+	}
+
+	if car.Authority != "BE" || car.Certificate.Numberplate != "BE 1" || CarStatus(&car) != "confirmed" {
+		t.Errorf("Car not handed over to Bern: %s, '%s'", car.Authority, car.Certificate.Numberplate)
+	} else if len(car.Reregistrations) != 1 || car.Reregistrations[0].From != "ZH" || car.Reregistrations[0].OldNumberplate != "ZH 4711" {
+		t.Errorf("Re-registration not recorded: %v", car.Reregistrations)
+	}
+
+	// the old plate returns to the pool of Zurich
+	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("readNumberplate", "zurich-user", "dot", "ZH 4711"))
+	plate := Numberplate{}
+	json.Unmarshal(response.Payload, &plate)
+	if IsTaken(&plate, time.Now().Unix()) {
+		t.Error("Old numberplate not released")
+	}
+
+	// Zurich is no longer in charge
+	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("deregister", "zurich-user", "dot", vin))
+	if response.Status != shim.ERROR {
+		t.Error("Zurich should not deregister cars of Bern")
+	}
+}
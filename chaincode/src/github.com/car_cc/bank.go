@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+/*
+ * Deposits money on the account of a user.
+ *
+ * Only banks can bring money into the system. The money
+ * is booked against the mint account and the user
+ * receives a receipt with the external reference.
+ *
+ * Arguments required:
+ * [0] Account holder username  (string)
+ * [1] Amount                   (string, e.g. '500 CHF')
+ * [2] External reference       (string)
+ *
+ * On success,
+ * returns the bank receipt.
+ */
+func (t *CarChaincode) deposit(stub shim.ChaincodeStubInterface, bank string, args []string) pb.Response {
+	return t.bankTransaction(stub, bank, "deposit", args)
+}
+
+/*
+ * Withdraws money from the account of a user.
+ *
+ * Only banks can pay out money. Withdrawals
+ * cannot overdraw the account of the user.
+ *
+ * Arguments required:
+ * [0] Account holder username  (string)
+ * [1] Amount                   (string, e.g. '500 CHF')
+ * [2] External reference       (string)
+ *
+ * On success,
+ * returns the bank receipt.
+ */
+func (t *CarChaincode) withdraw(stub shim.ChaincodeStubInterface, bank string, args []string) pb.Response {
+	return t.bankTransaction(stub, bank, "withdrawal", args)
+}
+
+/*
+ * Books a deposit or withdrawal against the mint account
+ * and hands out a receipt to the account holder.
+ */
+func (t *CarChaincode) bankTransaction(stub shim.ChaincodeStubInterface, bank string, transactionType string, args []string) pb.Response {
+	account := args[0]
+	reference := args[2]
+
+	// amount input sanitation
+	amount, err := ParsePositiveMoney(args[1])
+	if err != nil {
+		return shim.Error(err.Error())
+	} else if reference == "" {
+		return shim.Error(fmt.Sprintf("'%s' expects a non-empty external reference", transactionType))
+	}
+
+	// only user accounts can be served by a bank,
+	// system accounts are not in the user index
+	userIndex, err := t.getUserIndex(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	} else if _, exists := userIndex[account]; !exists {
+		return shim.Error(fmt.Sprintf("Could not find user %s", account))
+	}
+
+	// withdrawals cannot overdraw the account
+	user, err := t.getUser(stub, account)
+	if err != nil {
+		return shim.Error(err.Error())
+	} else if transactionType == "withdrawal" && !user.Balance.Covers(amount) {
+		return shim.Error("Insufficient balance for this withdrawal")
+	}
+
+	mint, err := t.getUser(stub, mintUsername)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	var entry JournalEntry
+	if transactionType == "deposit" {
+		entry, err = t.transfer(stub, &mint, &user, amount, transactionType, reference)
+	} else {
+		entry, err = t.transfer(stub, &user, &mint, amount, transactionType, reference)
+	}
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	receipt := BankReceipt{
+		Id:        entry.TxId,
+		Type:      transactionType,
+		Account:   account,
+		Bank:      bank,
+		Amount:    amount,
+		Reference: reference,
+		CreatedTs: entry.CreatedTs}
+
+	// hand out the receipt with the updated balance,
+	// account and mint are written once
+	user.BankReceipts = append(user.BankReceipts, receipt)
+
+	err = t.saveUsers(stub, map[string]*User{account: &user, mintUsername: &mint})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	receiptAsBytes, _ := json.Marshal(receipt)
+	return shim.Success(receiptAsBytes)
+}
@@ -4,7 +4,6 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"strconv"
 	"time"
 
 	"github.com/hyperledger/fabric/core/chaincode/shim"
@@ -75,6 +74,7 @@ func (t *CarChaincode) getOwner(stub shim.ChaincodeStubInterface, vin string) (s
  * A registration proposal will be issued on successfull car creation.
  * For this proposal, optional registration data can be passed to
  * 'createCar' to createCar a tailored registration proposal.
+ * Its technical data has to pass the validation.
  *
  * Expects 'args':
  *  Car with VIN                             json
@@ -91,12 +91,22 @@ func (t *CarChaincode) createCar(stub shim.ChaincodeStubInterface, username stri
 	// create new registration proposal for the DOT
 	regProposal := RegistrationProposal{}
 
-	// if provided, read additional registration data
+	// if provided, read and validate additional registration data
 	if len(args) > 1 {
 		fmt.Printf("Received registration data: %s\n", args[1])
 		err := json.Unmarshal([]byte(args[1]), &regProposal)
 		if err != nil {
-			fmt.Println("Unable to parse your registration data")
+			return shim.Error("Error parsing registration data. Expecting RegistrationProposal as json.")
+		}
+
+		err = ValidateTechnicalData(&regProposal.TechnicalData)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+
+		regProposal.Canton, err = NormalizeCanton(regProposal.Canton)
+		if err != nil {
+			return shim.Error(err.Error())
 		}
 	}
 
@@ -108,13 +118,41 @@ func (t *CarChaincode) createCar(stub shim.ChaincodeStubInterface, username stri
 	err := json.Unmarshal([]byte(args[0]), &car)
 	if err != nil {
 		return shim.Error("Error parsing car data. Expecting Car with VIN as json.")
-	} else if car.Vin == "" {
+	}
+
+	// normalise and validate the VIN
+	car.Vin = NormalizeVin(car.Vin)
+	if car.Vin == "" {
 		return shim.Error("Vin is required, cannot be empty.")
 	}
+	err = ValidateVin(car.Vin)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// decode manufacturer and model year
+	car.Wmi = car.Vin[:3]
+	car.Manufacturer = DecodeManufacturer(car.Vin)
+	car.ModelYear = DecodeModelYear(car.Vin)
 
 	// add car birth date
 	car.CreatedTs = time.Now().Unix()
 
+	// the creator owns and keeps the car
+	// until a keeper is assigned by the owner
+	car.Certificate.Owner = username
+	car.Certificate.Keeper = username
+
+	// the car starts its lifecycle with
+	// a pending registration proposal
+	car.Status = ""
+	car.Transitions = nil
+	recordTransition(stub, &car, "", "created", username, "create")
+	err = transitionCar(stub, &car, "registrationPending", username, "create")
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
 	// check for existing garage user with that name
 	user, err := t.getUser(stub, username)
 	if err != nil {
@@ -174,16 +212,19 @@ func (t *CarChaincode) createCar(stub shim.ChaincodeStubInterface, username stri
 	// update the car vin and the username
 	// in the registration proposal
 	// and save the proposal for the DOT
+	regProposal.Id = stub.GetTxID()
 	regProposal.Car = car.Vin
 	regProposal.Username = username
+	regProposal.CreatedTs = car.CreatedTs
+	regProposal.History = nil
+	decideRegistrationProposal(stub, &regProposal, "pending", username, "")
 	proposalIndex[car.Vin] = regProposal
 
 	// write udpated proposal index back to ledger
 	// for the DOT to read and register the car
-	indexAsBytes, _ = json.Marshal(proposalIndex)
-	err = stub.PutState(registrationProposalIndexStr, indexAsBytes)
+	err = t.saveRegistrationProposals(stub, proposalIndex)
 	if err != nil {
-		return shim.Error("Error writing registration proposal index")
+		return shim.Error(err.Error())
 	}
 
 	// car creation successfull,
@@ -191,6 +232,150 @@ func (t *CarChaincode) createCar(stub shim.ChaincodeStubInterface, username stri
 	return shim.Success(carAsBytes)
 }
 
+/*
+ * Withdraws a pending registration proposal.
+ *
+ * Only the car owner can withdraw the proposal.
+ * A withdrawn proposal can be resubmitted later on.
+ *
+ * On success,
+ * returns the withdrawn proposal.
+ */
+func (t *CarChaincode) withdrawRegistrationProposal(stub shim.ChaincodeStubInterface, username string, vin string) pb.Response {
+	// reading the car checks for ownership
+	car, err := t.getCar(stub, username, vin)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	proposals, err := t.getRegistrationProposals(stub)
+	if err != nil {
+		return shim.Error("Error reading registration proposal index")
+	}
+
+	proposal, exists := proposals[vin]
+	if !exists {
+		return shim.Error(fmt.Sprintf("There exists no registration proposal for car with VIN: %s", vin))
+	} else if !IsPending(&proposal) {
+		return shim.Error(fmt.Sprintf("Registration proposal for car with VIN '%s' is %s", vin, proposal.Status))
+	}
+
+	decideRegistrationProposal(stub, &proposal, "withdrawn", username, "")
+	proposals[vin] = proposal
+
+	err = transitionCar(stub, &car, "created", username, "withdrawRegistrationProposal")
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	err = t.saveCar(stub, car)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	err = t.saveRegistrationProposals(stub, proposals)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	proposalAsBytes, _ := json.Marshal(proposal)
+	return shim.Success(proposalAsBytes)
+}
+
+/*
+ * Resubmits a rejected or withdrawn registration proposal
+ * with corrected registration data.
+ *
+ * Only the car owner can resubmit the proposal. The proposal
+ * gets a new ID and is pending again, the decision history
+ * of earlier submissions is kept.
+ *
+ * Required arguments:
+ *   [0] Vin                   (string)
+ *   [1] RegistrationProposal  (json)
+ *
+ * On success,
+ * returns the resubmitted proposal.
+ */
+func (t *CarChaincode) resubmitRegistrationProposal(stub shim.ChaincodeStubInterface, username string, args []string) pb.Response {
+	vin := args[0]
+
+	// reading the car checks for ownership
+	car, err := t.getCar(stub, username, vin)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	corrected := RegistrationProposal{}
+	err = json.Unmarshal([]byte(args[1]), &corrected)
+	if err != nil {
+		return shim.Error("Error parsing registration data. Expecting RegistrationProposal as json.")
+	}
+
+	err = ValidateTechnicalData(&corrected.TechnicalData)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	corrected.Canton, err = NormalizeCanton(corrected.Canton)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	proposals, err := t.getRegistrationProposals(stub)
+	if err != nil {
+		return shim.Error("Error reading registration proposal index")
+	}
+
+	proposal, exists := proposals[vin]
+	if !exists {
+		return shim.Error(fmt.Sprintf("There exists no registration proposal for car with VIN: %s", vin))
+	} else if proposal.Status != "rejected" && proposal.Status != "withdrawn" {
+		return shim.Error("Only rejected or withdrawn registration proposals can be resubmitted")
+	}
+
+	// take over the corrected registration data,
+	// keep car, owner and history of the proposal
+	corrected.Id = stub.GetTxID()
+	corrected.Car = vin
+	corrected.Username = username
+	corrected.CreatedTs = txTimestamp(stub)
+	corrected.History = proposal.History
+	decideRegistrationProposal(stub, &corrected, "pending", username, "")
+	proposals[vin] = corrected
+
+	err = transitionCar(stub, &car, "registrationPending", username, "resubmitRegistrationProposal")
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	err = t.saveCar(stub, car)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	err = t.saveRegistrationProposals(stub, proposals)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	proposalAsBytes, _ := json.Marshal(corrected)
+	return shim.Success(proposalAsBytes)
+}
+
+/*
+ * Writes a car to the ledger, the VIN is the key.
+ */
+func (t *CarChaincode) saveCar(stub shim.ChaincodeStubInterface, car Car) error {
+	carAsBytes, _ := json.Marshal(car)
+	err := stub.PutState(car.Vin, carAsBytes)
+	if err != nil {
+		return errors.New("Error writing car")
+	}
+
+	return nil
+}
+
 /*
  * Reads a car and checks for ownership
  *
@@ -223,6 +408,29 @@ func (t *CarChaincode) getCar(stub shim.ChaincodeStubInterface, username string,
 	return car, nil
 }
 
+/*
+ * Reads a car and checks for keepership
+ *
+ * Only the registered keeper of the car passes this check.
+ * The keeper insures the car and holds the numberplate,
+ * but is not necessarily the legal owner of the car.
+ *
+ * On success,
+ * returns the car.
+ */
+func (t *CarChaincode) getCarAsKeeper(stub shim.ChaincodeStubInterface, username string, vin string) (Car, error) {
+	car, err := t.getCarAsDot(stub, vin)
+	if err != nil {
+		return Car{}, err
+	}
+
+	if car.Certificate.Keeper != username {
+		return Car{}, errors.New("Forbidden: you are not the keeper of this car")
+	}
+
+	return car, nil
+}
+
 /*
  * Reads a car as DOT
  *
@@ -250,7 +458,7 @@ func (t *CarChaincode) getCarAsDot(stub shim.ChaincodeStubInterface, vin string)
 /*
  * Reads a car.
  *
- * Only the car owner can read the car.
+ * Only the car owner and the keeper can read the car.
  *
  * On success,
  * returns the car.
@@ -269,10 +477,11 @@ func (t *CarChaincode) readCar(stub shim.ChaincodeStubInterface, username string
 	}
 
 	// fetch the car index to check if the user owns the car
+	// or is at least the keeper of the car
 	owner, err := t.getOwner(stub, vin)
 	if err != nil {
 		return shim.Error(err.Error())
-	} else if owner != username {
+	} else if owner != username && car.Certificate.Keeper != username {
 		return shim.Error("Forbidden: this is not your car")
 	}
 
@@ -303,11 +512,123 @@ func (t *CarChaincode) readCarAsDot(stub shim.ChaincodeStubInterface, username s
 	return shim.Success(carResponse.Payload)
 }
 
+/*
+ * Assigns a new keeper to a car.
+ *
+ * Only the owner of a car can assign the keeper, e.g. a leasing
+ * company assigning the lessee. The insurance contract and the
+ * numberplate are bound to the keeper, therefore the car
+ * has to be revoked first if it is still confirmed.
+ * Pending insurance proposals of the previous keeper are removed.
+ *
+ * Arguments required:
+ * [0] VIN of the car          (string)
+ * [1] Keeper username         (string)
+ *
+ * On success,
+ * returns the car.
+ */
+func (t *CarChaincode) setKeeper(stub shim.ChaincodeStubInterface, owner string, args []string) pb.Response {
+	vin := args[0]
+	keeper := args[1]
+
+	if vin == "" || keeper == "" {
+		return shim.Error("'setKeeper' expects a non-empty VIN and keeper")
+	}
+
+	// fetch the car from the ledger
+	// this already checks for ownership
+	car, err := t.getCar(stub, owner, vin)
+	if err != nil {
+		return shim.Error(err.Error())
+	} else if IsDisposed(&car) {
+		return shim.Error(fmt.Sprintf("Car with VIN '%s' is %s", vin, CarStatus(&car)))
+	}
+
+	// confirmed cars keep their keeper
+	err = checkCarAction(&car, "setKeeper")
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// the keeper has to be a known user
+	_, err = t.getUser(stub, keeper)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	if car.Certificate.Keeper == keeper {
+		return shim.Error(fmt.Sprintf("User '%s' is already the keeper of car '%s'.", keeper, vin))
+	}
+
+	// check if car does not carry a numberplate anymore
+	if HasNumberplate(&car) {
+		return shim.Error("The car is still confirmed. It has to be revoked first in order to change the keeper.")
+	}
+
+	// clear pending insureProposals of the previous keeper
+	users := make(map[string]*User)
+	err = t.clearInsureProposals(stub, users, vin, "The keeper of the car changed")
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// change of keeper in the car certificate
+	err = t.moveKeptCar(stub, users, &car, keeper)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	err = t.saveUsers(stub, users)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	carAsBytes, _ := json.Marshal(car)
+	err = stub.PutState(car.Vin, carAsBytes)
+	if err != nil {
+		return shim.Error("Error writing car")
+	}
+
+	return shim.Success(carAsBytes)
+}
+
+/*
+ * Assigns a new keeper to a car and moves the car from the
+ * kept cars of the previous keeper to those of the new one.
+ *
+ * Owners keeping their own cars find them among their cars,
+ * neither the car nor the users are written to the ledger.
+ */
+func (t *CarChaincode) moveKeptCar(stub shim.ChaincodeStubInterface, users map[string]*User, car *Car, keeper string) error {
+	previous := car.Certificate.Keeper
+	if previous != "" && previous != car.Certificate.Owner {
+		user, err := t.loadUser(stub, users, previous)
+		if err == nil {
+			user.KeptCars = removeVin(user.KeptCars, car.Vin)
+		}
+	}
+
+	if keeper != car.Certificate.Owner {
+		user, err := t.loadUser(stub, users, keeper)
+		if err != nil {
+			return err
+		}
+
+		user.KeptCars = append(user.KeptCars, car.Vin)
+	}
+
+	car.Certificate.Keeper = keeper
+	return nil
+}
+
 /*
  * Creates selling offer.
  *
+ * Only the owner of a car can offer it for sale.
+ *
  * Arguments required:
- * [0] Price                       (int)
+ * [0] Price                       (string, e.g. '12500 CHF')
  * [1] VIN of the car to transfer  (string)
  * [2] Buyer username              (string)
  *
@@ -315,15 +636,30 @@ func (t *CarChaincode) readCarAsDot(stub shim.ChaincodeStubInterface, username s
  * returns the offer.
  */
 func (t *CarChaincode) createSellingOffer(stub shim.ChaincodeStubInterface, seller string, args []string) pb.Response {
-	price, _ := strconv.Atoi(args[0])
 	vin := args[1]
 	buyer := args[2]
 
 	// price input sanitation
-	if args[0] == "" || price < 0 {
+	price, err := ParseMoney(args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	} else if price.Amount < 0 {
 		return shim.Error("'sell' expects a non-empty, positive price")
 	}
 
+	// only the owner can offer the car for sale,
+	// and a financed car cannot be offered at all
+	car, err := t.getCar(stub, seller, vin)
+	if err != nil {
+		return shim.Error(err.Error())
+	} else if HasActiveLien(&car) {
+		return shim.Error("The car has an active lien. The lien has to be released before the car can be sold.")
+	} else if IsStolen(&car) {
+		return shim.Error(fmt.Sprintf("Car with VIN '%s' is reported stolen", vin))
+	} else if IsDisposed(&car) {
+		return shim.Error(fmt.Sprintf("Car with VIN '%s' is %s", vin, CarStatus(&car)))
+	}
+
 	// create new selling offer
 	offer := Offer{
 		Seller: seller,
@@ -335,6 +671,8 @@ func (t *CarChaincode) createSellingOffer(stub shim.ChaincodeStubInterface, sell
 	buyerAsObject, err := t.getUser(stub, buyer)
 	if err != nil {
 		return shim.Error("Error: Could not find buyer in database.")
+	} else if buyerAsObject.Balance.currency() != price.currency() {
+		return shim.Error(fmt.Sprintf("The price has to be in the currency of the buyer (%s).", buyerAsObject.Balance.currency()))
 	}
 	// allow only one selling offer per car toa  user
 	for _, offer := range buyerAsObject.Offers {
@@ -357,7 +695,8 @@ func (t *CarChaincode) createSellingOffer(stub shim.ChaincodeStubInterface, sell
  * Sell a car to a new owner (receiver).
  *
  * No balance checks are performed before selling a car,
- * cars are bought on credit.
+ * cars are bought on credit. The buyer is charged the
+ * sales tax on top of the price.
  *
  * Arguments required:
  * [0] VIN of the car to transfer  (string)
@@ -389,7 +728,7 @@ func (t *CarChaincode) sell(stub shim.ChaincodeStubInterface, seller string, arg
 		}
 	}
 
-	if salesOffer == (Offer{}) {
+	if salesOffer.Vin == "" {
 		return shim.Error("No sale without sales offer. Request an offer from the seller first.")
 	}
 
@@ -400,13 +739,36 @@ func (t *CarChaincode) sell(stub shim.ChaincodeStubInterface, seller string, arg
 		return shim.Error("Failed to fetch car with vin '" + vin + "' from ledger")
 	}
 
-	// check if car is not confirmed anymore
-	if IsConfirmed(&car) {
+	// confirmed cars have to be revoked first
+	err = checkCarAction(&car, "sell")
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// check if car does not carry a numberplate anymore
+	if HasNumberplate(&car) {
 		return shim.Error("The car is still confirmed. It has to be revoked first in order to do the transfer.")
 	}
 
-	// change of ownership in the car certificate
-	car.Certificate.Username = buyer
+	// check if the car is still financed
+	if HasActiveLien(&car) {
+		return shim.Error("The car has an active lien. The lien has to be released before the car can be sold.")
+	}
+
+	// stolen cars cannot change hands
+	if IsStolen(&car) {
+		return shim.Error(fmt.Sprintf("Car with VIN '%s' is reported stolen", vin))
+	}
+
+	// scrapped and exported cars are gone
+	if IsDisposed(&car) {
+		return shim.Error(fmt.Sprintf("Car with VIN '%s' is %s", vin, CarStatus(&car)))
+	}
+
+	// change of ownership in the car certificate,
+	// the buyer also becomes the new keeper
+	car.Certificate.Owner = buyer
+	car.Certificate.Keeper = buyer
 
 	// write car with udpated certificate back to ledger
 	carAsBytes, _ := json.Marshal(car)
@@ -424,8 +786,11 @@ func (t *CarChaincode) sell(stub shim.ChaincodeStubInterface, seller string, arg
 		return shim.Error(err.Error())
 	}
 
+	// every user is read and written once,
+	// the ledger does not return writes of the own transaction
+	users := make(map[string]*User)
 	for username := range userIndex {
-		user, err := t.getUser(stub, username)
+		user, err := t.loadUser(stub, users, username)
 		if err != nil {
 			return shim.Error(err.Error())
 		}
@@ -442,13 +807,18 @@ func (t *CarChaincode) sell(stub shim.ChaincodeStubInterface, seller string, arg
 
 		user.Offers = newOffers
 
-		// if buyer/seller update balances
-		// also update car lists and the car index
-		if user.Name == buyer {
-			user.Balance -= salesOffer.Price
+		// the buyer keeps the car, it leaves the previous keeper
+		user.KeptCars = removeVin(user.KeptCars, car.Vin)
 
-			// attach the car to the buyer
-			user.Cars = append(user.Cars, car.Vin)
+		// if buyer/seller update car lists and the car index
+		if user.Name == buyer {
+			// attach the car to the buyer,
+			// a deregistered car stays inactive
+			if CarStatus(&car) == "deregistered" {
+				user.FormerCars = append(user.FormerCars, car.Vin)
+			} else {
+				user.Cars = append(user.Cars, car.Vin)
+			}
 
 			// get the car index
 			carIndex, err := t.getCarIndex(stub)
@@ -467,50 +837,57 @@ func (t *CarChaincode) sell(stub shim.ChaincodeStubInterface, seller string, arg
 				return shim.Error("Error writing car index")
 			}
 		} else if user.Name == seller {
-			user.Balance += salesOffer.Price
-
 			// go through all his cars
 			// and remove the car we just transferred
-			var newCarList []string
-			for _, carVin := range user.Cars {
-				if carVin != car.Vin {
-					newCarList = append(newCarList, carVin)
-				}
-			}
-
-			user.Cars = newCarList
+			user.Cars = removeVin(user.Cars, car.Vin)
+			user.FormerCars = removeVin(user.FormerCars, car.Vin)
 		}
+	}
+
+	// clear pending insureProposals
+	// from all insurers for this car
+	err = t.clearInsureProposals(stub, users, vin, "The car was sold")
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// the buyer pays the price to the seller
+	buyerAccount, err := t.loadUser(stub, users, buyer)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	sellerAccount, err := t.loadUser(stub, users, seller)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
 
-		// write the user back to ledger
-		err = t.saveUser(stub, user)
+	if salesOffer.Price.Amount > 0 {
+		_, err = t.transfer(stub, buyerAccount, sellerAccount, salesOffer.Price, "sale", vin)
 		if err != nil {
 			return shim.Error(err.Error())
 		}
 	}
 
-	// clear pending insureProposals
-	// from all insurers for this car
-	insurerIndex, err := t.getInsurerIndex(stub)
+	// the buyer pays the sales tax
+	fees, err := t.getFeeSchedule(stub)
 	if err != nil {
-		return shim.Error("Error getting insurer index.")
+		return shim.Error(err.Error())
 	}
 
-	for _, insurer := range insurerIndex {
-		var newProposals []InsureProposal
-		for _, insProposal := range insurer.Proposals {
-			if insProposal.Car != vin {
-				newProposals = append(newProposals, insProposal)
-			}
-		}
-		insurer.Proposals = newProposals
-		insurerIndex[insurer.Name] = insurer
+	salesTax, err := salesOffer.Price.Percent(fees.SalesTax)
+	if err != nil {
+		return shim.Error(err.Error())
 	}
 
-	// write insurer index to ledger
-	indexAsBytes, _ := json.Marshal(insurerIndex)
-	err = stub.PutState(insurerIndexStr, indexAsBytes)
+	err = t.chargeFee(stub, users, buyer, "salesTax", vin, salesTax)
 	if err != nil {
-		return shim.Error("Error writing insurer index")
+		return shim.Error(err.Error())
+	}
+
+	// write the users back to ledger
+	err = t.saveUsers(stub, users)
+	if err != nil {
+		return shim.Error(err.Error())
 	}
 
 	return shim.Success(carAsBytes)
@@ -7,11 +7,12 @@ import (
 
 	"github.com/hyperledger/fabric/common/util"
 	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
 )
 
 func ccSetup(t *testing.T, stub *shim.MockStub) {
 	// a successfull init should not return any errors
-	response := stub.MockInit(uuid, util.ToChaincodeArgs("init", "999"))
+	response := stub.MockInit(uuid, util.ToChaincodeArgs("init", "999", "dot-user", "federal-user"))
 	if response.Payload != nil {
 		t.Error(response.Payload)
 	}
@@ -26,7 +27,7 @@ func ccSetup(t *testing.T, stub *shim.MockStub) {
 	json.Unmarshal(testAsBytes, &aval)
 
 	if aval != 999 {
-		t.Error("Aval for testing should be '999', but is '%d'", aval)
+		t.Errorf("Aval for testing should be '999', but is '%d'", aval)
 	}
 
 	// check out the empty car index
@@ -46,6 +47,76 @@ func ccSetup(t *testing.T, stub *shim.MockStub) {
 	}
 }
 
+/*
+ * Stub behaving like the ledger of a peer: writes of the running
+ * transaction are not returned by reads, they are committed
+ * when the transaction succeeds.
+ */
+type peerStub struct {
+	*shim.MockStub
+	cc     *CarChaincode
+	args   [][]byte
+	writes map[string][]byte
+}
+
+func newPeerStub(t *testing.T) *peerStub {
+	cc := &CarChaincode{}
+	stub := &peerStub{MockStub: shim.NewMockStub("car", cc), cc: cc}
+	ccSetup(t, stub.MockStub)
+
+	return stub
+}
+
+func (stub *peerStub) GetArgs() [][]byte {
+	return stub.args
+}
+
+func (stub *peerStub) GetStringArgs() []string {
+	args := []string{}
+	for _, arg := range stub.args {
+		args = append(args, string(arg))
+	}
+	return args
+}
+
+func (stub *peerStub) GetFunctionAndParameters() (string, []string) {
+	args := stub.GetStringArgs()
+	return args[0], args[1:]
+}
+
+func (stub *peerStub) PutState(key string, value []byte) error {
+	stub.writes[key] = value
+	return nil
+}
+
+func (stub *peerStub) DelState(key string) error {
+	stub.writes[key] = nil
+	return nil
+}
+
+func (stub *peerStub) invoke(txId string, args ...string) pb.Response {
+	stub.args = util.ToChaincodeArgs(args...)
+	stub.writes = make(map[string][]byte)
+
+	stub.MockTransactionStart(txId)
+	defer stub.MockTransactionEnd(txId)
+
+	response := stub.cc.Invoke(stub)
+	if response.Status != shim.OK {
+		return response
+	}
+
+	for key, value := range stub.writes {
+		if value == nil {
+			stub.MockStub.DelState(key)
+		} else {
+			stub.MockStub.PutState(key, value)
+		}
+	}
+
+	return response
+}
+
 func TestInit(t *testing.T) {
 	// create and name a new chaincode mock
 	carChaincode := &CarChaincode{}
@@ -57,7 +128,7 @@ func TestInit(t *testing.T) {
 func TestSellCar(t *testing.T) {
 	var username string = "amag"
 	var receiver string = "bobby"
-	var vin string = "WVW ZZZ 6RZ HY26 0780"
+	var vin string = "WVWZZZ6RZHY260780"
 	var insuranceCompany string = "axa"
 	var insuranceCompany2 string = "mobiliar"
 
@@ -81,7 +152,7 @@ func TestSellCar(t *testing.T) {
 	fmt.Printf("Successfully created car with ts '%d'\n", car.CreatedTs)
 
 	// register the car as DOT user
-	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("register", username, "dot", vin))
+	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("register", "dot-user", "dot", vin, "individual"))
 	err = json.Unmarshal(response.Payload, &car)
 	if err != nil {
 		t.Error("Error registering the car")
@@ -237,19 +308,64 @@ func TestSellCar(t *testing.T) {
 	}
 
 	// check new balances of seller (old owner)
-	if oldOwnerAsUser.Balance != 99 {
+	if oldOwnerAsUser.Balance != NewMoney(9900) {
 		t.Error("Sellers balance not updated")
 	}
 
 	// check new balances of buyer
-	if receiverAsUser.Balance != -99 {
+	if receiverAsUser.Balance != NewMoney(-9900) {
 		t.Error("Buyers balance not updated")
 	}
 }
 
+func TestSellCarOnPeer(t *testing.T) {
+	seller := "amag"
+	buyer := "bobby"
+	vin := "WVWZZZ6RZHY260780"
+
+	// writes only show up in later transactions
+	stub := newPeerStub(t)
+
+	stub.invoke("tx1", "create", seller, "garage", `{ "vin": "`+vin+`" }`)
+	stub.invoke("tx2", "createUser", seller, "garage", buyer)
+	stub.invoke("tx3", "setFeeSchedule", "dot-user", "dot", `{ "salesTax": 10 }`)
+	stub.invoke("tx4", "createSellingOffer", seller, "garage", "1000", vin, buyer)
+	response := stub.invoke("tx5", "sell", seller, "garage", vin, buyer)
+	if response.Status != shim.OK {
+		t.Error(response.Message)
+		return
+	}
+
+	// ownership, offers and balances all change with the sale
+	buyerAsUser, _ := stub.cc.getUser(stub, buyer)
+	if len(buyerAsUser.Cars) != 1 || len(buyerAsUser.Offers) != 0 {
+		t.Errorf("Car not handed over to the buyer: %v", buyerAsUser)
+	} else if buyerAsUser.Balance.String() != "-1100.00 CHF" || len(buyerAsUser.Receipts) != 1 {
+		t.Errorf("Price and sales tax not charged, balance is %s", buyerAsUser.Balance)
+	}
+
+	sellerAsUser, _ := stub.cc.getUser(stub, seller)
+	if len(sellerAsUser.Cars) != 0 || sellerAsUser.Balance.String() != "1000.00 CHF" {
+		t.Errorf("Car not taken from the seller or price not paid: %v", sellerAsUser)
+	}
+
+	// sale and sales tax are both in the journal
+	journal, _ := stub.cc.getJournal(stub)
+	if len(journal) != 2 || journal[0].Reason != "sale" || journal[1].Reason != "salesTax" {
+		t.Errorf("Journal entries of the sale missing: %v", journal)
+	}
+
+	response = stub.invoke("tx6", "checkBalances", "dot-user", "dot")
+	check := BalanceCheck{}
+	json.Unmarshal(response.Payload, &check)
+	if !check.Balanced {
+		t.Errorf("Balances do not add up: %v", check)
+	}
+}
+
 func TestCreateAndReadCar(t *testing.T) {
 	username := "amag"
-	vin := "WVW ZZZ 6RZ HY26 0780"
+	vin := "WVWZZZ6RZHY260780"
 
 	// create and name a new chaincode mock
 	carChaincode := &CarChaincode{}
@@ -337,3 +453,100 @@ func TestCreateAndReadCar(t *testing.T) {
 		return
 	}
 }
+
+func TestSetKeeper(t *testing.T) {
+	owner := "leasing-ag"
+	keeper := "lessee"
+	vin := "WVWZZZ6RZHY260780"
+	insuranceCompany := "axa"
+
+	// create and name a new chaincode mock
+	carChaincode := &CarChaincode{}
+	stub := shim.NewMockStub("car", carChaincode)
+
+	ccSetup(t, stub)
+
+	// the leasing company creates the car
+	carData := `{ "vin": "` + vin + `" }`
+	response := stub.MockInvoke(uuid, util.ToChaincodeArgs("create", owner, "garage", carData))
+	car := Car{}
+	err := json.Unmarshal(response.Payload, &car)
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+
+	if car.Certificate.Owner != owner || car.Certificate.Keeper != owner {
+		t.Error("The creator should initially own and keep the car")
+	}
+
+	// assigning an unknown user as keeper should fail
+	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("setKeeper", owner, "garage", vin, keeper))
+	if response.Status != shim.ERROR {
+		t.Error("Only existing users can become keepers")
+	}
+
+	stub.MockInvoke(uuid, util.ToChaincodeArgs("createUser", owner, "garage", keeper))
+
+	// only the owner can assign the keeper
+	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("setKeeper", keeper, "user", vin, keeper))
+	if response.Status != shim.ERROR {
+		t.Error("Only the owner should be able to assign the keeper")
+	}
+
+	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("setKeeper", owner, "garage", vin, keeper))
+	err = json.Unmarshal(response.Payload, &car)
+	if err != nil {
+		t.Error(response.Message)
+		return
+	}
+
+	if car.Certificate.Owner != owner || car.Certificate.Keeper != keeper {
+		t.Error("Keeper not assigned properly")
+	}
+
+	// the owner is no longer allowed to insure the car
+	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("insureProposal", owner, "user", vin, insuranceCompany))
+	if response.Status != shim.ERROR {
+		t.Error("Only the keeper should be able to ask for insurance")
+	}
+
+	// but the keeper is
+	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("insureProposal", keeper, "user", vin, insuranceCompany))
+	if response.Status == shim.ERROR {
+		t.Error(response.Message)
+	}
+
+	// the keeper finds and reads the car
+	user, _ := carChaincode.getUser(stub, keeper)
+	if len(user.KeptCars) != 1 || user.KeptCars[0] != vin {
+		t.Errorf("Car missing in the kept cars of the keeper: %v", user.KeptCars)
+	}
+
+	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("readCar", keeper, "user", vin))
+	if response.Status == shim.ERROR {
+		t.Error("The keeper should be able to read the car")
+	}
+
+	// but only the owner can sell it
+	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("createSellingOffer", keeper, "user", "99", vin, owner))
+	if response.Status != shim.ERROR {
+		t.Error("The keeper should not be able to sell the car")
+	}
+
+	// the owner takes the car back
+	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("setKeeper", owner, "garage", vin, owner))
+	if response.Status == shim.ERROR {
+		t.Error(response.Message)
+	}
+
+	user, _ = carChaincode.getUser(stub, keeper)
+	if len(user.KeptCars) != 0 {
+		t.Error("Car should leave the kept cars of the previous keeper")
+	}
+
+	user, _ = carChaincode.getUser(stub, owner)
+	if len(user.KeptCars) != 0 {
+		t.Error("Owners should not keep their own cars as kept cars")
+	}
+}
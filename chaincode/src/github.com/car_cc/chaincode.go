@@ -5,12 +5,17 @@ import (
 	"reflect"
 	"strconv"
 	"strings"
+	"sync"
 
 	"github.com/hyperledger/fabric/core/chaincode/shim"
 	pb "github.com/hyperledger/fabric/protos/peer"
 )
 
 type CarChaincode struct {
+	// number of log entries written per running transaction,
+	// the ledger does not return writes of the own transaction
+	mutex        sync.Mutex
+	logSequences map[string]int
 }
 
 // uuid for test mocks
@@ -22,10 +27,57 @@ const userIndexStr string = "_users"
 const insurerIndexStr string = "_insurers"
 const registrationProposalIndexStr string = "_registrationProposals"
 const revocationProposalIndexStr string = "_revocationProposals"
+const lienIndexStr string = "_liens"
+const stolenIndexStr string = "_stolen"
 
-// numberplate -> vin
+// claim id -> open insurance claim
+const claimIndexStr string = "_claims"
+
+// prefix of the insurer accounts paying out claims,
+// the leading underscore keeps them out of the user name space
+const insurerAccountPrefix string = "_insurer_"
+
+// numberplate -> plate with carrying cars and history
 const numberplateIndex string = "_numberplates"
 
+// revoked plates are retained for their holder for a year
+const plateRetentionPeriod int64 = 365 * 24 * 60 * 60
+
+// numberplate -> vanity plate reservation
+const numberplateReservationIndexStr string = "_numberplateReservations"
+
+// garages certified for inspections -> certifying DOT user
+const certifiedGarageIndexStr string = "_certifiedGarages"
+
+// recyclers licensed to scrap cars -> licensing DOT user
+const licensedRecyclerIndexStr string = "_licensedRecyclers"
+
+// DOT user -> canton of its registration authority
+const authorityIndexStr string = "_authorities"
+
+// authority of DOT users acting for the federal office
+const federalOffice string = "CH"
+
+// homologation number -> approved vehicle type
+const typeApprovalIndexStr string = "_typeApprovals"
+
+// fee schedule of the DOT
+const feeScheduleStr string = "_feeSchedule"
+
+// account collecting fees and taxes,
+// the leading underscore keeps it out of the user name space
+const treasuryUsername string = "_treasury"
+
+// counter account of all money brought into the system
+const mintUsername string = "_mint"
+
+// accounting
+const accountIndexStr string = "_accounts"
+const journalStr string = "_journal"
+
+// accesses to personal data
+const accessLogStr string = "_accessLog"
+
 func (t *CarChaincode) Init(stub shim.ChaincodeStubInterface) pb.Response {
 	fmt.Println("Car demo Init")
 
@@ -33,8 +85,8 @@ func (t *CarChaincode) Init(stub shim.ChaincodeStubInterface) pb.Response {
 	var err error
 
 	_, args := stub.GetFunctionAndParameters()
-	if len(args) != 1 {
-		return shim.Error("Incorrect number of arguments. Expecting 1 integer to test chain.")
+	if len(args) < 1 {
+		return shim.Error("Incorrect number of arguments. Expecting 1 integer to test chain and the DOT users of the federal office.")
 	}
 
 	// initialize the chaincode
@@ -81,7 +133,92 @@ func (t *CarChaincode) Init(stub shim.ChaincodeStubInterface) pb.Response {
 	}
 
 	//clear the numberplate index
-	err = clearStringIndex(numberplateIndex, stub)
+	err = clearNumberplateIndex(numberplateIndex, stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// clear the vanity plate reservations
+	err = clearReservationIndex(numberplateReservationIndexStr, stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// clear the certified garages
+	err = clearStringIndex(certifiedGarageIndexStr, stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// clear the licensed recyclers
+	err = clearStringIndex(licensedRecyclerIndexStr, stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// reset the registration authorities, the DOT users
+	// of the federal office assign all other authorities
+	err = clearAuthorityIndex(authorityIndexStr, args[1:], stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// clear the type approval catalogue
+	err = clearTypeApprovalIndex(typeApprovalIndexStr, stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// clear the lien index
+	err = clearLienIndex(lienIndexStr, stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// clear the stolen car index
+	err = clearTheftIndex(stolenIndexStr, stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// clear the open claims
+	err = clearClaimIndex(claimIndexStr, stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// reset the fee schedule, no fees are charged initially
+	err = t.saveFeeSchedule(stub, FeeSchedule{})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// clear the journal
+	err = clearLog(journalStr, stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// open the empty system accounts
+	err = clearStringIndex(accountIndexStr, stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	for _, account := range []string{treasuryUsername, mintUsername} {
+		err = t.saveUser(stub, User{Name: account, Cars: []string{}, Balance: NewMoney(0), Offers: []Offer{}})
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+
+		err = t.updateAccountIndex(stub, account, true)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+
+	// clear the access log
+	err = clearLog(accessLogStr, stub)
 	if err != nil {
 		return shim.Error(err.Error())
 	}
@@ -90,6 +227,32 @@ func (t *CarChaincode) Init(stub shim.ChaincodeStubInterface) pb.Response {
 	return shim.Success(nil)
 }
 
+/*
+ * Returns the number of the next log entry of the running transaction
+ */
+func (t *CarChaincode) nextLogSequence(stub shim.ChaincodeStubInterface) int {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if t.logSequences == nil {
+		t.logSequences = make(map[string]int)
+	}
+	sequence := t.logSequences[stub.GetTxID()]
+	t.logSequences[stub.GetTxID()] = sequence + 1
+
+	return sequence
+}
+
+/*
+ * Forgets the log entries of a finished transaction
+ */
+func (t *CarChaincode) endTransaction(txId string) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	delete(t.logSequences, txId)
+}
+
 /*
  * Invokes an action on the ledger.
  *
@@ -98,6 +261,7 @@ func (t *CarChaincode) Init(stub shim.ChaincodeStubInterface) pb.Response {
  */
 func (t *CarChaincode) Invoke(stub shim.ChaincodeStubInterface) pb.Response {
 	function, args := stub.GetFunctionAndParameters()
+	defer t.endTransaction(stub.GetTxID())
 
 	if len(args) < 2 {
 		return shim.Error("Invoke expects 'username' and 'role' as first two args.")
@@ -106,10 +270,18 @@ func (t *CarChaincode) Invoke(stub shim.ChaincodeStubInterface) pb.Response {
 	username := args[0]
 	role := args[1]
 	args = args[2:]
+	normalizeVinArg(function, args)
 
 	fmt.Printf("Invoke is running as user '%s' with role '%s'\n", username, role)
 	fmt.Printf("Invoke is running function '%s' with args: %s\n", function, strings.Join(args, ", "))
 
+	// DOT users act for the authority they are assigned to
+	if role == "dot" {
+		if _, err := t.getAuthority(stub, username); err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+
 	switch function {
 
 	// GENERAL FUNCTIONS
@@ -142,6 +314,9 @@ func (t *CarChaincode) Invoke(stub shim.ChaincodeStubInterface) pb.Response {
 	case "readUser":
 		return t.readUser(stub, username)
 
+	case "readFeeSchedule":
+		return t.readFeeSchedule(stub)
+
 	case "createUser":
 		if len(args) != 1 {
 			return shim.Error("'createUser' expects a username to create a new user")
@@ -155,10 +330,10 @@ func (t *CarChaincode) Invoke(stub shim.ChaincodeStubInterface) pb.Response {
 		return t.deleteUser(stub, args[0], args[1])
 
 	case "revocationProposal":
-		if len(args) != 1 {
-			return shim.Error("'revocationProposal' expects a car vin to revoke a car")
+		if len(args) < 1 || len(args) > 2 {
+			return shim.Error("'revocationProposal' expects a car vin and optionally a reason to revoke a car")
 		} else if role == "user" || role == "garage" {
-			return t.revocationProposal(stub, username, args[0])
+			return t.revocationProposal(stub, username, args)
 		} else {
 			return shim.Error(fmt.Sprintf("Sorry, role '%s' is not allowed to create a revocation proposal.", role))
 		}
@@ -191,14 +366,59 @@ func (t *CarChaincode) Invoke(stub shim.ChaincodeStubInterface) pb.Response {
 			return shim.Error(fmt.Sprintf("Sorry, role '%s' is not allowed to sell cars.", role))
 		}
 
-	case "updateBalance":
+	case "setKeeper":
+		if len(args) != 2 {
+			return shim.Error("'setKeeper' expects a car vin and the username of the new keeper")
+		} else if role == "user" || role == "garage" {
+			// only the owner can assign the keeper, this is checked on the car
+			return t.setKeeper(stub, username, args)
+		} else {
+			return shim.Error(fmt.Sprintf("Sorry, role '%s' is not allowed to assign keepers.", role))
+		}
+
+	case "readBalance":
+		return t.readBalance(stub, username)
+
+	case "readStatement":
+		if len(args) > 2 {
+			return shim.Error("'readStatement' expects an optional start and end timestamp")
+		}
+		return t.readStatement(stub, username, args)
+
+	case "transfer":
+		if len(args) < 2 || len(args) > 3 {
+			return shim.Error("'transfer' expects a recipient, an amount and an optional reference")
+		} else if role != "user" && role != "garage" {
+			return shim.Error(fmt.Sprintf("Sorry, role '%s' is not allowed to transfer money.", role))
+		} else {
+			return t.transferToUser(stub, username, args)
+		}
+
+	case "withdrawRegistrationProposal":
 		if len(args) != 1 {
-			return shim.Error("'updateBalance' expects update amount")
-		} else if role != "user" {
-			// only a user is allowed to update balance
-			return shim.Error(fmt.Sprintf("Sorry, role '%s' is not allowed to update the balance of a user.", role))
+			return shim.Error("'withdrawRegistrationProposal' expects a car vin")
+		} else if role == "user" || role == "garage" {
+			return t.withdrawRegistrationProposal(stub, username, args[0])
 		} else {
-			return t.updateBalance(stub, username, args[0])
+			return shim.Error(fmt.Sprintf("Sorry, role '%s' is not allowed to withdraw registration proposals.", role))
+		}
+
+	case "resubmitRegistrationProposal":
+		if len(args) != 2 {
+			return shim.Error("'resubmitRegistrationProposal' expects a car vin and the corrected RegistrationProposal as json")
+		} else if role == "user" || role == "garage" {
+			return t.resubmitRegistrationProposal(stub, username, args)
+		} else {
+			return shim.Error(fmt.Sprintf("Sorry, role '%s' is not allowed to resubmit registration proposals.", role))
+		}
+
+	case "reserveNumberplate":
+		if len(args) != 1 {
+			return shim.Error("'reserveNumberplate' expects a numberplate")
+		} else if role == "user" || role == "garage" {
+			return t.reserveNumberplate(stub, username, args)
+		} else {
+			return shim.Error(fmt.Sprintf("Sorry, role '%s' is not allowed to reserve numberplates.", role))
 		}
 
 	// GARAGE FUNCTIONS
@@ -210,13 +430,15 @@ func (t *CarChaincode) Invoke(stub shim.ChaincodeStubInterface) pb.Response {
 
 	// DOT FUNCTIONS
 	case "revoke":
-		if len(args) != 1 {
-			return shim.Error("'revoke' expects a car vin to revoke a car")
+		if len(args) < 1 || len(args) > 2 {
+			return shim.Error("'revoke' expects a car vin and optionally 'release' or 'retain' for the numberplate")
+		} else if len(args) == 2 && args[1] != "release" && args[1] != "retain" {
+			return shim.Error("'revoke' expects 'release' or 'retain' for the numberplate")
 		} else if role != "dot" {
 			// only the DOT is allowed to revoke cars
 			return shim.Error(fmt.Sprintf("Sorry, role '%s' is not allowed to revoke cars.", role))
 		} else {
-			return t.revoke(stub, username, args[0])
+			return t.revoke(stub, username, args[0], len(args) == 2 && args[1] == "retain")
 		}
 
 	case "delete":
@@ -229,35 +451,152 @@ func (t *CarChaincode) Invoke(stub shim.ChaincodeStubInterface) pb.Response {
 			return t.deleteCar(stub, args[0])
 		}
 
+	case "assignAuthority":
+		if len(args) != 2 {
+			return shim.Error("'assignAuthority' expects a DOT username and a canton")
+		} else if role != "dot" {
+			return shim.Error(fmt.Sprintf("Sorry, role '%s' is not allowed to assign authorities.", role))
+		} else {
+			return t.assignAuthority(stub, username, args)
+		}
+
+	case "assignInsurer":
+		if len(args) != 2 {
+			return shim.Error("'assignInsurer' expects an insurer username and an insurance company")
+		} else if role != "dot" {
+			return shim.Error(fmt.Sprintf("Sorry, role '%s' is not allowed to assign insurers.", role))
+		} else {
+			return t.assignInsurer(stub, username, args)
+		}
+
+	case "reregister":
+		if len(args) < 2 || len(args) > 3 {
+			return shim.Error("'reregister' expects a car vin, the new canton and optionally a numberplate")
+		} else if role != "dot" {
+			return shim.Error(fmt.Sprintf("Sorry, role '%s' is not allowed to re-register cars.", role))
+		} else {
+			return t.reregisterCar(stub, username, args)
+		}
+
+	case "setTypeApproval":
+		if len(args) != 1 {
+			return shim.Error("'setTypeApproval' expects a type approval as json")
+		} else if role != "dot" {
+			return shim.Error(fmt.Sprintf("Sorry, role '%s' is not allowed to approve vehicle types.", role))
+		} else {
+			return t.setTypeApproval(stub, username, args)
+		}
+
+	case "removeTypeApproval":
+		if len(args) != 1 {
+			return shim.Error("'removeTypeApproval' expects a homologation number")
+		} else if role != "dot" {
+			return shim.Error(fmt.Sprintf("Sorry, role '%s' is not allowed to approve vehicle types.", role))
+		} else {
+			return t.removeTypeApproval(stub, args[0])
+		}
+
+	case "readTypeApprovals":
+		if role != "dot" && role != "garage" {
+			return shim.Error(fmt.Sprintf("Sorry, role '%s' is not allowed to read the type approval catalogue.", role))
+		}
+		return t.readTypeApprovals(stub)
+
+	case "deregister":
+		if len(args) < 1 || len(args) > 2 {
+			return shim.Error("'deregister' expects a car vin and optionally 'release' or 'retain' for the numberplate")
+		} else if len(args) == 2 && args[1] != "release" && args[1] != "retain" {
+			return shim.Error("'deregister' expects 'release' or 'retain' for the numberplate")
+		} else if role != "dot" {
+			return shim.Error(fmt.Sprintf("Sorry, role '%s' is not allowed to deregister cars.", role))
+		} else {
+			return t.deregisterCar(stub, username, args[0], len(args) == 2 && args[1] == "retain")
+		}
+
+	case "scrap":
+		if len(args) != 3 {
+			return shim.Error("'scrap' expects a car vin, a recycler and a certificate of destruction")
+		} else if role != "dot" {
+			return shim.Error(fmt.Sprintf("Sorry, role '%s' is not allowed to scrap cars.", role))
+		} else {
+			return t.scrapCar(stub, username, args)
+		}
+
+	case "export":
+		if len(args) != 2 {
+			return shim.Error("'export' expects a car vin and a destination country")
+		} else if role != "dot" {
+			return shim.Error(fmt.Sprintf("Sorry, role '%s' is not allowed to export cars.", role))
+		} else {
+			return t.exportCar(stub, username, args)
+		}
+
+	case "licenseRecycler":
+		if len(args) != 1 {
+			return shim.Error("'licenseRecycler' expects a recycler name")
+		} else if role != "dot" {
+			return shim.Error(fmt.Sprintf("Sorry, role '%s' is not allowed to license recyclers.", role))
+		} else {
+			return t.licenseRecycler(stub, username, args[0], true)
+		}
+
+	case "revokeRecyclerLicense":
+		if len(args) != 1 {
+			return shim.Error("'revokeRecyclerLicense' expects a recycler name")
+		} else if role != "dot" {
+			return shim.Error(fmt.Sprintf("Sorry, role '%s' is not allowed to license recyclers.", role))
+		} else {
+			return t.licenseRecycler(stub, username, args[0], false)
+		}
+
 	case "readRegistrationProposalsAsList":
 		if role != "dot" {
 			// only the DOT is allowed to read registration proposals
 			return shim.Error(fmt.Sprintf("Sorry, role '%s' is not allowed to read registration proposals.", role))
 		}
-		return t.readRegistrationProposalsList(stub)
+		return t.readRegistrationProposalsList(stub, username)
 
 	case "readRegistrationProposals":
 		if role != "dot" {
 			// only the DOT is allowed to read registration proposals
 			return shim.Error(fmt.Sprintf("Sorry, role '%s' is not allowed to read registration proposals.", role))
 		}
-		return t.readRegistrationProposals(stub)
+		return t.readRegistrationProposals(stub, username)
 
 	case "readRegistrationProposal":
-		if role != "dot" {
+		if len(args) != 1 {
+			return shim.Error("'readRegistrationProposal' expects a car vin")
+		} else if role == "user" || role == "garage" {
+			// owners can follow the status of their own proposals
+			if _, err := t.getCar(stub, username, args[0]); err != nil {
+				return shim.Error(err.Error())
+			}
+		} else if role != "dot" {
 			// only the DOT is allowed to read a registration proposal
 			return shim.Error(fmt.Sprintf("Sorry, role '%s' is not allowed to read registration proposals.", role))
 		}
 		return t.getRegistrationProposal(stub, args[0])
 
 	case "register":
-		if len(args) != 1 {
-			return shim.Error("'register' expects a car vin to register")
+		if len(args) < 1 || len(args) > 2 {
+			return shim.Error("'register' expects a car vin to register and optionally 'individual' for cars without type approval")
+		} else if len(args) == 2 && args[1] != "individual" {
+			return shim.Error("'register' expects 'individual' for cars without type approval")
 		} else if role != "dot" {
 			// only the DOT is allowed to register new cars
 			return shim.Error(fmt.Sprintf("Sorry, role '%s' is not allowed to register cars.", role))
 		} else {
-			return t.registerCar(stub, username, args[0])
+			return t.registerCar(stub, username, args[0], len(args) == 2)
+		}
+
+	case "rejectRegistrationProposal":
+		if len(args) != 2 {
+			return shim.Error("'rejectRegistrationProposal' expects a car vin and a reason")
+		} else if role != "dot" {
+			// only the DOT is allowed to reject registration proposals
+			return shim.Error(fmt.Sprintf("Sorry, role '%s' is not allowed to reject registration proposals.", role))
+		} else {
+			return t.rejectRegistrationProposal(stub, username, args)
 		}
 
 	case "confirm":
@@ -270,17 +609,98 @@ func (t *CarChaincode) Invoke(stub shim.ChaincodeStubInterface) pb.Response {
 			return t.confirmCar(stub, username, args)
 		}
 
+	case "confirmInterchangeable":
+		if len(args) != 2 {
+			return shim.Error("'confirmInterchangeable' expects a car vin and the numberplate of the other car")
+		} else if role != "dot" {
+			// only the DOT is allowed to confirm cars
+			return shim.Error(fmt.Sprintf("Sorry, role '%s' is not allowed to confirm cars.", role))
+		} else {
+			return t.confirmInterchangeable(stub, username, args)
+		}
+
+	case "readNumberplate":
+		if len(args) != 1 {
+			return shim.Error("'readNumberplate' expects a numberplate")
+		} else if role != "dot" {
+			return shim.Error(fmt.Sprintf("Sorry, role '%s' is not allowed to read numberplates.", role))
+		}
+		return t.readNumberplate(stub, args)
+
+	case "allocateNumberplate":
+		if len(args) < 1 || len(args) > 2 {
+			return shim.Error("'allocateNumberplate' expects a car vin and an optional canton")
+		} else if role != "dot" {
+			// only the DOT is allowed to confirm cars
+			return shim.Error(fmt.Sprintf("Sorry, role '%s' is not allowed to confirm cars.", role))
+		} else {
+			return t.allocateNumberplate(stub, username, args)
+		}
+
+	case "readNumberplateRanges":
+		if len(args) != 1 {
+			return shim.Error("'readNumberplateRanges' expects a canton")
+		} else if role != "dot" {
+			return shim.Error(fmt.Sprintf("Sorry, role '%s' is not allowed to query numberplate ranges.", role))
+		}
+		return t.readNumberplateRanges(stub, args)
+
 	case "getRevocationProposals":
 		if role != "dot" {
 			return shim.Error(fmt.Sprintf("Sorry, role '%s' is not allowed to query revocation proposals.", role))
 		}
 		return t.getRevocationProposals(stub)
 
+	case "readRevocationRequests":
+		if role != "dot" {
+			return shim.Error(fmt.Sprintf("Sorry, role '%s' is not allowed to query revocation proposals.", role))
+		}
+		return t.readRevocationRequests(stub)
+
+	case "processRevocationRequests":
+		if len(args) != 1 {
+			return shim.Error("'processRevocationRequests' expects a list of decisions as json")
+		} else if role != "dot" {
+			return shim.Error(fmt.Sprintf("Sorry, role '%s' is not allowed to revoke cars.", role))
+		} else {
+			return t.processRevocationRequests(stub, username, args)
+		}
+
 	case "getCarsToConfirmAsList":
 		if role != "dot" {
 			return shim.Error(fmt.Sprintf("Sorry, role '%s' is not allowed to query revocation proposals.", role))
 		}
-		return t.getCarsToConfirm(stub)
+		return t.getCarsToConfirm(stub, username)
+
+	case "setFeeSchedule":
+		if len(args) != 1 {
+			return shim.Error("'setFeeSchedule' expects a fee schedule as json")
+		} else if role != "dot" {
+			// only the DOT is allowed to set fees
+			return shim.Error(fmt.Sprintf("Sorry, role '%s' is not allowed to set fees.", role))
+		} else {
+			return t.setFeeSchedule(stub, args[0])
+		}
+
+	case "readTreasury":
+		if role != "dot" {
+			return shim.Error(fmt.Sprintf("Sorry, role '%s' is not allowed to read the treasury.", role))
+		}
+		return t.readUser(stub, treasuryUsername)
+
+	case "checkBalances":
+		if role != "dot" {
+			return shim.Error(fmt.Sprintf("Sorry, role '%s' is not allowed to check balances.", role))
+		}
+		return t.checkBalances(stub)
+
+	case "readStatistics":
+		if len(args) > 2 {
+			return shim.Error("'readStatistics' expects an optional start and end timestamp")
+		} else if role != "dot" {
+			return shim.Error(fmt.Sprintf("Sorry, role '%s' is not allowed to read statistics.", role))
+		}
+		return t.readStatistics(stub, args)
 
 	case "getAllCarsAsList":
 		if role != "dot" {
@@ -288,17 +708,145 @@ func (t *CarChaincode) Invoke(stub shim.ChaincodeStubInterface) pb.Response {
 		}
 		return t.getAllCars(stub)
 
+	case "certifyGarage":
+		if len(args) != 1 {
+			return shim.Error("'certifyGarage' expects a garage name")
+		} else if role != "dot" {
+			// only the DOT is allowed to certify garages
+			return shim.Error(fmt.Sprintf("Sorry, role '%s' is not allowed to certify garages.", role))
+		} else {
+			return t.certifyGarage(stub, username, args[0], true)
+		}
+
+	case "revokeGarageCertification":
+		if len(args) != 1 {
+			return shim.Error("'revokeGarageCertification' expects a garage name")
+		} else if role != "dot" {
+			return shim.Error(fmt.Sprintf("Sorry, role '%s' is not allowed to certify garages.", role))
+		} else {
+			return t.certifyGarage(stub, username, args[0], false)
+		}
+
+	case "recordInspection":
+		if len(args) != 2 {
+			return shim.Error("'recordInspection' expects a car vin and an inspection as json")
+		} else if role != "dot" && role != "garage" {
+			// only the DOT and certified garages inspect cars
+			return shim.Error(fmt.Sprintf("Sorry, role '%s' is not allowed to record inspections.", role))
+		} else {
+			return t.recordInspection(stub, username, role, args)
+		}
+
+	case "getOverdueCarsAsList":
+		if role != "dot" {
+			return shim.Error(fmt.Sprintf("Sorry, role '%s' is not allowed to query overdue cars.", role))
+		}
+		return t.getOverdueCars(stub)
+
+	case "readAccessLog":
+		if len(args) > 1 {
+			return shim.Error("'readAccessLog' expects an optional username")
+		} else if role != "dot" {
+			// only the DOT audits accesses to personal data
+			return shim.Error(fmt.Sprintf("Sorry, role '%s' is not allowed to read the access log.", role))
+		}
+		return t.readAccessLog(stub, args)
+
+	// POLICE FUNCTIONS
+	case "readCarByNumberplate":
+		if len(args) < 1 || len(args) > 2 {
+			return shim.Error("'readCarByNumberplate' expects a numberplate and an optional timestamp")
+		} else if role != "police" && role != "insurer" {
+			// only the police and insurers are allowed to resolve numberplates
+			return shim.Error(fmt.Sprintf("Sorry, role '%s' is not allowed to look up numberplates.", role))
+		} else {
+			return t.readCarByNumberplate(stub, username, role, args)
+		}
+
+	case "reportStolen":
+		if len(args) < 1 || len(args) > 2 {
+			return shim.Error("'reportStolen' expects a car vin and an optional police case number")
+		} else if role == "user" || role == "garage" || role == "police" {
+			// owners report their own cars, this is checked on the car
+			return t.reportTheft(stub, username, role, args, true)
+		} else {
+			return shim.Error(fmt.Sprintf("Sorry, role '%s' is not allowed to report stolen cars.", role))
+		}
+
+	case "reportRecovered":
+		if len(args) < 1 || len(args) > 2 {
+			return shim.Error("'reportRecovered' expects a car vin and an optional police case number")
+		} else if role == "user" || role == "garage" || role == "police" {
+			return t.reportTheft(stub, username, role, args, false)
+		} else {
+			return shim.Error(fmt.Sprintf("Sorry, role '%s' is not allowed to report recovered cars.", role))
+		}
+
+	case "getStolenCarsAsList":
+		if role != "police" && role != "dot" {
+			return shim.Error(fmt.Sprintf("Sorry, role '%s' is not allowed to query stolen cars.", role))
+		}
+		return t.getStolenCars(stub)
+
 	// INSURANCE FUNCTIONS
 	case "insuranceAccept":
-		if len(args) != 3 {
-			return shim.Error("'insuranceAccept' expects username to insure, a car vin and an insurance company")
+		if len(args) < 3 || len(args) > 4 {
+			return shim.Error("'insuranceAccept' expects username to insure, a car vin, an insurance company and optional policy terms")
 		} else if role != "insurer" {
 			// only insurers are allowed to create insurance contracts
 			return shim.Error(fmt.Sprintf("Sorry, role '%s' is not allowed to create an insurance proposal.", role))
+		} else if len(args) == 4 {
+			return t.insuranceAccept(stub, args[0], args[1], args[2], args[3])
+		} else {
+			return t.insuranceAccept(stub, args[0], args[1], args[2], "")
+		}
+
+	case "readPolicies":
+		if len(args) != 1 {
+			return shim.Error("'readPolicies' expects a car vin")
+		}
+		return t.readPolicies(stub, username, role, args[0])
+
+	case "readCurrentPolicy":
+		if len(args) != 1 {
+			return shim.Error("'readCurrentPolicy' expects a car vin")
+		}
+		return t.readCurrentPolicy(stub, username, role, args[0])
+
+	case "fileClaim":
+		if len(args) != 2 {
+			return shim.Error("'fileClaim' expects a car vin and the claim")
+		} else if role == "user" || role == "garage" {
+			// owner and keeper file claims, this is checked on the car
+			return t.fileClaim(stub, username, args)
 		} else {
-			return t.insuranceAccept(stub, args[0], args[1], args[2])
+			return shim.Error(fmt.Sprintf("Sorry, role '%s' is not allowed to file insurance claims.", role))
 		}
 
+	case "reviewClaim":
+		if len(args) != 3 {
+			return shim.Error("'reviewClaim' expects an insurance company name, a claim id and the decision")
+		} else if role != "insurer" {
+			return shim.Error(fmt.Sprintf("Sorry, role '%s' is not allowed to review insurance claims.", role))
+		} else {
+			return t.reviewClaim(stub, username, args)
+		}
+
+	case "readOpenClaims":
+		if len(args) != 1 {
+			return shim.Error("'readOpenClaims' expects an insurance company name")
+		} else if role != "insurer" {
+			return shim.Error(fmt.Sprintf("Sorry, role '%s' is not allowed to read open insurance claims.", role))
+		} else {
+			return t.readOpenClaims(stub, args[0])
+		}
+
+	case "readClaims":
+		if len(args) != 1 {
+			return shim.Error("'readClaims' expects a car vin")
+		}
+		return t.readClaims(stub, username, role, args[0])
+
 	case "getInsurer":
 		if len(args) != 1 {
 			return shim.Error("'getInsurer' expects an insurance company name")
@@ -309,6 +857,113 @@ func (t *CarChaincode) Invoke(stub shim.ChaincodeStubInterface) pb.Response {
 			return t.getInsurer(stub, args[0])
 		}
 
+	case "insuranceReject":
+		if len(args) != 4 {
+			return shim.Error("'insuranceReject' expects the applicant username, a car vin, an insurance company and a reason")
+		} else if role != "insurer" {
+			return shim.Error(fmt.Sprintf("Sorry, role '%s' is not allowed to reject insurance proposals.", role))
+		} else {
+			return t.insuranceReject(stub, username, args)
+		}
+
+	case "quoteProposal":
+		if len(args) != 4 {
+			return shim.Error("'quoteProposal' expects the applicant username, a car vin, an insurance company and the quotes")
+		} else if role != "insurer" {
+			return shim.Error(fmt.Sprintf("Sorry, role '%s' is not allowed to quote insurance proposals.", role))
+		} else {
+			return t.quoteProposal(stub, username, args)
+		}
+
+	case "bindQuote":
+		if len(args) != 3 {
+			return shim.Error("'bindQuote' expects a car vin, an insurance company and a quote id")
+		} else if role == "user" || role == "garage" {
+			// only the applicant can bind quotes, this is checked on the proposal
+			return t.bindQuote(stub, username, args)
+		} else {
+			return shim.Error(fmt.Sprintf("Sorry, role '%s' is not allowed to bind insurance quotes.", role))
+		}
+
+	case "expireInsureProposals":
+		if role != "insurer" && role != "dot" {
+			return shim.Error(fmt.Sprintf("Sorry, role '%s' is not allowed to expire insurance proposals.", role))
+		}
+		return t.expireInsureProposals(stub)
+
+	case "readInsureProposals":
+		return t.readInsureProposals(stub, username)
+
+	// BANK FUNCTIONS
+	case "deposit":
+		if len(args) != 3 {
+			return shim.Error("'deposit' expects a username, an amount and an external reference")
+		} else if role != "bank" {
+			// only banks are allowed to bring money into the system
+			return shim.Error(fmt.Sprintf("Sorry, role '%s' is not allowed to deposit money.", role))
+		} else {
+			return t.deposit(stub, username, args)
+		}
+
+	case "withdraw":
+		if len(args) != 3 {
+			return shim.Error("'withdraw' expects a username, an amount and an external reference")
+		} else if role != "bank" {
+			// only banks are allowed to pay out money
+			return shim.Error(fmt.Sprintf("Sorry, role '%s' is not allowed to withdraw money.", role))
+		} else {
+			return t.withdraw(stub, username, args)
+		}
+
+	// LENDER FUNCTIONS
+	case "registerLien":
+		if len(args) != 2 {
+			return shim.Error("'registerLien' expects a car vin and the financed amount")
+		} else if role != "lender" {
+			// only lenders are allowed to register liens
+			return shim.Error(fmt.Sprintf("Sorry, role '%s' is not allowed to register liens.", role))
+		} else {
+			return t.registerLien(stub, username, args)
+		}
+
+	case "releaseLien":
+		if len(args) != 1 {
+			return shim.Error("'releaseLien' expects a car vin")
+		} else if role != "lender" {
+			// only lenders are allowed to release liens
+			return shim.Error(fmt.Sprintf("Sorry, role '%s' is not allowed to release liens.", role))
+		} else {
+			return t.releaseLien(stub, username, args[0])
+		}
+
+	case "readLiens":
+		if len(args) > 1 {
+			return shim.Error("'readLiens' expects an optional car vin")
+		} else if role != "lender" && role != "dot" {
+			return shim.Error(fmt.Sprintf("Sorry, role '%s' is not allowed to read liens.", role))
+		} else {
+			return t.readLiens(stub, username, args)
+		}
+
+	case "acceptLien":
+		if len(args) != 1 {
+			return shim.Error("'acceptLien' expects a car vin")
+		} else if role == "user" || role == "garage" {
+			// owners accept liens on their own cars, this is checked on the lien
+			return t.acceptLien(stub, username, args[0])
+		} else {
+			return shim.Error(fmt.Sprintf("Sorry, role '%s' is not allowed to accept liens.", role))
+		}
+
+	case "declineLien":
+		if len(args) != 1 {
+			return shim.Error("'declineLien' expects a car vin")
+		} else if role == "user" || role == "garage" {
+			return t.declineLien(stub, username, args[0])
+		} else {
+			return shim.Error(fmt.Sprintf("Sorry, role '%s' is not allowed to decline liens.", role))
+		}
+
 	default:
 
 	}
@@ -0,0 +1,386 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// hex encoded SHA-256 hash of a claim document
+var documentHashPattern = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// sorts claims by their filing time, oldest first, then by id
+type claimsByAge []Claim
+
+func (c claimsByAge) Len() int      { return len(c) }
+func (c claimsByAge) Swap(i, j int) { c[i], c[j] = c[j], c[i] }
+func (c claimsByAge) Less(i, j int) bool {
+	if c[i].CreatedTs != c[j].CreatedTs {
+		return c[i].CreatedTs < c[j].CreatedTs
+	}
+	return c[i].Id < c[j].Id
+}
+
+/*
+ * Returns the name of the account of an insurance company.
+ */
+func insurerAccount(company string) string {
+	return insurerAccountPrefix + strings.ToLower(company)
+}
+
+/*
+ * Returns the account of an insurance company in 'users',
+ * the account is opened unless it exists already.
+ */
+func (t *CarChaincode) openInsurerAccount(stub shim.ChaincodeStubInterface, users map[string]*User, company string) (*User, error) {
+	account := insurerAccount(company)
+	if user, err := t.loadUser(stub, users, account); err == nil {
+		return user, nil
+	}
+
+	err := t.updateAccountIndex(stub, account, true)
+	if err != nil {
+		return nil, err
+	}
+
+	users[account] = &User{Name: account, Cars: []string{}, Balance: NewMoney(0), Offers: []Offer{}}
+	return users[account], nil
+}
+
+/*
+ * Returns the index of open claims.
+ */
+func (t *CarChaincode) getClaimIndex(stub shim.ChaincodeStubInterface) (map[string]Claim, error) {
+	response := t.read(stub, claimIndexStr)
+	claimIndex := make(map[string]Claim)
+	err := json.Unmarshal(response.Payload, &claimIndex)
+	if err != nil {
+		return nil, errors.New("Error parsing claim index")
+	}
+
+	return claimIndex, nil
+}
+
+/*
+ * Writes the index of open claims.
+ */
+func (t *CarChaincode) saveClaimIndex(stub shim.ChaincodeStubInterface, claimIndex map[string]Claim) error {
+	indexAsBytes, _ := json.Marshal(claimIndex)
+	err := stub.PutState(claimIndexStr, indexAsBytes)
+	if err != nil {
+		return errors.New("Error writing claim index")
+	}
+
+	return nil
+}
+
+/*
+ * Files an insurance claim.
+ *
+ * Only the owner or keeper of a car can file a claim.
+ * The car needs an active policy covering the incident,
+ * the claim is decided by the insurer of that policy.
+ *
+ * Arguments required:
+ * [0] Vin                  (string)
+ * [1] Claim                (string, json with incidentTs,
+ *                           description, estimatedDamage and documents)
+ *
+ * On success,
+ * returns the claim.
+ */
+func (t *CarChaincode) fileClaim(stub shim.ChaincodeStubInterface, username string, args []string) pb.Response {
+	vin := args[0]
+
+	claim := Claim{}
+	err := json.Unmarshal([]byte(args[1]), &claim)
+	if err != nil {
+		return shim.Error("Error parsing claim. Expecting Claim as json.")
+	}
+
+	car, err := t.getCarForPolicies(stub, username, "user", vin)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	now := txTimestamp(stub)
+	policy := CurrentPolicy(&car, now)
+	if policy == nil {
+		return shim.Error(fmt.Sprintf("Car with VIN '%s' has no active insurance policy", vin))
+	}
+
+	if claim.IncidentTs == 0 {
+		return shim.Error("A claim needs the date of the incident")
+	} else if claim.IncidentTs > now {
+		return shim.Error("The incident cannot be in the future")
+	} else if claim.IncidentTs < policy.StartTs {
+		return shim.Error(fmt.Sprintf("The incident happened before the start of policy '%s'", policy.Id))
+	}
+
+	if strings.TrimSpace(claim.Description) == "" {
+		return shim.Error("A claim needs a description of the incident")
+	} else if claim.EstimatedDamage.Amount <= 0 {
+		return shim.Error("The estimated damage has to be positive")
+	}
+
+	for i, document := range claim.Documents {
+		claim.Documents[i] = strings.ToLower(document)
+		if !documentHashPattern.MatchString(claim.Documents[i]) {
+			return shim.Error(fmt.Sprintf("Document '%s' is not a SHA-256 hash", document))
+		}
+	}
+
+	claim.Id = fmt.Sprintf("%s-%d", policy.Id, len(car.Claims)+1)
+	claim.PolicyId = policy.Id
+	claim.Insurer = policy.Insurer
+	claim.Claimant = username
+	claim.Vin = vin
+	claim.Status = "filed"
+	claim.Payout = Money{}
+	claim.Comment = ""
+	claim.ReviewedBy = ""
+	claim.ReviewedTs = 0
+	claim.TxId = stub.GetTxID()
+	claim.CreatedTs = now
+	car.Claims = append(car.Claims, claim)
+
+	claimIndex, err := t.getClaimIndex(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	claimIndex[claim.Id] = claim
+
+	carAsBytes, _ := json.Marshal(car)
+	err = stub.PutState(vin, carAsBytes)
+	if err != nil {
+		return shim.Error("Error writing car")
+	}
+
+	err = t.saveClaimIndex(stub, claimIndex)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	claimAsBytes, _ := json.Marshal(claim)
+	return shim.Success(claimAsBytes)
+}
+
+/*
+ * Decides an open claim.
+ *
+ * Insurers can take their own claims into review, approve
+ * them with a payout or reject them. Payouts are credited
+ * to the claimant and charged to the insurer account, they
+ * cannot exceed the estimated damage minus the deductible
+ * of the policy. The claimant is notified of approvals
+ * and rejections. Only insurer users of the company
+ * can decide claims.
+ *
+ * Arguments required:
+ * [0] Insurance company    (string)
+ * [1] Claim id             (string)
+ * [2] Decision             (string, ClaimDecision as json)
+ *
+ * On success,
+ * returns the claim.
+ */
+func (t *CarChaincode) reviewClaim(stub shim.ChaincodeStubInterface, username string, args []string) pb.Response {
+	company := strings.ToLower(args[0])
+
+	err := t.checkInsurer(stub, username, company)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	decision := ClaimDecision{}
+	err = json.Unmarshal([]byte(args[2]), &decision)
+	if err != nil {
+		return shim.Error("Error parsing decision. Expecting ClaimDecision as json.")
+	}
+
+	claimIndex, err := t.getClaimIndex(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	claim, open := claimIndex[args[1]]
+	if !open {
+		return shim.Error(fmt.Sprintf("There is no open claim '%s'", args[1]))
+	} else if claim.Insurer != company {
+		return shim.Error(fmt.Sprintf("Claim '%s' is not insured by '%s'", claim.Id, company))
+	}
+
+	car, err := t.getCarAsDot(stub, claim.Vin)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	users := make(map[string]*User)
+	switch decision.Decision {
+	case "review":
+		if claim.Status == "inReview" {
+			return shim.Error(fmt.Sprintf("Claim '%s' is already in review", claim.Id))
+		}
+		claim.Status = "inReview"
+	case "approve":
+		if decision.Payout.Amount <= 0 {
+			return shim.Error("Approvals need a positive payout")
+		}
+
+		// the insurer pays the damage above the deductible
+		limit := claim.EstimatedDamage
+		for _, policy := range car.Policies {
+			if policy.Id == claim.PolicyId {
+				limit, err = limit.Sub(policy.Deductible)
+				if err != nil {
+					return shim.Error(err.Error())
+				}
+			}
+		}
+		if !limit.Covers(decision.Payout) {
+			return shim.Error(fmt.Sprintf("The payout cannot exceed %s, the estimated damage minus the deductible", limit))
+		}
+
+		insurer, err := t.openInsurerAccount(stub, users, claim.Insurer)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+
+		claimant, err := t.loadUser(stub, users, claim.Claimant)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+
+		_, err = t.transfer(stub, insurer, claimant, decision.Payout, "claim", claim.Id)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		claim.Status = "approved"
+		claim.Payout = decision.Payout
+	case "reject":
+		if strings.TrimSpace(decision.Comment) == "" {
+			return shim.Error("Rejections need a comment")
+		}
+		claim.Status = "rejected"
+	default:
+		return shim.Error(fmt.Sprintf("Unknown decision '%s', expected 'review', 'approve' or 'reject'", decision.Decision))
+	}
+
+	claim.Comment = decision.Comment
+	claim.ReviewedBy = username
+	claim.ReviewedTs = txTimestamp(stub)
+
+	for i := range car.Claims {
+		if car.Claims[i].Id == claim.Id {
+			car.Claims[i] = claim
+		}
+	}
+
+	if claim.Status == "inReview" {
+		claimIndex[claim.Id] = claim
+	} else {
+		delete(claimIndex, claim.Id)
+
+		// the claimant gets the payout and the notification
+		// on the same user
+		t.notify(stub, users, claim.Claimant, Notification{
+			Type:    "claim",
+			Subject: claim.Id,
+			Status:  claim.Status,
+			Message: claim.Comment})
+	}
+
+	err = t.saveUsers(stub, users)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	carAsBytes, _ := json.Marshal(car)
+	err = stub.PutState(car.Vin, carAsBytes)
+	if err != nil {
+		return shim.Error("Error writing car")
+	}
+
+	err = t.saveClaimIndex(stub, claimIndex)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	claimAsBytes, _ := json.Marshal(claim)
+	return shim.Success(claimAsBytes)
+}
+
+/*
+ * Reads the open claims of an insurance company.
+ *
+ * On success,
+ * returns a list with claims, oldest first.
+ */
+func (t *CarChaincode) readOpenClaims(stub shim.ChaincodeStubInterface, company string) pb.Response {
+	company = strings.ToLower(company)
+
+	claimIndex, err := t.getClaimIndex(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	claims := []Claim{}
+	for _, claim := range claimIndex {
+		if claim.Insurer == company {
+			claims = append(claims, claim)
+		}
+	}
+	sort.Stable(claimsByAge(claims))
+
+	claimsAsBytes, _ := json.Marshal(claims)
+	return shim.Success(claimsAsBytes)
+}
+
+/*
+ * Reads all claims of a car.
+ *
+ * Besides owner, keeper, DOT and insurers, prospective
+ * buyers holding a selling offer for the car can read
+ * its claims.
+ *
+ * On success,
+ * returns a list with claims, oldest first.
+ */
+func (t *CarChaincode) readClaims(stub shim.ChaincodeStubInterface, username string, role string, vin string) pb.Response {
+	car, err := t.getCarForPolicies(stub, username, role, vin)
+	if err != nil {
+		user, userErr := t.getUser(stub, username)
+		if userErr != nil {
+			return shim.Error(err.Error())
+		}
+
+		prospective := false
+		for _, offer := range user.Offers {
+			if offer.Vin == vin {
+				prospective = true
+			}
+		}
+		if !prospective {
+			return shim.Error(err.Error())
+		}
+
+		car, err = t.getCarAsDot(stub, vin)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+
+	claims := car.Claims
+	if claims == nil {
+		claims = []Claim{}
+	}
+
+	claimsAsBytes, _ := json.Marshal(claims)
+	return shim.Success(claimsAsBytes)
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"encoding/json"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric/common/util"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+func TestInsuranceClaims(t *testing.T) {
+	username := "amag"
+	buyer := "bobby"
+	vin := "WVWZZZ6RZHY260780"
+	insuranceCompany := "axa"
+	document := "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"
+
+	// create and name a new chaincode mock
+	carChaincode := &CarChaincode{}
+	stub := shim.NewMockStub("car", carChaincode)
+
+	ccSetup(t, stub)
+
+	stub.MockInvoke(uuid, util.ToChaincodeArgs("create", username, "garage", `{ "vin": "`+vin+`" }`))
+	stub.MockInvoke(uuid, util.ToChaincodeArgs("createUser", buyer, "user", buyer))
+	stub.MockInvoke(uuid, util.ToChaincodeArgs("register", "dot-user", "dot", vin, "individual"))
+
+	incident := strconv.FormatInt(time.Now().Unix(), 10)
+	claimData := `{ "incidentTs": ` + incident + `, "description": "Rear-ended at a red light", "estimatedDamage": "2400.00 CHF", "documents": ["` + document + `"] }`
+
+	// claims need an active policy
+	response := stub.MockInvoke(uuid, util.ToChaincodeArgs("fileClaim", username, "garage", vin, claimData))
+	if response.Status != shim.ERROR {
+		t.Error("Uninsured cars should not have claims")
+	}
+
+	stub.MockInvoke(uuid, util.ToChaincodeArgs("insureProposal", username, "garage", vin, insuranceCompany))
+	stub.MockInvoke(uuid, util.ToChaincodeArgs("insuranceAccept", "insurance-user", "insurer", username, vin, insuranceCompany, `{ "deductible": "400.00 CHF" }`))
+
+	// documents have to be hashes
+	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("fileClaim", username, "garage", vin, `{ "incidentTs": `+incident+`, "description": "Hail", "estimatedDamage": "100 CHF", "documents": ["photo.jpg"] }`))
+	if response.Status != shim.ERROR {
+		t.Error("Documents should be referenced by their hash")
+	}
+
+	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("fileClaim", buyer, "user", vin, claimData))
+	if response.Status != shim.ERROR {
+		t.Error("Only owner and keeper should file claims")
+	}
+
+	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("fileClaim", username, "garage", vin, claimData))
+	claim := Claim{}
+	err := json.Unmarshal(response.Payload, &claim)
+	if err != nil {
+		t.Error(response.Message)
+		return
+	}
+
+	if claim.Status != "filed" || claim.Insurer != insuranceCompany || claim.Claimant != username {
+		t.Errorf("Claim filed with wrong data: %v", claim)
+	}
+
+	// the insurer sees the open claim
+	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("readOpenClaims", "insurance-user", "insurer", insuranceCompany))
+	var claims []Claim
+	json.Unmarshal(response.Payload, &claims)
+	if len(claims) != 1 || claims[0].Id != claim.Id {
+		t.Error("Open claim missing for the insurer")
+	}
+
+	// only the insurer of the claim decides it
+	stub.MockInvoke(uuid, util.ToChaincodeArgs("assignInsurer", "dot-user", "dot", "zurich-user", "zurich"))
+	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("reviewClaim", "zurich-user", "insurer", "zurich", claim.Id, `{ "decision": "reject", "comment": "Not ours" }`))
+	if response.Status != shim.ERROR {
+		t.Error("Another insurer should not decide the claim")
+	}
+
+	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("reviewClaim", "zurich-user", "insurer", insuranceCompany, claim.Id, `{ "decision": "reject", "comment": "Not ours" }`))
+	if response.Status != shim.ERROR {
+		t.Error("Insurer users of another company should not decide the claim")
+	}
+	stub.MockInvoke(uuid, util.ToChaincodeArgs("assignInsurer", "dot-user", "dot", "insurance-user", insuranceCompany))
+
+	// review and approve the claim with a payout
+	stub.MockInvoke(uuid, util.ToChaincodeArgs("reviewClaim", "insurance-user", "insurer", insuranceCompany, claim.Id, `{ "decision": "review" }`))
+	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("reviewClaim", "insurance-user", "insurer", insuranceCompany, claim.Id, `{ "decision": "approve", "payout": "2000.05 CHF" }`))
+	if response.Status != shim.ERROR {
+		t.Error("Payouts above the damage minus the deductible should be refused")
+	}
+
+	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("reviewClaim", "insurance-user", "insurer", insuranceCompany, claim.Id, `{ "decision": "approve", "payout": "2000.00 CHF", "comment": "Deductible of 400 CHF" }`))
+	err = json.Unmarshal(response.Payload, &claim)
+	if err != nil {
+		t.Error(response.Message)
+		return
+	}
+
+	if claim.Status != "approved" || claim.ReviewedBy != "insurance-user" {
+		t.Errorf("Claim not approved: %v", claim)
+	}
+
+	user, _ := carChaincode.getUser(stub, username)
+	if user.Balance.String() != "2000.00 CHF" {
+		t.Errorf("Payout not credited, balance is %s", user.Balance)
+	}
+
+	insurer, _ := carChaincode.getUser(stub, insurerAccount(insuranceCompany))
+	if insurer.Balance.String() != "-2000.00 CHF" {
+		t.Errorf("Payout not charged to the insurer, balance is %s", insurer.Balance)
+	}
+
+	if len(user.Notifications) != 1 || user.Notifications[0].Status != "approved" {
+		t.Error("Claimant not notified")
+	}
+
+	// decided claims cannot be reviewed again
+	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("reviewClaim", "insurance-user", "insurer", insuranceCompany, claim.Id, `{ "decision": "reject", "comment": "Changed our mind" }`))
+	if response.Status != shim.ERROR {
+		t.Error("Decided claims should not be reviewed again")
+	}
+
+	// prospective buyers see the claims of the car
+	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("readClaims", buyer, "user", vin))
+	if response.Status != shim.ERROR {
+		t.Error("Claims should only be visible with a selling offer")
+	}
+
+	stub.MockInvoke(uuid, util.ToChaincodeArgs("createSellingOffer", username, "garage", "1000", vin, buyer))
+	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("readClaims", buyer, "user", vin))
+	claims = nil
+	json.Unmarshal(response.Payload, &claims)
+	if len(claims) != 1 || claims[0].Status != "approved" {
+		t.Error("Prospective buyer should see the claim history")
+	}
+}
+
+func TestApproveClaimOnPeer(t *testing.T) {
+	username := "amag"
+	vin := "WVWZZZ6RZHY260780"
+	insuranceCompany := "axa"
+
+	// writes only show up in later transactions
+	stub := newPeerStub(t)
+
+	stub.invoke("tx1", "create", username, "garage", `{ "vin": "`+vin+`" }`)
+	stub.invoke("tx2", "register", "dot-user", "dot", vin, "individual")
+	stub.invoke("tx3", "insureProposal", username, "garage", vin, insuranceCompany)
+	stub.invoke("tx4", "insuranceAccept", "insurance-user", "insurer", username, vin, insuranceCompany)
+	stub.invoke("tx5", "assignInsurer", "dot-user", "dot", "insurance-user", insuranceCompany)
+
+	incident := strconv.FormatInt(time.Now().Unix(), 10)
+	response := stub.invoke("tx6", "fileClaim", username, "garage", vin, `{ "incidentTs": `+incident+`, "description": "Hail", "estimatedDamage": "800.00 CHF" }`)
+	claim := Claim{}
+	err := json.Unmarshal(response.Payload, &claim)
+	if err != nil {
+		t.Error(response.Message)
+		return
+	}
+
+	response = stub.invoke("tx7", "reviewClaim", "insurance-user", "insurer", insuranceCompany, claim.Id, `{ "decision": "approve", "payout": "500.00 CHF" }`)
+	if response.Status != shim.OK {
+		t.Error(response.Message)
+		return
+	}
+
+	// payout and notification both stick
+	user, _ := stub.cc.getUser(stub, username)
+	if user.Balance.String() != "500.00 CHF" {
+		t.Errorf("Payout not credited, balance is %s", user.Balance)
+	}
+	if len(user.Notifications) != 1 || user.Notifications[0].Status != "approved" {
+		t.Errorf("Claimant not notified: %v", user.Notifications)
+	}
+}
@@ -0,0 +1,109 @@
+/*
+ * Converts an account statement to CSV for bookkeeping.
+ *
+ * Reads the json payload of 'readStatement' from a file
+ * or from stdin and writes the statement lines as CSV
+ * to stdout, framed by the opening and closing balance:
+ *
+ *   peer chaincode query ... '{"Args":["readStatement", "bobby", "user"]}' \
+ *     | go run cmd/statement2csv/main.go > statement.csv
+ */
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/car_cc/iso4217"
+)
+
+// mirrors the statement of the car chaincode
+type money struct {
+	Amount   int64  `json:"amount"`
+	Currency string `json:"currency"`
+}
+
+type statementLine struct {
+	CreatedTs    int64  `json:"createdTs"`
+	TxId         string `json:"txId"`
+	Reason       string `json:"reason"`
+	Reference    string `json:"reference"`
+	Counterparty string `json:"counterparty"`
+	Amount       money  `json:"amount"`
+	Balance      money  `json:"balance"`
+}
+
+type statement struct {
+	Account        string          `json:"account"`
+	From           int64           `json:"from"`
+	To             int64           `json:"to"`
+	OpeningBalance money           `json:"openingBalance"`
+	ClosingBalance money           `json:"closingBalance"`
+	Lines          []statementLine `json:"lines"`
+}
+
+/*
+ * Formats an amount in major units without currency, e.g. '-12.50'
+ */
+func (m money) decimal() string {
+	return iso4217.Format(m.Amount, m.Currency)
+}
+
+func date(ts int64) string {
+	return time.Unix(ts, 0).UTC().Format("2006-01-02 15:04:05")
+}
+
+/*
+ * Writes a statement read as json to the output as CSV
+ */
+func convert(input io.Reader, output io.Writer) error {
+	var s statement
+	err := json.NewDecoder(input).Decode(&s)
+	if err != nil {
+		return fmt.Errorf("Error parsing statement: %s", err)
+	}
+
+	out := csv.NewWriter(output)
+	out.Write([]string{"date", "transaction", "reason", "reference", "counterparty", "amount", "balance", "currency"})
+	out.Write([]string{date(s.From), "", "opening balance", s.Account, "", "", s.OpeningBalance.decimal(), s.OpeningBalance.Currency})
+
+	for _, line := range s.Lines {
+		out.Write([]string{
+			date(line.CreatedTs),
+			line.TxId,
+			line.Reason,
+			line.Reference,
+			line.Counterparty,
+			line.Amount.decimal(),
+			line.Balance.decimal(),
+			line.Amount.Currency})
+	}
+
+	out.Write([]string{date(s.To), "", "closing balance", s.Account, "", "", s.ClosingBalance.decimal(), s.ClosingBalance.Currency})
+	out.Flush()
+
+	return out.Error()
+}
+
+func main() {
+	var input io.Reader = os.Stdin
+	if len(os.Args) > 1 {
+		file, err := os.Open(os.Args[1])
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		defer file.Close()
+		input = file
+	}
+
+	err := convert(input, os.Stdout)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
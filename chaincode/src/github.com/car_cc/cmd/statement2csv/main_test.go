@@ -0,0 +1,61 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// rewrites the golden files with the current output
+var update = flag.Bool("update", false, "update the golden files")
+
+func TestConvertGolden(t *testing.T) {
+	statements, err := filepath.Glob(filepath.Join("testdata", "*.json"))
+	if err != nil || len(statements) == 0 {
+		t.Fatal("No statements in testdata")
+	}
+
+	for _, statement := range statements {
+		golden := strings.TrimSuffix(statement, ".json") + ".csv"
+
+		input, err := os.Open(statement)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var output bytes.Buffer
+		err = convert(input, &output)
+		input.Close()
+		if err != nil {
+			t.Errorf("Error converting '%s': %s", statement, err)
+			continue
+		}
+
+		if *update {
+			err = ioutil.WriteFile(golden, output.Bytes(), 0644)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		expected, err := ioutil.ReadFile(golden)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !bytes.Equal(output.Bytes(), expected) {
+			t.Errorf("Output of '%s' differs from '%s':\n%s", statement, golden, output.String())
+		}
+	}
+}
+
+func TestConvertInvalidStatement(t *testing.T) {
+	err := convert(strings.NewReader(`{ "lines": 5 }`), ioutil.Discard)
+	if err == nil {
+		t.Error("Invalid statements should not be converted")
+	}
+}
@@ -0,0 +1,266 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+/*
+ * Returns the recyclers licensed to scrap cars.
+ */
+func (t *CarChaincode) getLicensedRecyclers(stub shim.ChaincodeStubInterface) (map[string]string, error) {
+	response := t.read(stub, licensedRecyclerIndexStr)
+	recyclerIndex := make(map[string]string)
+	err := json.Unmarshal(response.Payload, &recyclerIndex)
+	if err != nil {
+		return nil, errors.New("Error parsing licensed recycler index")
+	}
+
+	return recyclerIndex, nil
+}
+
+/*
+ * Licenses a recycler to scrap cars
+ * or withdraws the license.
+ *
+ * On success,
+ * returns the licensed recycler index.
+ */
+func (t *CarChaincode) licenseRecycler(stub shim.ChaincodeStubInterface, username string, recycler string, licensed bool) pb.Response {
+	if recycler == "" {
+		return shim.Error("'licenseRecycler' expects a non-empty recycler name")
+	}
+
+	recyclerIndex, err := t.getLicensedRecyclers(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	if licensed {
+		// remember which DOT user licensed the recycler
+		recyclerIndex[recycler] = username
+	} else if _, exists := recyclerIndex[recycler]; !exists {
+		return shim.Error(fmt.Sprintf("Recycler '%s' is not licensed", recycler))
+	} else {
+		delete(recyclerIndex, recycler)
+	}
+
+	indexAsBytes, _ := json.Marshal(recyclerIndex)
+	err = stub.PutState(licensedRecyclerIndexStr, indexAsBytes)
+	if err != nil {
+		return shim.Error("Error writing licensed recycler index")
+	}
+
+	return shim.Success(indexAsBytes)
+}
+
+/*
+ * Moves a car between the active and the former
+ * cars of its owner.
+ */
+func (t *CarChaincode) setCarActive(stub shim.ChaincodeStubInterface, users map[string]*User, vin string, active bool) error {
+	owner, err := t.getOwner(stub, vin)
+	if err != nil {
+		return err
+	}
+
+	user, err := t.loadUser(stub, users, owner)
+	if err != nil {
+		return err
+	}
+
+	user.Cars = removeVin(user.Cars, vin)
+	user.FormerCars = removeVin(user.FormerCars, vin)
+	if active {
+		user.Cars = append(user.Cars, vin)
+	} else {
+		user.FormerCars = append(user.FormerCars, vin)
+	}
+
+	return nil
+}
+
+/*
+ * Returns the list of VINs without 'vin'.
+ */
+func removeVin(vins []string, vin string) []string {
+	var remaining []string
+	for _, v := range vins {
+		if v != vin {
+			remaining = append(remaining, v)
+		}
+	}
+
+	return remaining
+}
+
+/*
+ * Takes a car off the road and records the disposal.
+ *
+ * The insurance contract ends and the numberplate is
+ * released, pending insurance and revocation proposals
+ * are dropped. Cars are deregistered before they are
+ * scrapped or exported. The car stays on the ledger,
+ * but leaves the active cars of its owner.
+ *
+ * On success,
+ * returns the car.
+ */
+func (t *CarChaincode) disposeCar(stub shim.ChaincodeStubInterface, username string, vin string, disposal Disposal, status string, retain bool) pb.Response {
+	car, err := t.getCarAsDot(stub, vin)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	err = t.checkAuthority(stub, username, &car)
+	if err != nil {
+		return shim.Error(err.Error())
+	} else if !IsRegistered(&car) {
+		return shim.Error("Only registered cars can be taken off the road")
+	} else if IsStolen(&car) {
+		return shim.Error(fmt.Sprintf("Car with VIN '%s' is reported stolen", vin))
+	} else if status != "deregistered" && HasActiveLien(&car) {
+		return shim.Error("The car has an active lien. The lien has to be released before the car can be " + status + ".")
+	}
+
+	// scrapping and export include the deregistration
+	if status == "deregistered" || CarStatus(&car) != "deregistered" {
+		err = transitionCar(stub, &car, "deregistered", username, "deregister")
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+
+	if status != "deregistered" {
+		err = transitionCar(stub, &car, status, username, disposal.Type)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+
+	// end the insurance contract
+	car.Certificate.Insurer = ""
+	cancelPolicies(&car, txTimestamp(stub))
+	users := make(map[string]*User)
+	err = t.clearInsureProposals(stub, users, vin, "The car was "+status)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	err = t.closeRevocationRequest(stub, users, vin, "approved", "The car was "+status)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// remove numberplate, only deregistered
+	// cars may retain it for their holder
+	err = t.releaseNumberplate(stub, &car, retain)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	disposal.By = username
+	disposal.TxId = stub.GetTxID()
+	disposal.CreatedTs = txTimestamp(stub)
+	car.Disposals = append(car.Disposals, disposal)
+
+	err = t.saveCar(stub, car)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	err = t.setCarActive(stub, users, vin, false)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	err = t.saveUsers(stub, users)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	carAsBytes, _ := json.Marshal(car)
+	return shim.Success(carAsBytes)
+}
+
+/*
+ * Deregisters a car temporarily.
+ *
+ * The car can be insured and confirmed again later.
+ * The numberplate is released or retained for its holder.
+ *
+ * On success,
+ * returns the car.
+ */
+func (t *CarChaincode) deregisterCar(stub shim.ChaincodeStubInterface, username string, vin string, retain bool) pb.Response {
+	disposal := Disposal{Type: "deregistration"}
+	return t.disposeCar(stub, username, vin, disposal, "deregistered", retain)
+}
+
+/*
+ * Scraps a car for good.
+ *
+ * Requires the certificate of destruction
+ * issued by a licensed recycler.
+ *
+ * Arguments required:
+ * [0] Vin                  (string)
+ * [1] Recycler             (string)
+ * [2] Certificate          (string, certificate of destruction)
+ *
+ * On success,
+ * returns the car.
+ */
+func (t *CarChaincode) scrapCar(stub shim.ChaincodeStubInterface, username string, args []string) pb.Response {
+	vin := args[0]
+	recycler := args[1]
+	certificate := args[2]
+
+	if certificate == "" {
+		return shim.Error("'scrap' expects the certificate of destruction")
+	}
+
+	recyclerIndex, err := t.getLicensedRecyclers(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	} else if _, licensed := recyclerIndex[recycler]; !licensed {
+		return shim.Error(fmt.Sprintf("Recycler '%s' is not licensed to scrap cars", recycler))
+	}
+
+	disposal := Disposal{
+		Type:        "scrapping",
+		Recycler:    recycler,
+		Certificate: certificate}
+	return t.disposeCar(stub, username, vin, disposal, "scrapped", false)
+}
+
+/*
+ * Exports a car to another country for good.
+ *
+ * Arguments required:
+ * [0] Vin                  (string)
+ * [1] Country              (string, ISO 3166 code, e.g. 'DE')
+ *
+ * On success,
+ * returns the car.
+ */
+func (t *CarChaincode) exportCar(stub shim.ChaincodeStubInterface, username string, args []string) pb.Response {
+	vin := args[0]
+	country := strings.ToUpper(args[1])
+
+	if len(country) != 2 || strings.Trim(country, "ABCDEFGHIJKLMNOPQRSTUVWXYZ") != "" {
+		return shim.Error(fmt.Sprintf("'%s' is not a valid country code, expected e.g. 'DE'", args[1]))
+	} else if country == "CH" {
+		return shim.Error("Cars cannot be exported to their country of registration")
+	}
+
+	disposal := Disposal{
+		Type:    "export",
+		Country: country}
+	return t.disposeCar(stub, username, vin, disposal, "exported", false)
+}
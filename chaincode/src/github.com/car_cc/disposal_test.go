@@ -0,0 +1,153 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric/common/util"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+func TestDeregisterAndScrapCar(t *testing.T) {
+	username := "amag"
+	vin := "WVWZZZ6RZHY260780"
+	numberplate := "ZH 7878"
+	insuranceCompany := "axa"
+
+	// create and name a new chaincode mock
+	carChaincode := &CarChaincode{}
+	stub := shim.NewMockStub("car", carChaincode)
+
+	ccSetup(t, stub)
+
+	stub.MockInvoke(uuid, util.ToChaincodeArgs("create", username, "garage", `{ "vin": "`+vin+`" }`))
+	stub.MockInvoke(uuid, util.ToChaincodeArgs("register", "dot-user", "dot", vin, "individual"))
+	stub.MockInvoke(uuid, util.ToChaincodeArgs("insureProposal", username, "user", vin, insuranceCompany))
+	stub.MockInvoke(uuid, util.ToChaincodeArgs("insuranceAccept", "insurance-user", "insurer", username, vin, insuranceCompany))
+	stub.MockInvoke(uuid, util.ToChaincodeArgs("confirm", "dot-user", "dot", vin, numberplate))
+
+	// a confirmed car is taken off the road
+	response := stub.MockInvoke(uuid, util.ToChaincodeArgs("deregister", "dot-user", "dot", vin, "retain"))
+	car := Car{}
+	err := json.Unmarshal(response.Payload, &car)
+	if err != nil {
+		t.Error(response.Message)
+		return
+	}
+
+	if car.Status != "deregistered" || car.Certificate.Insurer != "" || car.Certificate.Numberplate != "" {
+		t.Error("Deregistration includes the insurance contract and the numberplate")
+	} else if len(car.Disposals) != 1 || car.Disposals[0].Type != "deregistration" {
+		t.Error("Deregistration not recorded")
+	}
+
+	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("readUser", username, "user", username))
+	user := User{}
+	json.Unmarshal(response.Payload, &user)
+	if len(user.Cars) != 0 || len(user.FormerCars) != 1 {
+		t.Error("Deregistered car should leave the active cars of the owner")
+	}
+
+	// the retained plate comes back with the insurance
+	stub.MockInvoke(uuid, util.ToChaincodeArgs("insureProposal", username, "user", vin, insuranceCompany))
+	stub.MockInvoke(uuid, util.ToChaincodeArgs("insuranceAccept", "insurance-user", "insurer", username, vin, insuranceCompany))
+	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("confirm", "dot-user", "dot", vin, numberplate))
+	if response.Status == shim.ERROR {
+		t.Error(response.Message)
+	}
+
+	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("readUser", username, "user", username))
+	user = User{}
+	json.Unmarshal(response.Payload, &user)
+	if len(user.Cars) != 1 || len(user.FormerCars) != 0 {
+		t.Error("Insured car should return to the active cars of the owner")
+	}
+
+	// scrapping needs a licensed recycler
+	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("scrap", "dot-user", "dot", vin, "thommen", "CD-4711"))
+	if response.Status != shim.ERROR {
+		t.Error("Scrapping by an unlicensed recycler should not be possible")
+	}
+
+	stub.MockInvoke(uuid, util.ToChaincodeArgs("licenseRecycler", "dot-user", "dot", "thommen"))
+	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("scrap", "dot-user", "dot", vin, "thommen", "CD-4711"))
+	car = Car{}
+	err = json.Unmarshal(response.Payload, &car)
+	if err != nil {
+		t.Error(response.Message)
+		return
+	}
+
+	if car.Status != "scrapped" || car.Disposals[1].Certificate != "CD-4711" || car.Disposals[1].Recycler != "thommen" {
+		t.Error("Scrapping not recorded")
+	}
+
+	// the numberplate of a scrapped car returns to the pool
+	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("readNumberplate", "dot-user", "dot", numberplate))
+	plate := Numberplate{}
+	json.Unmarshal(response.Payload, &plate)
+	if IsTaken(&plate, time.Now().Unix()) || IsRetained(&plate, time.Now().Unix()) {
+		t.Error("Numberplate of scrapped car not released")
+	}
+
+	// scrapped cars are gone for good
+	blocked := map[string][]string{
+		"insureProposal": {"insureProposal", username, "user", vin, insuranceCompany},
+		"deregister":     {"deregister", "dot-user", "dot", vin},
+		"export":         {"export", "dot-user", "dot", vin, "DE"},
+		"setKeeper":      {"setKeeper", username, "user", vin, "dot-user"},
+	}
+	for function, args := range blocked {
+		response = stub.MockInvoke(uuid, util.ToChaincodeArgs(args...))
+		if response.Status != shim.ERROR {
+			t.Errorf("'%s' should refuse scrapped cars", function)
+		}
+	}
+}
+
+func TestExportCar(t *testing.T) {
+	username := "amag"
+	vin := "WVWZZZ6RZHY260780"
+
+	// create and name a new chaincode mock
+	carChaincode := &CarChaincode{}
+	stub := shim.NewMockStub("car", carChaincode)
+
+	ccSetup(t, stub)
+
+	stub.MockInvoke(uuid, util.ToChaincodeArgs("create", username, "garage", `{ "vin": "`+vin+`" }`))
+
+	// unregistered cars cannot be exported
+	response := stub.MockInvoke(uuid, util.ToChaincodeArgs("export", "dot-user", "dot", vin, "DE"))
+	if response.Status != shim.ERROR {
+		t.Error("Exporting an unregistered car should not be possible")
+	}
+
+	stub.MockInvoke(uuid, util.ToChaincodeArgs("register", "dot-user", "dot", vin, "individual"))
+
+	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("export", "dot-user", "dot", vin, "CH"))
+	if response.Status != shim.ERROR {
+		t.Error("Exporting to the country of registration should not be possible")
+	}
+
+	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("export", "dot-user", "dot", vin, "de"))
+	car := Car{}
+	err := json.Unmarshal(response.Payload, &car)
+	if err != nil {
+		t.Error(response.Message)
+		return
+	}
+
+	// the export includes the deregistration
+	last := len(car.Transitions) - 1
+	if car.Status != "exported" || car.Transitions[last-1].To != "deregistered" || car.Disposals[0].Country != "DE" {
+		t.Error("Export not recorded")
+	}
+
+	// the car stays on the ledger
+	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("readCar", "dot-user", "dot", vin))
+	if response.Status == shim.ERROR {
+		t.Error("Exported car should stay on the ledger")
+	}
+}
@@ -4,6 +4,8 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"sort"
+	"strings"
 
 	"github.com/hyperledger/fabric/core/chaincode/shim"
 	pb "github.com/hyperledger/fabric/protos/peer"
@@ -13,15 +15,22 @@ import (
  * Checks the car numberplate.
  *
  * The numberplate is handed out by the DOT.
+ * Cars with an overdue inspection are suspended
+ * and do not count as confirmed.
  */
-func IsConfirmed(car *Car) bool {
+func IsConfirmed(car *Car, ts int64) bool {
 	// cannot have a numberplate without car papers
 	if !IsRegistered(car) {
 		return false
 	}
 
 	// cannot give you a numberplate without insurance contract
-	if !IsInsured(car) {
+	if !IsInsured(car, ts) {
+		return false
+	}
+
+	// cannot drive without passing the periodic inspection
+	if IsInspectionOverdue(car, ts) {
 		return false
 	}
 
@@ -37,6 +46,17 @@ func IsConfirmed(car *Car) bool {
 	return confirmed
 }
 
+/*
+ * Checks if a car still carries its numberplate.
+ *
+ * Unlike 'IsConfirmed', this holds for cars with a lapsed
+ * insurance policy or an overdue inspection too. The numberplate is bound to the
+ * keeper and has to be revoked before the car changes hands.
+ */
+func HasNumberplate(car *Car) bool {
+	return car.Certificate.Numberplate != "" || CarStatus(car) == "confirmed"
+}
+
 /*
  * Checks for a valid car VIN.
  *
@@ -81,12 +101,96 @@ func (t *CarChaincode) getRegistrationProposals(stub shim.ChaincodeStubInterface
 }
 
 /*
- * Reads all registration proposals.
+ * Saves the registration proposal index.
+ */
+func (t *CarChaincode) saveRegistrationProposals(stub shim.ChaincodeStubInterface, proposalIndex map[string]RegistrationProposal) error {
+	indexAsBytes, _ := json.Marshal(proposalIndex)
+	err := stub.PutState(registrationProposalIndexStr, indexAsBytes)
+	if err != nil {
+		return errors.New("Error writing registration proposal index")
+	}
+
+	return nil
+}
+
+/*
+ * Checks if a registration proposal waits for a DOT decision.
+ *
+ * Proposals created before the proposal lifecycle
+ * was introduced have no status and count as pending.
+ */
+func IsPending(proposal *RegistrationProposal) bool {
+	return proposal.Status == "" || proposal.Status == "pending"
+}
+
+/*
+ * Changes the status of a registration proposal
+ * and records the decision in the proposal history.
  */
-func (t *CarChaincode) readRegistrationProposals(stub shim.ChaincodeStubInterface) pb.Response {
+func decideRegistrationProposal(stub shim.ChaincodeStubInterface, proposal *RegistrationProposal, status string, by string, reason string) {
+	proposal.Status = status
+	proposal.Reason = reason
+	proposal.History = append(proposal.History, ProposalDecision{
+		ProposalId: proposal.Id,
+		Status:     status,
+		By:         by,
+		Reason:     reason,
+		TxId:       stub.GetTxID(),
+		CreatedTs:  txTimestamp(stub)})
+}
+
+/*
+ * Returns the registration proposals
+ * waiting for a DOT decision.
+ */
+func (t *CarChaincode) getPendingRegistrationProposals(stub shim.ChaincodeStubInterface) (map[string]RegistrationProposal, error) {
 	proposalIndex, err := t.getRegistrationProposals(stub)
 	if err != nil {
-		return shim.Error("Error reading registration proposal index")
+		return nil, err
+	}
+
+	pending := make(map[string]RegistrationProposal)
+	for vin, proposal := range proposalIndex {
+		if IsPending(&proposal) {
+			pending[vin] = proposal
+		}
+	}
+
+	return pending, nil
+}
+
+/*
+ * Returns the pending registration proposals
+ * a DOT user is in charge of.
+ */
+func (t *CarChaincode) getRegistrationQueue(stub shim.ChaincodeStubInterface, username string) (map[string]RegistrationProposal, error) {
+	authority, err := t.getAuthority(stub, username)
+	if err != nil {
+		return nil, err
+	}
+
+	proposalIndex, err := t.getPendingRegistrationProposals(stub)
+	if err != nil {
+		return nil, errors.New("Error reading registration proposal index")
+	}
+
+	for vin, proposal := range proposalIndex {
+		if !inJurisdiction(authority, proposal.Canton) {
+			delete(proposalIndex, vin)
+		}
+	}
+
+	return proposalIndex, nil
+}
+
+/*
+ * Reads all pending registration proposals
+ * of the DOT user's authority.
+ */
+func (t *CarChaincode) readRegistrationProposals(stub shim.ChaincodeStubInterface, username string) pb.Response {
+	proposalIndex, err := t.getRegistrationQueue(stub, username)
+	if err != nil {
+		return shim.Error(err.Error())
 	}
 
 	indexAsBytes, _ := json.Marshal(proposalIndex)
@@ -94,12 +198,13 @@ func (t *CarChaincode) readRegistrationProposals(stub shim.ChaincodeStubInterfac
 }
 
 /*
- * Reads all registration proposals and returns them as an array
+ * Reads all pending registration proposals of the
+ * DOT user's authority and returns them as an array
  */
-func (t *CarChaincode) readRegistrationProposalsList(stub shim.ChaincodeStubInterface) pb.Response {
-	proposalIndex, err := t.getRegistrationProposals(stub)
+func (t *CarChaincode) readRegistrationProposalsList(stub shim.ChaincodeStubInterface, username string) pb.Response {
+	proposalIndex, err := t.getRegistrationQueue(stub, username)
 	if err != nil {
-		return shim.Error("Error reading registration proposal index")
+		return shim.Error(err.Error())
 	}
 	var registrationProposalList []RegistrationProposal
 
@@ -112,7 +217,8 @@ func (t *CarChaincode) readRegistrationProposalsList(stub shim.ChaincodeStubInte
 }
 
 /*
- * Returns a registration proposal for a car.
+ * Returns a registration proposal for a car,
+ * regardless of its status.
  */
 func (t *CarChaincode) getRegistrationProposal(stub shim.ChaincodeStubInterface, car string) pb.Response {
 	// load all proposals
@@ -132,19 +238,24 @@ func (t *CarChaincode) getRegistrationProposal(stub shim.ChaincodeStubInterface,
  * Registration guarantees that certificate VIN
  * and a car VIN are equal and that a certificate
  * was issued by the DOT at least once.
+ * The owner is charged the registration fee.
+ *
+ * To registerCar a car, a pending RegistrationProposal needs to be
+ * present. The proposal is approved on successfull registration
+ * and stays on the ledger with its decision history.
+ * Proposals with a homologation number have to match
+ * the approved vehicle type of the catalogue, proposals
+ * without one need an individual approval by the DOT,
+ * which is recorded on the certificate.
  *
- * To registerCar a car, a RegistrationProposal needs to be present.
- * This proposal is removed/deleted after successfull registration.
- * This is not consistent with reality, but serves the purpose
- * for now, because the Form 13.20 A (RegistrationProposal)
- * is not used anywhere else right now. Like this, the RegistrationProposal
- * only serves the purpose to signal the DOT, that there is a new
- * car waiting for registration.
+ * Arguments required:
+ * [0] Vin                  (string)
+ * [1] 'individual'         (string, optional, approve without type approval)
  *
  * On success,
  * returns the car with certificate.
  */
-func (t *CarChaincode) registerCar(stub shim.ChaincodeStubInterface, username string, vin string) pb.Response {
+func (t *CarChaincode) registerCar(stub shim.ChaincodeStubInterface, username string, vin string, individual bool) pb.Response {
 	// reading the car already checks that the user
 	// is the actual owner of the car
 	car, err := t.getCarAsDot(stub, vin)
@@ -153,6 +264,8 @@ func (t *CarChaincode) registerCar(stub shim.ChaincodeStubInterface, username st
 	}
 	if vin != car.Vin {
 		return shim.Error(fmt.Sprintf("Cannot register, invalid VIN.\nCar VIN is '%s' and you want to register VIN '%s'", car.Vin, vin))
+	} else if IsStolen(&car) {
+		return shim.Error(fmt.Sprintf("Car with VIN '%s' is reported stolen", vin))
 	}
 
 	// get all registration proposals
@@ -161,30 +274,86 @@ func (t *CarChaincode) registerCar(stub shim.ChaincodeStubInterface, username st
 		return shim.Error("Error reading registration proposal index")
 	}
 
-	// check if there exists a registration proposal for that car
-	if proposals[car.Vin].Car != vin {
+	// check if there exists a pending registration proposal for that car
+	proposal := proposals[car.Vin]
+	if proposal.Car != vin {
 		return shim.Error(fmt.Sprintf("There exists no registration proposal for car with VIN: %s", vin))
+	} else if !IsPending(&proposal) {
+		return shim.Error(fmt.Sprintf("Registration proposal for car with VIN '%s' is %s", vin, proposal.Status))
+	}
+
+	// the car is tied to the authority registering it,
+	// which has to be in charge of the keeper's canton
+	authority, err := t.getAuthority(stub, username)
+	if err != nil {
+		return shim.Error(err.Error())
+	} else if !inJurisdiction(authority, proposal.Canton) {
+		return shim.Error(fmt.Sprintf("Registration proposal for car with VIN '%s' is for canton %s, not for %s", vin, proposal.Canton, authority))
+	}
+
+	car.Authority = authority
+	if authority == "" {
+		car.Authority = proposal.Canton
+	}
+
+	// the brand on the certificate has to match the
+	// manufacturer decoded from the VIN, if it is known
+	if car.Manufacturer != "" {
+		if car.Certificate.Brand == "" {
+			car.Certificate.Brand = car.Manufacturer
+		} else if !MatchesManufacturer(car.Certificate.Brand, car.Manufacturer) {
+			return shim.Error(fmt.Sprintf("Cannot register, brand '%s' does not match manufacturer '%s' of VIN '%s'",
+				car.Certificate.Brand, car.Manufacturer, vin))
+		}
+	}
+
+	// the technical data has to match the approved vehicle type
+	err = t.checkTypeApproval(stub, &car, &proposal.TechnicalData, individual)
+	if err != nil {
+		return shim.Error(err.Error())
 	}
 
-	// create a certificate, approve vin
-	// and update the car in the ledger
-	car.Certificate.Username = username
+	// create a certificate with the approved
+	// technical data, approve vin and
+	// update the car in the ledger
 	car.Certificate.Vin = vin
+	car.Certificate.TechnicalData = proposal.TechnicalData
+	car.Certificate.IndividualApproval = proposal.HomologationNumber == ""
+	err = transitionCar(stub, &car, "registered", username, "register")
+	if err != nil {
+		return shim.Error(err.Error())
+	}
 	carAsBytes, _ := json.Marshal(car)
 	err = stub.PutState(car.Vin, carAsBytes)
 	if err != nil {
 		return shim.Error("Error writing car")
 	}
 
-	// remove the proposal we just registered
-	delete(proposals, car.Vin)
+	// the owner pays the registration fee
+	fees, err := t.getFeeSchedule(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	users := make(map[string]*User)
+	err = t.chargeFee(stub, users, car.Certificate.Owner, "registration", vin, fees.Registration)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
 
-	// save the new proposal index
-	// without the car we just registered
-	proposalsAsBytes, _ := json.Marshal(proposals)
-	err = stub.PutState(registrationProposalIndexStr, proposalsAsBytes)
+	err = t.saveUsers(stub, users)
 	if err != nil {
-		return shim.Error("Error writing proposal index")
+		return shim.Error(err.Error())
+	}
+
+	// approve the proposal we just registered,
+	// it no longer shows up in the DOT queue
+	decideRegistrationProposal(stub, &proposal, "approved", username, "")
+	proposals[car.Vin] = proposal
+
+	err = t.saveRegistrationProposals(stub, proposals)
+	if err != nil {
+		return shim.Error(err.Error())
 	}
 
 	fmt.Printf("Successfully registered car created at ts '%d' with VIN '%s'\n", car.CreatedTs, vin)
@@ -192,19 +361,95 @@ func (t *CarChaincode) registerCar(stub shim.ChaincodeStubInterface, username st
 	return shim.Success(carAsBytes)
 }
 
+/*
+ * Rejects a pending registration proposal.
+ *
+ * The owner can correct the registration data
+ * and resubmit the proposal.
+ *
+ * Required arguments:
+ *   [0] Vin     (string)
+ *   [1] Reason  (string)
+ *
+ * On success,
+ * returns the rejected proposal.
+ */
+func (t *CarChaincode) rejectRegistrationProposal(stub shim.ChaincodeStubInterface, username string, args []string) pb.Response {
+	vin := args[0]
+	reason := args[1]
+
+	if reason == "" {
+		return shim.Error("'rejectRegistrationProposal' expects a reason for the rejection")
+	}
+
+	proposals, err := t.getRegistrationProposals(stub)
+	if err != nil {
+		return shim.Error("Error reading registration proposal index")
+	}
+
+	proposal, exists := proposals[vin]
+	if !exists {
+		return shim.Error(fmt.Sprintf("There exists no registration proposal for car with VIN: %s", vin))
+	} else if !IsPending(&proposal) {
+		return shim.Error(fmt.Sprintf("Registration proposal for car with VIN '%s' is %s", vin, proposal.Status))
+	}
+
+	authority, err := t.getAuthority(stub, username)
+	if err != nil {
+		return shim.Error(err.Error())
+	} else if !inJurisdiction(authority, proposal.Canton) {
+		return shim.Error(fmt.Sprintf("Registration proposal for car with VIN '%s' is for canton %s, not for %s", vin, proposal.Canton, authority))
+	}
+
+	decideRegistrationProposal(stub, &proposal, "rejected", username, reason)
+	proposals[vin] = proposal
+
+	// the car is back to where it was before the proposal
+	car, err := t.getCarAsDot(stub, vin)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	err = transitionCar(stub, &car, "created", username, "rejectRegistrationProposal")
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	err = t.saveCar(stub, car)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	err = t.saveRegistrationProposals(stub, proposals)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Printf("Rejected registration proposal for car with VIN '%s': %s\n", vin, reason)
+
+	proposalAsBytes, _ := json.Marshal(proposal)
+	return shim.Success(proposalAsBytes)
+}
+
 /*
  * Returns a list of cars to be confirmed
+ * by the DOT user's authority.
  *
  * On success,
  * returns a list with cars to confirm.
  */
-func (t *CarChaincode) getCarsToConfirm(stub shim.ChaincodeStubInterface) pb.Response {
+func (t *CarChaincode) getCarsToConfirm(stub shim.ChaincodeStubInterface, username string) pb.Response {
 	carIndex, err := t.getCarIndex(stub)
 
 	if err != nil {
 		return shim.Error("Error getting car index")
 	}
 
+	authority, err := t.getAuthority(stub, username)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
 	var toConfirmcarList []Car
 
 	for k := range carIndex {
@@ -212,7 +457,7 @@ func (t *CarChaincode) getCarsToConfirm(stub shim.ChaincodeStubInterface) pb.Res
 		if err != nil {
 			return shim.Error("Error getting car")
 		}
-		if IsRegistered(&car) && IsInsured(&car) && (car.Certificate.Numberplate == "") {
+		if CarStatus(&car) == "insured" && inJurisdiction(authority, car.Authority) {
 			toConfirmcarList = append(toConfirmcarList, car)
 		}
 	}
@@ -231,6 +476,8 @@ func (t *CarChaincode) getCarsToConfirm(stub shim.ChaincodeStubInterface) pb.Res
  * Car needs to be insured as a requirement for getting
  * the permit to drive on the roads. Only insured cars can get
  * confirmed and get a numberplate.
+ * The keeper is charged the confirmation fee.
+ * The plate has to be from the canton the car is registered in.
  *
  * Required arguments:
  *   [0] Vin         (string)
@@ -240,26 +487,42 @@ func (t *CarChaincode) getCarsToConfirm(stub shim.ChaincodeStubInterface) pb.Res
  * returns the car with numberplate.
  */
 func (t *CarChaincode) confirmCar(stub shim.ChaincodeStubInterface, username string, args []string) pb.Response {
-	vin := args[0]
-	numberplate := args[1]
+	return t.confirmCarWithNumberplate(stub, username, args[0], args[1], false)
+}
+
+/*
+ * Confirms a car with the numberplate of another car
+ * of the same owner (interchangeable plate).
+ *
+ * Only one of the two cars can be on the road at a time,
+ * the plate is held by the keeper of both cars.
+ *
+ * Required arguments:
+ *   [0] Vin         (string)
+ *   [1] Numberplate (string, carried by the other car)
+ *
+ * On success,
+ * returns the car with numberplate.
+ */
+func (t *CarChaincode) confirmInterchangeable(stub shim.ChaincodeStubInterface, username string, args []string) pb.Response {
+	return t.confirmCarWithNumberplate(stub, username, args[0], args[1], true)
+}
 
+/*
+ * Checks the numberplate and assigns it to the car.
+ */
+func (t *CarChaincode) confirmCarWithNumberplate(stub shim.ChaincodeStubInterface, username string, vin string, numberplateArg string, interchangeable bool) pb.Response {
 	if vin == "" {
 		return shim.Error("'confirm' expects a non-empty VIN to assign a numberplate")
 	}
 
 	// check numberplate argument
-	if numberplate == "" {
+	if numberplateArg == "" {
 		return shim.Error("Car numberplate is empty. Please provide a numberplate to confirm your car")
 	}
-
-	// checking if numberplate is yet available
-	numberplateIndex, err := t.getNumberplateIndex(stub)
+	numberplate, err := NormalizeNumberplate(numberplateArg)
 	if err != nil {
-		return shim.Error("Failed to fetch numberplate index")
-	}
-	vinNumberplateExisting, numberplateExisting := numberplateIndex[numberplate]
-	if numberplateExisting {
-		return shim.Error("Numberplate already taken. Confirmation for car " + vin + "' with numberplate '" + vinNumberplateExisting + "' failed.")
+		return shim.Error(err.Error())
 	}
 
 	// fetch the car from the ledger
@@ -268,23 +531,38 @@ func (t *CarChaincode) confirmCar(stub shim.ChaincodeStubInterface, username str
 		return shim.Error("Failed to fetch car with vin '" + vin + "' from ledger")
 	}
 
-	// check if car is insured
-	if !IsInsured(&car) {
-		return shim.Error("Car is not insured. Please insure car first before trying to confirm it")
+	err = t.checkAuthority(stub, username, &car)
+	if err != nil {
+		return shim.Error(err.Error())
 	}
 
-	// updating numberplate index
-	numberplateIndex[numberplate] = vin
+	if IsStolen(&car) {
+		return shim.Error(fmt.Sprintf("Car with VIN '%s' is reported stolen", vin))
+	} else if car.Certificate.Numberplate != "" {
+		return shim.Error(fmt.Sprintf("Car already has numberplate '%s'", car.Certificate.Numberplate))
+	}
+
+	// only cars with a policy in force can be confirmed,
+	// the status alone does not track the policy validity
+	if !IsInsured(&car, txTimestamp(stub)) {
+		return shim.Error("Car is not insured")
+	}
 
-	// write updated numberplate index to ledger
-	numberplateIndexAsBytes, _ := json.Marshal(numberplateIndex)
-	err = stub.PutState(vin, numberplateIndexAsBytes)
+	// only insured cars can be confirmed
+	err = transitionCar(stub, &car, "confirmed", username, "confirm")
 	if err != nil {
-		return shim.Error("Error writing numberplate index to ledger")
+		return shim.Error(err.Error())
 	}
 
-	// assign the numberplate to the car
-	car.Certificate.Numberplate = numberplate
+	// the plate has to be from the canton of the registering authority
+	if car.Authority != "" && !strings.HasPrefix(numberplate, car.Authority+" ") {
+		return shim.Error(fmt.Sprintf("Car with VIN '%s' is registered in canton %s, numberplate '%s' is not", vin, car.Authority, numberplate))
+	}
+
+	err = t.issueNumberplate(stub, &car, numberplate, interchangeable)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
 
 	// write udpated car back to ledger
 	carAsBytes, _ := json.Marshal(car)
@@ -298,48 +576,136 @@ func (t *CarChaincode) confirmCar(stub shim.ChaincodeStubInterface, username str
 	return shim.Success(carAsBytes)
 }
 
+/*
+ * Assigns a numberplate to a car.
+ *
+ * Checks that the plate is free, or shared with one other
+ * car of the same owner for interchangeable plates, and
+ * not retained or reserved for someone else. The keeper
+ * is charged the confirmation fee. The car is not
+ * written to the ledger.
+ */
+func (t *CarChaincode) issueNumberplate(stub shim.ChaincodeStubInterface, car *Car, numberplate string, interchangeable bool) error {
+	// checking if numberplate is yet available
+	plates, err := t.getNumberplateIndex(stub)
+	if err != nil {
+		return errors.New("Failed to fetch numberplate index")
+	}
+	plate, issued := plates[numberplate]
+	if !issued {
+		plate = Numberplate{Numberplate: numberplate}
+	}
+
+	if interchangeable {
+		// the plate has to be on exactly one other car
+		// of the same owner and keeper
+		if len(plate.Vins) != 1 {
+			return fmt.Errorf("Numberplate '%s' has to be on exactly one other car to be interchangeable", numberplate)
+		}
+
+		other, err := t.getCarAsDot(stub, plate.Vins[0])
+		if err != nil {
+			return err
+		} else if other.Certificate.Owner != car.Certificate.Owner || plate.Holder != car.Certificate.Keeper {
+			return errors.New("Interchangeable numberplates can only be shared by cars of the same owner and keeper")
+		}
+	} else if len(plate.Vins) > 0 {
+		return errors.New("Numberplate already taken. Confirmation for car '" + car.Vin + "' with numberplate '" + numberplate + "' failed, the plate belongs to car '" + plate.Vins[0] + "'.")
+	} else if IsRetained(&plate, txTimestamp(stub)) && plate.Holder != car.Certificate.Keeper {
+		return fmt.Errorf("Numberplate '%s' is retained for its previous holder", numberplate)
+	}
+
+	// vanity plates can only go to a car of the user who reserved them,
+	// the reservation is used up by the assignment
+	reservations, err := t.getReservationIndex(stub)
+	if err != nil {
+		return err
+	}
+	if reservation, reserved := reservations[numberplate]; reserved {
+		if reservation.Username != car.Certificate.Keeper {
+			return fmt.Errorf("Numberplate '%s' is reserved for another user", numberplate)
+		}
+
+		delete(reservations, numberplate)
+		err = t.saveReservationIndex(stub, reservations)
+		if err != nil {
+			return err
+		}
+	}
+
+	// the keeper pays the confirmation fee
+	fees, err := t.getFeeSchedule(stub)
+	if err != nil {
+		return err
+	}
+
+	users := make(map[string]*User)
+	err = t.chargeFee(stub, users, car.Certificate.Keeper, "confirmation", car.Vin, fees.Confirmation)
+	if err != nil {
+		return err
+	}
+
+	err = t.saveUsers(stub, users)
+	if err != nil {
+		return err
+	}
+
+	// assign the numberplate to the car
+	// and update the numberplate index
+	assignNumberplate(&plate, car, txTimestamp(stub))
+	plates[numberplate] = plate
+
+	return t.saveNumberplateIndex(stub, plates)
+}
+
 /*
  * Revokes a car.
  *
- * Only the owner of a car can request revocation of a car.
+ * Only the keeper of a car can request revocation of a car,
+ * the authority the car is registered with revokes it.
  * A revocation will render the numberplate
  * and the insurance contract as invalid.
  * This is required before a car transfer.
  *
+ * The numberplate returns to the pool of free plates,
+ * unless it is retained for its holder. Retained plates
+ * can only be assigned to cars of the holder until
+ * the retention period is over.
+ *
+ * A pending revocation request for the car is approved.
+ *
  * On success,
  * returns the car.
  */
-func (t *CarChaincode) revoke(stub shim.ChaincodeStubInterface, username string, vin string) pb.Response {
+func (t *CarChaincode) revoke(stub shim.ChaincodeStubInterface, username string, vin string, retain bool) pb.Response {
 	if vin == "" {
 		return shim.Error("'revoke' expects a non-empty VIN to do the revocation")
 	}
 
 	// fetch the car from the ledger
-	// this already checks for ownership
-	car, err := t.getCar(stub, username, vin)
+	car, err := t.getCarAsDot(stub, vin)
 	if err != nil {
 		return shim.Error("Failed to fetch car with vin '" + vin + "' from ledger")
 	}
 
-	// check if car is already revoked
-	if !IsInsured(&car) && !IsConfirmed(&car) {
-		return shim.Error("Car is already revoked!")
+	err = t.checkAuthority(stub, username, &car)
+	if err != nil {
+		return shim.Error(err.Error())
 	}
 
-	// remove car insurance
-	car.Certificate.Insurer = ""
-
-	// check if car is not anymore insured
-	if IsInsured(&car) {
-		return shim.Error("Whoops... Something went wrong while revoking car. Car is still insured.")
+	plates, err := t.getNumberplateIndex(stub)
+	if err != nil {
+		return shim.Error(err.Error())
 	}
 
-	// remove numberplate
-	car.Certificate.Numberplate = ""
+	err = t.revokeCar(stub, plates, &car, username, retain)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
 
-	// check if not confirmed anymore
-	if IsConfirmed(&car) {
-		return shim.Error("Whoops... Something went wrong while revoking car. Car is still confirmed.")
+	err = t.saveNumberplateIndex(stub, plates)
+	if err != nil {
+		return shim.Error(err.Error())
 	}
 
 	// write udpated car back to ledger
@@ -349,22 +715,16 @@ func (t *CarChaincode) revoke(stub shim.ChaincodeStubInterface, username string,
 		return shim.Error("Error writing car")
 	}
 
-	// fetch all revocation proposals
-	response := t.getRevocationProposals(stub)
-	index := make(map[string]string)
-	err = json.Unmarshal(response.Payload, &index)
+	// approve the revocation request if any
+	users := make(map[string]*User)
+	err = t.closeRevocationRequest(stub, users, car.Vin, "approved", "The car was revoked")
 	if err != nil {
-		return shim.Error("Failed to fetch revocation proposals")
+		return shim.Error(err.Error())
 	}
 
-	// remove the revocation proposal if any
-	delete(index, car.Vin)
-
-	// save proposals back to ledger
-	indexAsBytes, _ := json.Marshal(index)
-	err = stub.PutState(revocationProposalIndexStr, indexAsBytes)
+	err = t.saveUsers(stub, users)
 	if err != nil {
-		return shim.Error("Error writing revocation proposals")
+		return shim.Error(err.Error())
 	}
 
 	// car revokation successfull,
@@ -373,77 +733,372 @@ func (t *CarChaincode) revoke(stub shim.ChaincodeStubInterface, username string,
 }
 
 /*
- * Returns all revocation proposals.
+ * Withdraws the insurance contract and the numberplate of a car.
+ *
+ * The numberplate is released in 'plates', neither
+ * the index nor the car are written to the ledger.
  */
-func (t *CarChaincode) getRevocationProposals(stub shim.ChaincodeStubInterface) pb.Response {
+func (t *CarChaincode) revokeCar(stub shim.ChaincodeStubInterface, plates map[string]Numberplate, car *Car, by string, retain bool) error {
+	// only insured or confirmed cars can be revoked
+	err := transitionCar(stub, car, "revoked", by, "revoke")
+	if err != nil {
+		return err
+	}
+
+	// remove car insurance
+	now := txTimestamp(stub)
+	car.Certificate.Insurer = ""
+	cancelPolicies(car, now)
+
+	// check if car is not anymore insured
+	if IsInsured(car, now) {
+		return errors.New("Whoops... Something went wrong while revoking car. Car is still insured.")
+	}
+
+	// remove numberplate, it returns to the pool of
+	// free plates or is retained for its holder
+	unassignNumberplate(plates, car, retain, now)
+
+	// check if not confirmed anymore
+	if IsConfirmed(car, now) {
+		return errors.New("Whoops... Something went wrong while revoking car. Car is still confirmed.")
+	}
+
+	return nil
+}
+
+/*
+ * Returns the pending revocation requests by VIN.
+ */
+func (t *CarChaincode) getRevocationRequests(stub shim.ChaincodeStubInterface) (map[string]RevocationRequest, error) {
 	response := t.read(stub, revocationProposalIndexStr)
-	index := make(map[string]string)
+	index := make(map[string]RevocationRequest)
 	err := json.Unmarshal(response.Payload, &index)
 	if err != nil {
-		return shim.Error("Error reading revocation proposal index")
+		return nil, errors.New("Error parsing revocation proposal index")
+	}
+
+	return index, nil
+}
+
+/*
+ * Saves the revocation request index.
+ */
+func (t *CarChaincode) saveRevocationRequests(stub shim.ChaincodeStubInterface, index map[string]RevocationRequest) error {
+	indexAsBytes, _ := json.Marshal(index)
+	err := stub.PutState(revocationProposalIndexStr, indexAsBytes)
+	if err != nil {
+		return errors.New("Error writing revocation proposal index")
+	}
+
+	return nil
+}
+
+/*
+ * Returns all revocation proposals.
+ *
+ * On success,
+ * returns the requester by VIN.
+ */
+func (t *CarChaincode) getRevocationProposals(stub shim.ChaincodeStubInterface) pb.Response {
+	index, err := t.getRevocationRequests(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	requesters := make(map[string]string)
+	for vin, request := range index {
+		requesters[vin] = request.Requester
+	}
+
+	requestersAsBytes, _ := json.Marshal(requesters)
+	return shim.Success(requestersAsBytes)
+}
+
+/*
+ * Returns all pending revocation requests.
+ *
+ * On success,
+ * returns a list with revocation requests, oldest first.
+ */
+func (t *CarChaincode) readRevocationRequests(stub shim.ChaincodeStubInterface) pb.Response {
+	index, err := t.getRevocationRequests(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	vins := []string{}
+	for vin := range index {
+		vins = append(vins, vin)
+	}
+	sort.Strings(vins)
+
+	requests := []RevocationRequest{}
+	for _, vin := range vins {
+		requests = append(requests, index[vin])
+	}
+	sort.Stable(revocationRequestsByAge(requests))
+
+	requestsAsBytes, _ := json.Marshal(requests)
+	return shim.Success(requestsAsBytes)
+}
+
+// sorts revocation requests oldest first
+type revocationRequestsByAge []RevocationRequest
+
+func (r revocationRequestsByAge) Len() int           { return len(r) }
+func (r revocationRequestsByAge) Swap(i, j int)      { r[i], r[j] = r[j], r[i] }
+func (r revocationRequestsByAge) Less(i, j int) bool { return r[i].CreatedTs < r[j].CreatedTs }
+
+/*
+ * Removes the revocation request for a car, if any,
+ * and notifies the requester in 'users' of the outcome.
+ */
+func (t *CarChaincode) closeRevocationRequest(stub shim.ChaincodeStubInterface, users map[string]*User, vin string, status string, message string) error {
+	index, err := t.getRevocationRequests(stub)
+	if err != nil {
+		return err
+	}
+
+	if _, exists := index[vin]; !exists {
+		return nil
 	}
 
-	return shim.Success(response.Payload)
+	t.removeRevocationRequest(stub, users, index, vin, status, message)
+	return t.saveRevocationRequests(stub, index)
+}
+
+/*
+ * Removes the revocation request for a car from 'index'
+ * and notifies the requester in 'users' of the outcome.
+ *
+ * The index is not written to the ledger.
+ */
+func (t *CarChaincode) removeRevocationRequest(stub shim.ChaincodeStubInterface, users map[string]*User, index map[string]RevocationRequest, vin string, status string, message string) {
+	request, exists := index[vin]
+	if !exists {
+		return
+	}
+
+	delete(index, vin)
+	t.notify(stub, users, request.Requester, Notification{
+		Type:    "revocation",
+		Subject: vin,
+		Status:  status,
+		Message: message})
 }
 
 /*
  * Creates a revocation proposal.
  *
- * Only the owner of a car can request revocation of a car.
+ * Only the keeper of a car can request revocation of a car.
  * A revocation proposal is not a prerequisite, for the DOT
  * to revoke a car. A car could be revoked inedependently
  * of this proposal.
  *
+ * Arguments required:
+ * [0] Vin                  (string)
+ * [1] Reason               (string, optional, 'sale', 'deregistration',
+ *                           'plateChange', 'insuranceChange' or 'other')
+ *
  * On success,
  * returns 'nil'.
  */
-func (t *CarChaincode) revocationProposal(stub shim.ChaincodeStubInterface, username string, vin string) pb.Response {
+func (t *CarChaincode) revocationProposal(stub shim.ChaincodeStubInterface, username string, args []string) pb.Response {
+	vin := args[0]
+	reason := "other"
+	if len(args) > 1 {
+		reason = args[1]
+	}
+
 	if vin == "" {
 		return shim.Error("'revocationProposal' expects a non-empty VIN to do the revocation")
 	}
 
+	switch reason {
+	case "sale", "deregistration", "plateChange", "insuranceChange", "other":
+	default:
+		return shim.Error(fmt.Sprintf("Unknown revocation reason '%s'", reason))
+	}
+
 	// fetch the car from the ledger
-	// this already checks for ownership
-	car, err := t.getCar(stub, username, vin)
+	// this already checks for keepership
+	car, err := t.getCarAsKeeper(stub, username, vin)
 	if err != nil {
 		return shim.Error("Failed to fetch car with vin '" + vin + "' from ledger")
 	}
 
-	// check if the car can be revoked
-	if !IsConfirmed(&car) {
+	// check if the car can be revoked,
+	// uninsured and suspended cars still hand back their plate
+	if !HasNumberplate(&car) {
 		return shim.Error("You cannot create a revocation proposal for an unconfirmed car.")
 	}
 
 	// fetch all the revocation proposals
-	response := t.read(stub, revocationProposalIndexStr)
-	index := make(map[string]string)
-	err = json.Unmarshal(response.Payload, &index)
+	index, err := t.getRevocationRequests(stub)
 	if err != nil {
-		return shim.Error("Error parsing revocation proposal index")
+		return shim.Error(err.Error())
 	}
 
 	// check if a proposal to revoke this car already exists
-	if index[vin] == username {
+	if index[vin].Requester == username {
 		return shim.Error("A revocation proposal for that car VIN and user already exists.")
 	}
 
 	// save the users request to revok his car
 	// in the revocation proposal index
-	index[vin] = username
-
-	// save index back to ledger
-	indexAsBytes, _ := json.Marshal(index)
-	err = stub.PutState(revocationProposalIndexStr, indexAsBytes)
+	index[vin] = RevocationRequest{
+		Vin:       vin,
+		Requester: username,
+		Reason:    reason,
+		CreatedTs: txTimestamp(stub),
+		TxId:      stub.GetTxID()}
+
+	err = t.saveRevocationRequests(stub, index)
 	if err != nil {
-		return shim.Error("Error writing revocation proposal index")
+		return shim.Error(err.Error())
 	}
 
 	return shim.Success(nil)
 }
 
+/*
+ * Approves or denies a batch of revocation requests.
+ *
+ * Every decision is handled on its own, a failing item
+ * does not stop the batch. Approved requests revoke the
+ * car, denied requests are dropped. The requesters are
+ * notified of the outcome. The request and numberplate
+ * indexes and the requesters are loaded once, all
+ * decisions are applied in memory and written back
+ * at the end.
+ *
+ * Arguments required:
+ * [0] Decisions            (json, list of RevocationDecision)
+ *
+ * On success,
+ * returns a list with a result per decision.
+ */
+func (t *CarChaincode) processRevocationRequests(stub shim.ChaincodeStubInterface, username string, args []string) pb.Response {
+	var decisions []RevocationDecision
+	err := json.Unmarshal([]byte(args[0]), &decisions)
+	if err != nil {
+		return shim.Error("Error parsing decisions. Expecting a list of RevocationDecision as json.")
+	}
+
+	index, err := t.getRevocationRequests(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	plates, err := t.getNumberplateIndex(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	users := make(map[string]*User)
+	results := []RevocationResult{}
+	for _, decision := range decisions {
+		result, err := t.processRevocationRequest(stub, username, index, plates, users, decision)
+		if err != nil {
+			// ledger errors abort the whole batch
+			return shim.Error(err.Error())
+		}
+
+		results = append(results, result)
+	}
+
+	err = t.saveRevocationRequests(stub, index)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	err = t.saveNumberplateIndex(stub, plates)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	err = t.saveUsers(stub, users)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	resultsAsBytes, _ := json.Marshal(results)
+	return shim.Success(resultsAsBytes)
+}
+
+/*
+ * Decides a single revocation request of a batch.
+ *
+ * The request, the numberplate and the requester are
+ * changed in 'index', 'plates' and 'users', only the
+ * revoked car is written to the ledger.
+ *
+ * Returns an error only if writing to the ledger failed,
+ * invalid decisions are reported in the result.
+ */
+func (t *CarChaincode) processRevocationRequest(stub shim.ChaincodeStubInterface, username string, index map[string]RevocationRequest, plates map[string]Numberplate, users map[string]*User, decision RevocationDecision) (RevocationResult, error) {
+	result := RevocationResult{Vin: decision.Vin, Status: "failed"}
+
+	request, exists := index[decision.Vin]
+	if !exists {
+		result.Message = fmt.Sprintf("No pending revocation request for car with VIN '%s'", decision.Vin)
+		return result, nil
+	}
+
+	switch decision.Decision {
+	case "approve":
+		car, err := t.getCarAsDot(stub, decision.Vin)
+		if err != nil {
+			result.Message = err.Error()
+			return result, nil
+		} else if err = t.checkAuthority(stub, username, &car); err != nil {
+			result.Message = err.Error()
+			return result, nil
+		} else if car.Certificate.Keeper != request.Requester {
+			result.Message = fmt.Sprintf("User '%s' is no longer the keeper", request.Requester)
+			return result, nil
+		}
+
+		err = t.revokeCar(stub, plates, &car, username, decision.Retain)
+		if err != nil {
+			result.Message = err.Error()
+			return result, nil
+		}
+
+		err = t.saveCar(stub, car)
+		if err != nil {
+			return result, err
+		}
+
+		result.Status = "approved"
+		result.Message = "The car was revoked"
+	case "deny":
+		result.Status = "denied"
+		result.Message = "The revocation was denied"
+	default:
+		result.Message = fmt.Sprintf("Decision has to be 'approve' or 'deny', got '%s'", decision.Decision)
+		return result, nil
+	}
+
+	if decision.Comment != "" {
+		result.Message += ": " + decision.Comment
+	}
+
+	t.removeRevocationRequest(stub, users, index, decision.Vin, result.Status, result.Message)
+	return result, nil
+}
+
 /*
  * Deletes a car from the ledger.
  *
+ * Meant to clean up cars created by mistake, so only
+ * cars not yet registered can be deleted. Cars taken
+ * off the road are deregistered, scrapped or exported
+ * instead to keep their history. Stolen cars and cars
+ * with open claims cannot be deleted, pending insurance
+ * proposals and revocation requests are cancelled.
+ *
  * Returns 'nil' on success.
  */
 func (t *CarChaincode) deleteCar(stub shim.ChaincodeStubInterface, vin string) pb.Response {
@@ -456,7 +1111,78 @@ func (t *CarChaincode) deleteCar(stub shim.ChaincodeStubInterface, vin string) p
 	if !carExisting {
 		return shim.Error("Car does not exist in Car Index!")
 	}
-	delete(carIndex, vin)
+
+	// a financed car cannot be deleted
+	car, err := t.getCarAsDot(stub, vin)
+	if err != nil {
+		return shim.Error("Failed to fetch car with vin '" + vin + "' from ledger")
+	} else if HasActiveLien(&car) {
+		return shim.Error("The car has an active lien. The lien has to be released before the car can be deleted.")
+	} else if IsStolen(&car) {
+		return shim.Error(fmt.Sprintf("Car with VIN '%s' is reported stolen", vin))
+	}
+
+	err = checkCarAction(&car, "delete")
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	claimIndex, err := t.getClaimIndex(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	for _, claim := range claimIndex {
+		if claim.Vin == vin {
+			return shim.Error(fmt.Sprintf("Car with VIN '%s' has open claims", vin))
+		}
+	}
+
+	// nothing is left pending for the deleted car
+	users := make(map[string]*User)
+	err = t.clearInsureProposals(stub, users, vin, "The car was deleted")
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	err = t.closeRevocationRequest(stub, users, vin, "cancelled", "The car was deleted")
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// the numberplate of a deleted car returns to the pool
+	err = t.releaseNumberplate(stub, &car, false)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// drop the registration proposal of the car
+	proposalIndex, err := t.getRegistrationProposals(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	delete(proposalIndex, vin)
+	err = t.saveRegistrationProposals(stub, proposalIndex)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// the car leaves its keeper
+	err = t.moveKeptCar(stub, users, &car, car.Certificate.Owner)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// remove the car from its owner, if the owner still exists
+	owner, err := t.loadUser(stub, users, carIndex[vin])
+	if err == nil {
+		owner.Cars = removeVin(owner.Cars, vin)
+		owner.FormerCars = removeVin(owner.FormerCars, vin)
+	}
+
+	err = t.saveUsers(stub, users)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
 
 	// Delete the key from the state in ledger
 	err = stub.DelState(vin)
@@ -464,22 +1190,15 @@ func (t *CarChaincode) deleteCar(stub shim.ChaincodeStubInterface, vin string) p
 		return shim.Error("Failed to delete car state")
 	}
 
-	fmt.Printf("Successfully deleted car with VIN: '%s'\n", vin)
-	return shim.Success(nil)
-}
-
-/*
- * Returns the numberplate index
- */
-func (t *CarChaincode) getNumberplateIndex(stub shim.ChaincodeStubInterface) (map[string]string, error) {
-	response := t.read(stub, numberplateIndex)
-	numberplateIndex := make(map[string]string)
-	err := json.Unmarshal(response.Payload, &numberplateIndex)
+	delete(carIndex, vin)
+	indexAsBytes, _ := json.Marshal(carIndex)
+	err = stub.PutState(carIndexStr, indexAsBytes)
 	if err != nil {
-		return nil, errors.New("Error parsing car index")
+		return shim.Error("Error writing car index")
 	}
 
-	return numberplateIndex, nil
+	fmt.Printf("Successfully deleted car with VIN: '%s'\n", vin)
+	return shim.Success(nil)
 }
 
 /*
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"testing"
+	"time"
 
 	"github.com/hyperledger/fabric/common/util"
 	"github.com/hyperledger/fabric/core/chaincode/shim"
@@ -13,7 +14,7 @@ func TestIsConfirmed(t *testing.T) {
 	// create a new car without numberplate
 	car := &Car{}
 
-	if IsConfirmed(car) {
+	if IsConfirmed(car, time.Now().Unix()) {
 		t.Error("Car should not be confirmed initially")
 	}
 }
@@ -29,7 +30,7 @@ func TestIsRegistered(t *testing.T) {
 
 func TestReadRegistrationProposalsAndRegisterCar(t *testing.T) {
 	var username string = "amag"
-	var vin string = "WVW ZZZ 6RZ HY26 0780"
+	var vin string = "WVWZZZ6RZHY260780"
 	var carData string = `{ "vin": "` + vin + `" }`
 
 	// create and name a new chaincode mock
@@ -56,7 +57,7 @@ func TestReadRegistrationProposalsAndRegisterCar(t *testing.T) {
 	fmt.Printf("Successfully created car with ts '%d'\n", car.CreatedTs)
 
 	// read all registration proposals as DOT user
-	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("readRegistrationProposals", "TESTING", "dot"))
+	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("readRegistrationProposals", "dot-user", "dot"))
 	proposals := make(map[string]RegistrationProposal)
 	err = json.Unmarshal(response.Payload, &proposals)
 	if err != nil {
@@ -80,14 +81,14 @@ func TestReadRegistrationProposalsAndRegisterCar(t *testing.T) {
 
 	// Registering a random car for which no open registration proposal exists
 	// should return an error. This car should not even be found on the ledger.
-	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("register", username, "dot", "someRandomVIN"))
+	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("register", "dot-user", "dot", "someRandomVIN", "individual"))
 	err = json.Unmarshal(response.Payload, &car)
 	if err == nil {
 		t.Error("Registering an unsaved car is not possible")
 	}
 
 	// register the car again as DOT user, should be allowed
-	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("register", username, "dot", vin))
+	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("register", "dot-user", "dot", vin, "individual"))
 	err = json.Unmarshal(response.Payload, &car)
 	if err != nil {
 		t.Error(response.Message)
@@ -100,7 +101,7 @@ func TestReadRegistrationProposalsAndRegisterCar(t *testing.T) {
 	// check out the proposals again and ensure
 	// that the just registered car is removed
 	// from the list of open registration proposals
-	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("readRegistrationProposals", "TESTING", "dot"))
+	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("readRegistrationProposals", "dot-user", "dot"))
 	proposals = make(map[string]RegistrationProposal)
 	err = json.Unmarshal(response.Payload, &proposals)
 	if err != nil {
@@ -113,7 +114,7 @@ func TestReadRegistrationProposalsAndRegisterCar(t *testing.T) {
 
 	// Registering the car twice should return an error,
 	// because no open registration proposal exists.
-	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("register", username, "dot", vin))
+	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("register", "dot-user", "dot", vin, "individual"))
 	err = json.Unmarshal(response.Payload, &car)
 	if err == nil {
 		t.Error("Registering a car without registration proposal should not be possible")
@@ -124,7 +125,7 @@ func TestReadRegistrationProposalsAndRegisterCar(t *testing.T) {
 
 func TestRevocationIndex(t *testing.T) {
 	var username string = "amag"
-	var vin string = "WVW ZZZ 6RZ HY26 0780"
+	var vin string = "WVWZZZ6RZHY260780"
 	var carData string = `{ "vin": "` + vin + `" }`
 	var numberplate string = "ZH 7878"
 	var insuranceCompany string = "axa"
@@ -148,7 +149,7 @@ func TestRevocationIndex(t *testing.T) {
 	fmt.Printf("Successfully created car with ts '%d'\n", car.CreatedTs)
 
 	// register the car as DOT user
-	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("register", username, "dot", vin))
+	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("register", "dot-user", "dot", vin, "individual"))
 	err = json.Unmarshal(response.Payload, &car)
 	if err != nil {
 		t.Error(response.Message)
@@ -170,18 +171,18 @@ func TestRevocationIndex(t *testing.T) {
 	}
 
 	// get a numberplate (confirmation)
-	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("confirm", username, "dot", vin, numberplate))
+	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("confirm", "dot-user", "dot", vin, numberplate))
 	err = json.Unmarshal(response.Payload, &car)
 	if err != nil {
 		t.Error("Error assigning numberplate")
 	}
 
-	if !IsConfirmed(&car) {
+	if !IsConfirmed(&car, time.Now().Unix()) {
 		t.Error("Car should be confirmed by now")
 	}
 
 	// checkout revocation proposals, should have none
-	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("getRevocationProposals", username, "dot"))
+	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("getRevocationProposals", "dot-user", "dot"))
 	index := make(map[string]string)
 	err = json.Unmarshal(response.Payload, &index)
 
@@ -196,7 +197,7 @@ func TestRevocationIndex(t *testing.T) {
 	}
 
 	// read proposals again
-	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("getRevocationProposals", username, "dot"))
+	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("getRevocationProposals", "dot-user", "dot"))
 	err = json.Unmarshal(response.Payload, &index)
 	if err != nil {
 		t.Error("Error reading revocation proposals")
@@ -214,18 +215,18 @@ func TestRevocationIndex(t *testing.T) {
 	fmt.Println(index)
 
 	// revoke numberplate
-	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("revoke", username, "dot", vin))
+	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("revoke", "dot-user", "dot", vin))
 	err = json.Unmarshal(response.Payload, &car)
 	if err != nil {
 		t.Error("Error revoking numberplate")
 	}
 
-	if IsConfirmed(&car) {
+	if IsConfirmed(&car, time.Now().Unix()) {
 		t.Error("Car should be revoked by now")
 	}
 
 	// read proposals again
-	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("getRevocationProposals", username, "dot"))
+	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("getRevocationProposals", "dot-user", "dot"))
 	index = make(map[string]string)
 	err = json.Unmarshal(response.Payload, &index)
 
@@ -239,7 +240,7 @@ func TestRevocationIndex(t *testing.T) {
 
 func TestConfirmRevokeAndDelete(t *testing.T) {
 	var username string = "amag"
-	var vin string = "WVW ZZZ 6RZ HY26 0780"
+	var vin string = "WVWZZZ6RZHY260780"
 	var carData string = `{ "vin": "` + vin + `" }`
 	var numberplate string = "ZH 7878"
 	var insuranceCompany string = "axa"
@@ -261,14 +262,14 @@ func TestConfirmRevokeAndDelete(t *testing.T) {
 	}
 
 	// ...but not yet confirmed
-	if IsConfirmed(&car) {
+	if IsConfirmed(&car, time.Now().Unix()) {
 		t.Error("Car should not be confirmed yet!")
 	}
 
 	fmt.Printf("Successfully created car with ts '%d'\n", car.CreatedTs)
 
 	// register the car as DOT user
-	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("register", username, "dot", vin))
+	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("register", "dot-user", "dot", vin, "individual"))
 	err = json.Unmarshal(response.Payload, &car)
 	if err != nil {
 		t.Error(response.Message)
@@ -282,7 +283,7 @@ func TestConfirmRevokeAndDelete(t *testing.T) {
 
 	// getting a numberplate (getting the car confirmed)
 	// without insurance contract should not be allowed
-	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("confirm", username, "dot", vin, numberplate))
+	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("confirm", "dot-user", "dot", vin, numberplate))
 	err = json.Unmarshal(response.Payload, &car)
 	if err == nil {
 		t.Error("Car should not get confirmed without insurance contract")
@@ -316,19 +317,19 @@ func TestConfirmRevokeAndDelete(t *testing.T) {
 
 	fmt.Println(car.Certificate.Insurer)
 
-	if !IsInsured(&car) {
+	if !IsInsured(&car, time.Now().Unix()) {
 		t.Error("Error insuring car")
 	}
 
 	// get a numberplate
 	// with a valid insurance contract this is now possible
-	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("confirm", username, "dot", vin, numberplate))
+	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("confirm", "dot-user", "dot", vin, numberplate))
 	err = json.Unmarshal(response.Payload, &car)
 	if err != nil {
 		t.Error("Error assigning numberplate")
 	}
 
-	if !IsConfirmed(&car) {
+	if !IsConfirmed(&car, time.Now().Unix()) {
 		t.Error("Car should be confirmed by now")
 	}
 
@@ -339,13 +340,13 @@ func TestConfirmRevokeAndDelete(t *testing.T) {
 	fmt.Println(car.Certificate.Numberplate)
 
 	// revoke numberplate
-	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("revoke", username, "dot", vin))
+	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("revoke", "dot-user", "dot", vin))
 	err = json.Unmarshal(response.Payload, &car)
 	if err != nil {
 		t.Error("Error revoking numberplate")
 	}
 
-	if IsConfirmed(&car) {
+	if IsConfirmed(&car, time.Now().Unix()) {
 		t.Error("Car should be revoked by now")
 	} else if car.Certificate.Insurer != "" {
 		t.Error("Revocation includes cancelation of the insurance contract")
@@ -355,24 +356,107 @@ func TestConfirmRevokeAndDelete(t *testing.T) {
 
 	fmt.Println(car.Certificate)
 
-	// delete the car from the ledger
-	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("delete", username, "dot", vin))
-	if response.Payload != nil {
-		t.Error("Car deletion unsuccessfull")
+	// registered cars keep their history
+	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("delete", "dot-user", "dot", vin))
+	if response.Status != shim.ERROR {
+		t.Error("Deleting a registered car should not be possible")
 	}
 
-	// try to fetch the delete car from the ledger
-	// (should be impossible)
 	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("readCar", username, "TESTING", car.Vin))
 	err = json.Unmarshal(response.Payload, &car)
-	if err == nil {
-		t.Error("Failed to delete car")
+	if err != nil {
+		t.Error("Registered car should still be on the ledger")
+	}
+}
+
+func TestConfirmNeedsPolicyInForce(t *testing.T) {
+	username := "amag"
+	vin := "WVWZZZ6RZHY260780"
+	insuranceCompany := "axa"
+
+	// create and name a new chaincode mock
+	carChaincode := &CarChaincode{}
+	stub := shim.NewMockStub("car", carChaincode)
+
+	ccSetup(t, stub)
+
+	stub.MockInvoke(uuid, util.ToChaincodeArgs("create", username, "garage", `{ "vin": "`+vin+`" }`))
+	stub.MockInvoke(uuid, util.ToChaincodeArgs("register", "dot-user", "dot", vin, "individual"))
+	stub.MockInvoke(uuid, util.ToChaincodeArgs("insureProposal", username, "garage", vin, insuranceCompany))
+	stub.MockInvoke(uuid, util.ToChaincodeArgs("insuranceAccept", "insurance-user", "insurer", username, vin, insuranceCompany))
+
+	// the policy lapses, the car stays in status 'insured'
+	car, _ := carChaincode.getCarAsDot(stub, vin)
+	car.Policies[0].EndTs = time.Now().Unix() - 1
+	carAsBytes, _ := json.Marshal(car)
+	stub.MockTransactionStart(uuid)
+	stub.PutState(vin, carAsBytes)
+	stub.MockTransactionEnd(uuid)
+
+	response := stub.MockInvoke(uuid, util.ToChaincodeArgs("confirm", "dot-user", "dot", vin, "ZH 1234"))
+	if response.Status != shim.ERROR {
+		t.Error("Car with a lapsed policy should not get a numberplate")
+	}
+}
+
+func TestDeleteCar(t *testing.T) {
+	username := "amag"
+	vin := "WVWZZZ6RZHY260780"
+	insuranceCompany := "axa"
+
+	// create and name a new chaincode mock
+	carChaincode := &CarChaincode{}
+	stub := shim.NewMockStub("car", carChaincode)
+
+	ccSetup(t, stub)
+
+	stub.MockInvoke(uuid, util.ToChaincodeArgs("create", username, "garage", `{ "vin": "`+vin+`" }`))
+	stub.MockInvoke(uuid, util.ToChaincodeArgs("insureProposal", username, "garage", vin, insuranceCompany))
+
+	// stolen cars stay on the ledger
+	stub.MockInvoke(uuid, util.ToChaincodeArgs("reportStolen", username, "garage", vin))
+	response := stub.MockInvoke(uuid, util.ToChaincodeArgs("delete", "dot-user", "dot", vin))
+	if response.Status != shim.ERROR {
+		t.Error("Deleting a stolen car should not be possible")
+	}
+
+	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("getStolenCarsAsList", "officer", "police"))
+	if response.Status == shim.ERROR {
+		t.Error(response.Message)
+	}
+
+	// recovered cars can be deleted before registration
+	stub.MockInvoke(uuid, util.ToChaincodeArgs("reportRecovered", username, "garage", vin))
+	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("delete", "dot-user", "dot", vin))
+	if response.Status == shim.ERROR {
+		t.Error(response.Message)
+		return
+	}
+
+	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("readCar", username, "garage", vin))
+	if response.Status != shim.ERROR {
+		t.Error("Deleted car should be gone")
+	}
+
+	// nothing pending is left behind
+	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("getInsurer", "insurance-user", "insurer", insuranceCompany))
+	insurer := Insurer{}
+	json.Unmarshal(response.Payload, &insurer)
+	if len(insurer.Proposals) != 0 {
+		t.Error("Insurance proposals of a deleted car should be cancelled")
+	}
+
+	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("readRegistrationProposals", "dot-user", "dot"))
+	proposals := make(map[string]RegistrationProposal)
+	json.Unmarshal(response.Payload, &proposals)
+	if _, exists := proposals[vin]; exists {
+		t.Error("Registration proposal of a deleted car should be dropped")
 	}
 }
 
 func TestReadRegistrationProposals(t *testing.T) {
 	username         := "test"
-    vin              := "WVW ZZZ 6RZ HY26 0780"
+    vin              := "WVWZZZ6RZHY260780"
 
     // create and name a new chaincode mock
     carChaincode := &CarChaincode{}
@@ -430,7 +514,7 @@ func TestReadRegistrationProposals(t *testing.T) {
 	}
 
 	// register car
-	stub.MockInvoke(uuid, util.ToChaincodeArgs("register", "dot-user", "dot", vin))
+	stub.MockInvoke(uuid, util.ToChaincodeArgs("register", "dot-user", "dot", vin, "individual"))
 
     // read proposals again
     response = stub.MockInvoke(uuid, util.ToChaincodeArgs("readRegistrationProposals", "dot-user", "dot"))
@@ -445,7 +529,7 @@ func TestReadRegistrationProposals(t *testing.T) {
 
 func TestAllCars(t *testing.T) {
 	username         := "test"
-    vin              := "WVW ZZZ 6RZ HY26 0780"
+    vin              := "WVWZZZ6RZHY260780"
 
     // create and name a new chaincode mock
     carChaincode := &CarChaincode{}
@@ -475,7 +559,7 @@ func TestAllCars(t *testing.T) {
 
 func TestCarsToConfirmList(t *testing.T) {
 	username         := "test"
-    vin              := "WVW ZZZ 6RZ HY26 0780"
+    vin              := "WVWZZZ6RZHY260780"
     insuranceCompany := "axa"
 
     // create and name a new chaincode mock
@@ -506,7 +590,7 @@ func TestCarsToConfirmList(t *testing.T) {
 	}
 
 	// register car
-	stub.MockInvoke(uuid, util.ToChaincodeArgs("register", "dot-user", "dot", vin))
+	stub.MockInvoke(uuid, util.ToChaincodeArgs("register", "dot-user", "dot", vin, "individual"))
 
 	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("getCarsToConfirmAsList", "dot-user", "dot"))
 	err = json.Unmarshal(response.Payload, &cars)
@@ -534,4 +618,239 @@ func TestCarsToConfirmList(t *testing.T) {
 		t.Error("Function does not return the right cars ready for confirmation")
 		return
 	}
-}
\ No newline at end of file
+}
+func TestRegistrationProposalLifecycle(t *testing.T) {
+	username := "amag"
+	vin := "WVWZZZ6RZHY260780"
+	carData := `{ "vin": "` + vin + `" }`
+
+	// create and name a new chaincode mock
+	carChaincode := &CarChaincode{}
+	stub := shim.NewMockStub("car", carChaincode)
+
+	ccSetup(t, stub)
+
+	stub.MockInvoke(uuid, util.ToChaincodeArgs("create", username, "garage", carData, `{ "numberOfDoors": "2" }`))
+
+	// only the DOT can reject proposals, and only with a reason
+	response := stub.MockInvoke(uuid, util.ToChaincodeArgs("rejectRegistrationProposal", username, "garage", vin, "wrong doors"))
+	if response.Status != shim.ERROR {
+		t.Error("Rejecting a proposal as 'garage' should not be possible")
+	}
+
+	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("rejectRegistrationProposal", "dot-user", "dot", vin, ""))
+	if response.Status != shim.ERROR {
+		t.Error("Rejecting a proposal without reason should not be possible")
+	}
+
+	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("rejectRegistrationProposal", "dot-user", "dot", vin, "wrong doors"))
+	proposal := RegistrationProposal{}
+	err := json.Unmarshal(response.Payload, &proposal)
+	if err != nil {
+		t.Error(response.Message)
+		return
+	}
+
+	if proposal.Status != "rejected" || proposal.Reason != "wrong doors" {
+		t.Error("Proposal not rejected")
+	}
+
+	// rejected proposals leave the queue and cannot be registered
+	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("readRegistrationProposals", "dot-user", "dot"))
+	proposals := make(map[string]RegistrationProposal)
+	json.Unmarshal(response.Payload, &proposals)
+	if len(proposals) != 0 {
+		t.Error("Rejected proposal should not be in the DOT queue")
+	}
+
+	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("register", "dot-user", "dot", vin, "individual"))
+	if response.Status != shim.ERROR {
+		t.Error("Registering a car with a rejected proposal should not be possible")
+	}
+
+	// the owner sees the reason and resubmits corrected data
+	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("readRegistrationProposal", username, "garage", vin))
+	proposal = RegistrationProposal{}
+	json.Unmarshal(response.Payload, &proposal)
+	if proposal.Reason != "wrong doors" {
+		t.Error("Owner should be able to read the rejection reason")
+	}
+
+	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("resubmitRegistrationProposal", "someone", "user", vin, `{ "numberOfDoors": "4+1" }`))
+	if response.Status != shim.ERROR {
+		t.Error("Only the owner should be able to resubmit a proposal")
+	}
+
+	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("resubmitRegistrationProposal", username, "garage", vin, `{ "numberOfDoors": "4+1" }`))
+	proposal = RegistrationProposal{}
+	json.Unmarshal(response.Payload, &proposal)
+	if proposal.Status != "pending" || proposal.NumberOfDoors != 5 || proposal.Reason != "" {
+		t.Error("Proposal not resubmitted with corrected data")
+	}
+
+	// pending proposals can be withdrawn and resubmitted
+	stub.MockInvoke(uuid, util.ToChaincodeArgs("withdrawRegistrationProposal", username, "garage", vin))
+	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("register", "dot-user", "dot", vin, "individual"))
+	if response.Status != shim.ERROR {
+		t.Error("Registering a car with a withdrawn proposal should not be possible")
+	}
+
+	stub.MockInvoke(uuid, util.ToChaincodeArgs("resubmitRegistrationProposal", username, "garage", vin, `{ "numberOfDoors": "4+1" }`))
+	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("register", "dot-user", "dot", vin, "individual"))
+	if response.Status == shim.ERROR {
+		t.Error(response.Message)
+		return
+	}
+
+	// all decisions are kept in the history
+	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("readRegistrationProposal", "dot-user", "dot", vin))
+	proposal = RegistrationProposal{}
+	json.Unmarshal(response.Payload, &proposal)
+
+	fmt.Printf("Proposal history: %v\n", proposal.History)
+
+	if proposal.Status != "approved" || len(proposal.History) != 6 {
+		t.Error("Proposal decisions not recorded in the history")
+	} else if proposal.History[1].Status != "rejected" || proposal.History[1].By != "dot-user" {
+		t.Error("Wrong rejection in the history")
+	}
+}
+
+func TestProcessRevocationRequests(t *testing.T) {
+	username := "amag"
+	insuranceCompany := "axa"
+	vins := []string{"WVWZZZ6RZHY260780", "WVWZZZ6RZHY260781"}
+	numberplates := []string{"ZH 7878", "ZH 7879"}
+
+	// create and name a new chaincode mock
+	carChaincode := &CarChaincode{}
+	stub := shim.NewMockStub("car", carChaincode)
+
+	ccSetup(t, stub)
+
+	for i, vin := range vins {
+		stub.MockInvoke(uuid, util.ToChaincodeArgs("create", username, "garage", `{ "vin": "`+vin+`" }`))
+		stub.MockInvoke(uuid, util.ToChaincodeArgs("register", "dot-user", "dot", vin, "individual"))
+		stub.MockInvoke(uuid, util.ToChaincodeArgs("insureProposal", username, "user", vin, insuranceCompany))
+		stub.MockInvoke(uuid, util.ToChaincodeArgs("insuranceAccept", "insurance-user", "insurer", username, vin, insuranceCompany))
+		stub.MockInvoke(uuid, util.ToChaincodeArgs("confirm", "dot-user", "dot", vin, numberplates[i]))
+	}
+
+	// the reason has to be a known reason code
+	response := stub.MockInvoke(uuid, util.ToChaincodeArgs("revocationProposal", username, "user", vins[0], "boredom"))
+	if response.Status != shim.ERROR {
+		t.Error("Unknown revocation reasons should be refused")
+	}
+
+	stub.MockInvoke(uuid, util.ToChaincodeArgs("revocationProposal", username, "user", vins[0], "sale"))
+	stub.MockInvoke(uuid, util.ToChaincodeArgs("revocationProposal", username, "user", vins[1], "plateChange"))
+
+	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("readRevocationRequests", "dot-user", "dot"))
+	var requests []RevocationRequest
+	json.Unmarshal(response.Payload, &requests)
+	if len(requests) != 2 || requests[0].Reason != "sale" || requests[0].Requester != username {
+		t.Errorf("Wrong revocation requests: %v", requests)
+	}
+
+	// decide all requests in one batch
+	decisions := `[
+		{ "vin": "` + vins[0] + `", "decision": "approve" },
+		{ "vin": "` + vins[1] + `", "decision": "deny", "comment": "plate change not possible" },
+		{ "vin": "WVWZZZ6RZHY260782", "decision": "approve" }
+	]`
+	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("processRevocationRequests", "dot-user", "dot", decisions))
+	var results []RevocationResult
+	err := json.Unmarshal(response.Payload, &results)
+	if err != nil {
+		t.Error(response.Message)
+		return
+	}
+
+	if len(results) != 3 {
+		t.Errorf("Expected a result per decision, got %v", results)
+		return
+	} else if results[0].Status != "approved" || results[1].Status != "denied" || results[2].Status != "failed" {
+		t.Errorf("Wrong batch results: %v", results)
+	}
+
+	// only the approved car is revoked
+	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("readCar", "dot-user", "dot", vins[0]))
+	car := Car{}
+	json.Unmarshal(response.Payload, &car)
+	if car.Status != "revoked" || car.Certificate.Numberplate != "" {
+		t.Error("Approved revocation should revoke the car")
+	}
+
+	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("readCar", "dot-user", "dot", vins[1]))
+	car = Car{}
+	json.Unmarshal(response.Payload, &car)
+	if car.Status != "confirmed" {
+		t.Error("Denied revocation should keep the car confirmed")
+	}
+
+	// all decided requests are closed
+	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("getRevocationProposals", "dot-user", "dot"))
+	index := make(map[string]string)
+	json.Unmarshal(response.Payload, &index)
+	if len(index) != 0 {
+		t.Error("Decided revocation requests should be closed")
+	}
+
+	// the requester is notified of both outcomes
+	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("readUser", username, "user", username))
+	user := User{}
+	json.Unmarshal(response.Payload, &user)
+	if len(user.Notifications) != 2 {
+		t.Errorf("Expected two notifications, got %v", user.Notifications)
+	} else if user.Notifications[0].Status != "approved" || user.Notifications[1].Status != "denied" || user.Notifications[1].Subject != vins[1] {
+		t.Errorf("Wrong notifications: %v", user.Notifications)
+	}
+}
+
+func TestProcessRevocationRequestsOnPeer(t *testing.T) {
+	username := "amag"
+	insuranceCompany := "axa"
+	vins := []string{"WVWZZZ6RZHY260780", "WVWZZZ6RZHY260781"}
+	numberplates := []string{"ZH 7878", "ZH 7879"}
+
+	// writes only show up in later transactions
+	stub := newPeerStub(t)
+
+	for i, vin := range vins {
+		stub.invoke("create-"+vin, "create", username, "garage", `{ "vin": "`+vin+`" }`)
+		stub.invoke("register-"+vin, "register", "dot-user", "dot", vin, "individual")
+		stub.invoke("propose-"+vin, "insureProposal", username, "garage", vin, insuranceCompany)
+		stub.invoke("accept-"+vin, "insuranceAccept", "insurance-user", "insurer", username, vin, insuranceCompany)
+		stub.invoke("confirm-"+vin, "confirm", "dot-user", "dot", vin, numberplates[i])
+		stub.invoke("revoke-"+vin, "revocationProposal", username, "garage", vin, "sale")
+	}
+
+	decisions := `[
+		{ "vin": "` + vins[0] + `", "decision": "approve", "retain": true },
+		{ "vin": "` + vins[1] + `", "decision": "approve", "retain": true }
+	]`
+	response := stub.invoke("tx1", "processRevocationRequests", "dot-user", "dot", decisions)
+	if response.Status != shim.OK {
+		t.Error(response.Message)
+		return
+	}
+
+	// every item of the batch sticks
+	requests, _ := stub.cc.getRevocationRequests(stub)
+	if len(requests) != 0 {
+		t.Errorf("Decided revocation requests should be closed: %v", requests)
+	}
+
+	plates, _ := stub.cc.getNumberplateIndex(stub)
+	for _, numberplate := range numberplates {
+		plate := plates[numberplate]
+		if len(plate.Vins) != 0 || plate.RetainedUntil == 0 {
+			t.Errorf("Numberplate not released: %v", plate)
+		}
+	}
+
+	user, _ := stub.cc.getUser(stub, username)
+	if len(user.Notifications) != 2 {
+		t.Errorf("Expected two notifications, got %v", user.Notifications)
+	}
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+/*
+ * Returns the fee schedule of the DOT
+ */
+func (t *CarChaincode) getFeeSchedule(stub shim.ChaincodeStubInterface) (FeeSchedule, error) {
+	response := t.read(stub, feeScheduleStr)
+	var fees FeeSchedule
+	err := json.Unmarshal(response.Payload, &fees)
+	if err != nil {
+		return FeeSchedule{}, errors.New("Error parsing fee schedule")
+	}
+
+	return fees, nil
+}
+
+/*
+ * Writes the fee schedule to the ledger
+ */
+func (t *CarChaincode) saveFeeSchedule(stub shim.ChaincodeStubInterface, fees FeeSchedule) error {
+	feesAsBytes, _ := json.Marshal(fees)
+	err := stub.PutState(feeScheduleStr, feesAsBytes)
+	if err != nil {
+		return errors.New("Error writing fee schedule")
+	}
+
+	return nil
+}
+
+/*
+ * Reads the fee schedule.
+ *
+ * Everybody is allowed to know the fees in advance.
+ */
+func (t *CarChaincode) readFeeSchedule(stub shim.ChaincodeStubInterface) pb.Response {
+	fees, err := t.getFeeSchedule(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	feesAsBytes, _ := json.Marshal(fees)
+	return shim.Success(feesAsBytes)
+}
+
+/*
+ * Replaces the fee schedule.
+ *
+ * Expects 'feesAsJson':
+ *  FeeSchedule              json
+ *
+ * On success,
+ * returns the new fee schedule.
+ */
+func (t *CarChaincode) setFeeSchedule(stub shim.ChaincodeStubInterface, feesAsJson string) pb.Response {
+	var fees FeeSchedule
+	err := json.Unmarshal([]byte(feesAsJson), &fees)
+	if err != nil {
+		return shim.Error("Error parsing fee schedule. Expecting FeeSchedule as json.")
+	}
+
+	// fee input sanitation
+	if fees.Registration.Amount < 0 || fees.Confirmation.Amount < 0 || fees.VanityPlate.Amount < 0 {
+		return shim.Error("Fees cannot be negative")
+	} else if fees.SalesTax < 0 || fees.SalesTax > 100 {
+		return shim.Error("Sales tax has to be a percentage between 0 and 100")
+	}
+
+	// fees are collected into the treasury,
+	// they have to be in its currency
+	treasury, err := t.getUser(stub, treasuryUsername)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	currency := treasury.Balance.currency()
+	for _, fee := range []Money{fees.Registration, fees.Confirmation, fees.VanityPlate} {
+		if fee.currency() != currency {
+			return shim.Error(fmt.Sprintf("Fees have to be in %s, the currency of the treasury", currency))
+		}
+	}
+
+	err = t.saveFeeSchedule(stub, fees)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	feesAsBytes, _ := json.Marshal(fees)
+	return shim.Success(feesAsBytes)
+}
+
+/*
+ * Charges a fee from a user and collects it
+ * into the DOT treasury.
+ *
+ * A receipt of the payment is handed to the payer,
+ * who finds it among the own receipts.
+ * Like car purchases, fees can be paid on credit.
+ * A zero amount is not charged at all.
+ *
+ * Payer and treasury are changed in 'users',
+ * the caller writes them back to the ledger.
+ */
+func (t *CarChaincode) chargeFee(stub shim.ChaincodeStubInterface, users map[string]*User, payer string, fee string, vin string, amount Money) error {
+	if amount.Amount == 0 {
+		return nil
+	}
+
+	user, err := t.loadUser(stub, users, payer)
+	if err != nil {
+		return err
+	}
+
+	treasury, err := t.loadUser(stub, users, treasuryUsername)
+	if err != nil {
+		return err
+	}
+
+	// move the money
+	entry, err := t.transfer(stub, user, treasury, amount, fee, vin)
+	if err != nil {
+		return err
+	}
+
+	receipt := FeeReceipt{
+		Payer:     payer,
+		Fee:       fee,
+		Vin:       vin,
+		Amount:    amount,
+		CreatedTs: entry.CreatedTs,
+		TxId:      entry.TxId}
+
+	// hand out the receipt
+	user.Receipts = append(user.Receipts, receipt)
+
+	fmt.Printf("Charged %s fee of %s from user '%s' for car '%s'\n", fee, amount, payer, vin)
+	return nil
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/hyperledger/fabric/common/util"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+func TestFeeCollection(t *testing.T) {
+	username := "amag"
+	buyer := "bobby"
+	vin := "WVWZZZ6RZHY260780"
+	numberplate := "ZH 7878"
+	insuranceCompany := "axa"
+	fees := `{ "registration": { "amount": 5000, "currency": "CHF" },
+	          "confirmation": { "amount": 3000, "currency": "CHF" },
+	          "salesTax": 10 }`
+
+	// create and name a new chaincode mock
+	carChaincode := &CarChaincode{}
+	stub := shim.NewMockStub("car", carChaincode)
+
+	ccSetup(t, stub)
+
+	// only the DOT can set fees
+	response := stub.MockInvoke(uuid, util.ToChaincodeArgs("setFeeSchedule", username, "user", fees))
+	if response.Status != shim.ERROR {
+		t.Error("Setting fees as 'user' should not be possible")
+	}
+
+	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("setFeeSchedule", "dot-user", "dot", `{ "salesTax": 101 }`))
+	if response.Status != shim.ERROR {
+		t.Error("Sales tax above 100 percent should be rejected")
+	}
+
+	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("setFeeSchedule", "dot-user", "dot", `{ "registration": "50 EUR" }`))
+	if response.Status != shim.ERROR {
+		t.Error("Fees in another currency than the treasury should be rejected")
+	}
+
+	stub.MockInvoke(uuid, util.ToChaincodeArgs("setFeeSchedule", "dot-user", "dot", fees))
+
+	// everybody can read the fees
+	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("readFeeSchedule", username, "user"))
+	schedule := FeeSchedule{}
+	err := json.Unmarshal(response.Payload, &schedule)
+	if err != nil || schedule.Registration != NewMoney(5000) {
+		t.Error("Error reading fee schedule")
+	}
+
+	// create, register, insure and confirm a car
+	carData := `{ "vin": "` + vin + `" }`
+	stub.MockInvoke(uuid, util.ToChaincodeArgs("create", username, "garage", carData))
+	stub.MockInvoke(uuid, util.ToChaincodeArgs("register", "dot-user", "dot", vin, "individual"))
+	stub.MockInvoke(uuid, util.ToChaincodeArgs("insureProposal", username, "user", vin, insuranceCompany))
+	stub.MockInvoke(uuid, util.ToChaincodeArgs("insuranceAccept", "insurance-user", "insurer", username, vin, insuranceCompany))
+	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("confirm", "dot-user", "dot", vin, numberplate))
+	if response.Status == shim.ERROR {
+		t.Error(response.Message)
+		return
+	}
+
+	// the owner paid registration and confirmation fees
+	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("readUser", username, "garage"))
+	user := User{}
+	err = json.Unmarshal(response.Payload, &user)
+	if err != nil {
+		t.Error("Error reading user")
+		return
+	}
+
+	fmt.Printf("Fee receipts: %v\n", user.Receipts)
+
+	if user.Balance != NewMoney(-8000) {
+		t.Error("Registration and confirmation fees not charged")
+	} else if len(user.Receipts) != 2 || user.Receipts[0].Fee != "registration" {
+		t.Error("Fee receipts not handed out")
+	}
+
+	// revoke and sell the car, the buyer pays the sales tax
+	stub.MockInvoke(uuid, util.ToChaincodeArgs("revoke", "dot-user", "dot", vin))
+	stub.MockInvoke(uuid, util.ToChaincodeArgs("createUser", username, "garage", buyer))
+	stub.MockInvoke(uuid, util.ToChaincodeArgs("createSellingOffer", username, "garage", "1000", vin, buyer))
+	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("sell", username, "garage", vin, buyer))
+	if response.Status == shim.ERROR {
+		t.Error(response.Message)
+		return
+	}
+
+	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("readUser", buyer, "user"))
+	user = User{}
+	json.Unmarshal(response.Payload, &user)
+	if user.Balance != NewMoney(-110000) {
+		t.Error("Sales tax not charged from buyer")
+	}
+
+	// all fees end up in the treasury
+	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("readTreasury", "dot-user", "dot"))
+	treasury := User{}
+	err = json.Unmarshal(response.Payload, &treasury)
+	if err != nil {
+		t.Error("Error reading treasury")
+	} else if treasury.Balance != NewMoney(18000) {
+		t.Error("Fees not collected into the treasury")
+	}
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// new cars are inspected for the first time after four years,
+// then every two years
+const firstInspectionPeriod int64 = 4 * 365 * 24 * 60 * 60
+const inspectionPeriod int64 = 2 * 365 * 24 * 60 * 60
+
+/*
+ * Returns the due date of the next inspection (MFK).
+ *
+ * Without inspection records, the first inspection
+ * is due a few years after the car was created.
+ */
+func NextInspectionDue(car *Car) int64 {
+	if len(car.Inspections) == 0 {
+		return car.CreatedTs + firstInspectionPeriod
+	}
+
+	return car.Inspections[len(car.Inspections)-1].NextDueTs
+}
+
+/*
+ * Checks for an overdue inspection at a point in time.
+ *
+ * Cars with an overdue inspection are suspended
+ * until a passing inspection is recorded.
+ */
+func IsInspectionOverdue(car *Car, ts int64) bool {
+	overdue := NextInspectionDue(car) <= ts
+
+	if overdue {
+		fmt.Printf("Car with VIN '%s' is overdue for inspection\n", car.Vin)
+	}
+
+	return overdue
+}
+
+/*
+ * Returns the garages certified for inspections.
+ */
+func (t *CarChaincode) getCertifiedGarages(stub shim.ChaincodeStubInterface) (map[string]string, error) {
+	response := t.read(stub, certifiedGarageIndexStr)
+	garageIndex := make(map[string]string)
+	err := json.Unmarshal(response.Payload, &garageIndex)
+	if err != nil {
+		return nil, errors.New("Error parsing certified garage index")
+	}
+
+	return garageIndex, nil
+}
+
+/*
+ * Certifies a garage for inspections
+ * or withdraws the certification.
+ *
+ * On success,
+ * returns the certified garage index.
+ */
+func (t *CarChaincode) certifyGarage(stub shim.ChaincodeStubInterface, username string, garage string, certified bool) pb.Response {
+	if garage == "" {
+		return shim.Error("'certifyGarage' expects a non-empty garage name")
+	}
+
+	garageIndex, err := t.getCertifiedGarages(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	if certified {
+		// remember which DOT user certified the garage
+		garageIndex[garage] = username
+	} else if _, exists := garageIndex[garage]; !exists {
+		return shim.Error(fmt.Sprintf("Garage '%s' is not certified", garage))
+	} else {
+		delete(garageIndex, garage)
+	}
+
+	indexAsBytes, _ := json.Marshal(garageIndex)
+	err = stub.PutState(certifiedGarageIndexStr, indexAsBytes)
+	if err != nil {
+		return shim.Error("Error writing certified garage index")
+	}
+
+	return shim.Success(indexAsBytes)
+}
+
+/*
+ * Records a periodic inspection (MFK) of a car.
+ *
+ * Inspections are entered by the DOT or by certified
+ * garages. Passed inspections are next due after the
+ * inspection period unless an earlier due date is given.
+ * Failed inspections are due immediately, the car is
+ * suspended until it passes an inspection.
+ *
+ * Arguments required:
+ * [0] Vin                  (string)
+ * [1] Inspection           (json, result 'passed' or 'failed')
+ *
+ * On success,
+ * returns the car.
+ */
+func (t *CarChaincode) recordInspection(stub shim.ChaincodeStubInterface, username string, role string, args []string) pb.Response {
+	vin := args[0]
+
+	// garages need a certification by the DOT
+	if role == "garage" {
+		garageIndex, err := t.getCertifiedGarages(stub)
+		if err != nil {
+			return shim.Error(err.Error())
+		} else if _, certified := garageIndex[username]; !certified {
+			return shim.Error(fmt.Sprintf("Garage '%s' is not certified for inspections", username))
+		}
+	}
+
+	inspection := Inspection{}
+	err := json.Unmarshal([]byte(args[1]), &inspection)
+	if err != nil {
+		return shim.Error("Error parsing inspection. Expecting Inspection as json.")
+	}
+
+	car, err := t.getCarAsDot(stub, vin)
+	if err != nil {
+		return shim.Error(err.Error())
+	} else if !IsRegistered(&car) {
+		return shim.Error("Only registered cars can be inspected")
+	} else if IsDisposed(&car) {
+		return shim.Error(fmt.Sprintf("Car with VIN '%s' is %s", vin, CarStatus(&car)))
+	}
+
+	now := txTimestamp(stub)
+	inspection.Inspector = username
+	inspection.InspectedTs = now
+	inspection.TxId = stub.GetTxID()
+
+	switch inspection.Result {
+	case "passed":
+		if inspection.NextDueTs == 0 || inspection.NextDueTs > now+inspectionPeriod {
+			inspection.NextDueTs = now + inspectionPeriod
+		} else if inspection.NextDueTs <= now {
+			return shim.Error("The next inspection of a passed car has to be due in the future")
+		}
+	case "failed":
+		if len(inspection.Defects) == 0 {
+			return shim.Error("A failed inspection has to list the defects")
+		}
+		inspection.NextDueTs = now
+	default:
+		return shim.Error("Inspection result has to be 'passed' or 'failed'")
+	}
+
+	car.Inspections = append(car.Inspections, inspection)
+
+	carAsBytes, _ := json.Marshal(car)
+	err = stub.PutState(car.Vin, carAsBytes)
+	if err != nil {
+		return shim.Error("Error writing car")
+	}
+
+	fmt.Printf("Inspection of car with VIN '%s' %s, next inspection due at '%d'\n", vin, inspection.Result, inspection.NextDueTs)
+	return shim.Success(carAsBytes)
+}
+
+/*
+ * Returns all cars on the road with an overdue inspection.
+ *
+ * On success,
+ * returns a list with overdue cars.
+ */
+func (t *CarChaincode) getOverdueCars(stub shim.ChaincodeStubInterface) pb.Response {
+	carIndex, err := t.getCarIndex(stub)
+	if err != nil {
+		return shim.Error("Error getting car index")
+	}
+
+	now := txTimestamp(stub)
+	overdueCars := []Car{}
+	for vin := range carIndex {
+		car, err := t.getCarAsDot(stub, vin)
+		if err != nil {
+			return shim.Error("Error getting car")
+		}
+
+		// only cars with a numberplate need an inspection
+		if car.Certificate.Numberplate != "" && IsInspectionOverdue(&car, now) {
+			overdueCars = append(overdueCars, car)
+		}
+	}
+
+	overdueCarsAsBytes, _ := json.Marshal(overdueCars)
+	return shim.Success(overdueCarsAsBytes)
+}
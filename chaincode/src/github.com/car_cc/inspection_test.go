@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric/common/util"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+func TestInspections(t *testing.T) {
+	username := "amag"
+	garage := "auto-meier"
+	vin := "WVWZZZ6RZHY260780"
+	numberplate := "ZH 7878"
+	insuranceCompany := "axa"
+
+	// create and name a new chaincode mock
+	carChaincode := &CarChaincode{}
+	stub := shim.NewMockStub("car", carChaincode)
+
+	ccSetup(t, stub)
+
+	stub.MockInvoke(uuid, util.ToChaincodeArgs("create", username, "garage", `{ "vin": "`+vin+`" }`))
+	stub.MockInvoke(uuid, util.ToChaincodeArgs("register", "dot-user", "dot", vin, "individual"))
+	stub.MockInvoke(uuid, util.ToChaincodeArgs("insureProposal", username, "user", vin, insuranceCompany))
+	stub.MockInvoke(uuid, util.ToChaincodeArgs("insuranceAccept", "insurance-user", "insurer", username, vin, insuranceCompany))
+	stub.MockInvoke(uuid, util.ToChaincodeArgs("confirm", "dot-user", "dot", vin, numberplate))
+
+	// only certified garages can record inspections
+	failed := `{ "result": "failed", "defects": ["brakes worn"] }`
+	response := stub.MockInvoke(uuid, util.ToChaincodeArgs("recordInspection", garage, "garage", vin, failed))
+	if response.Status != shim.ERROR {
+		t.Error("Uncertified garages should not record inspections")
+	}
+
+	stub.MockInvoke(uuid, util.ToChaincodeArgs("certifyGarage", "dot-user", "dot", garage))
+
+	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("recordInspection", garage, "garage", vin, `{ "result": "failed" }`))
+	if response.Status != shim.ERROR {
+		t.Error("Failed inspections should list the defects")
+	}
+
+	// a failed inspection suspends the car
+	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("recordInspection", garage, "garage", vin, failed))
+	car := Car{}
+	err := json.Unmarshal(response.Payload, &car)
+	if err != nil {
+		t.Error(response.Message)
+		return
+	}
+
+	if IsConfirmed(&car, time.Now().Unix()) {
+		t.Error("Car with a failed inspection should be suspended")
+	} else if !HasNumberplate(&car) {
+		t.Error("Suspended car should keep its numberplate")
+	} else if car.Inspections[0].Inspector != garage {
+		t.Error("Inspector not recorded")
+	}
+
+	// the suspended car still carries its plate and cannot change hands
+	stub.MockInvoke(uuid, util.ToChaincodeArgs("createUser", "bobby", "user", "bobby"))
+	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("setKeeper", username, "garage", vin, "bobby"))
+	if response.Status != shim.ERROR {
+		t.Error("Suspended car should not get a new keeper with its plate")
+	}
+
+	stub.MockInvoke(uuid, util.ToChaincodeArgs("createSellingOffer", username, "garage", "1000", vin, "bobby"))
+	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("sell", username, "garage", vin, "bobby"))
+	if response.Status != shim.ERROR {
+		t.Error("Suspended car should not be sold with its plate")
+	}
+
+	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("getOverdueCarsAsList", "dot-user", "dot"))
+	var overdueCars []Car
+	json.Unmarshal(response.Payload, &overdueCars)
+	if len(overdueCars) != 1 || overdueCars[0].Vin != vin {
+		t.Error("Suspended car missing in the overdue list")
+	}
+
+	// passing the inspection lifts the suspension
+	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("recordInspection", "dot-user", "dot", vin, `{ "result": "passed" }`))
+	car = Car{}
+	json.Unmarshal(response.Payload, &car)
+	if !IsConfirmed(&car, time.Now().Unix()) || NextInspectionDue(&car) != car.Inspections[1].InspectedTs+inspectionPeriod {
+		t.Error("Passed inspection should lift the suspension")
+	}
+
+	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("getOverdueCarsAsList", "dot-user", "dot"))
+	overdueCars = nil
+	json.Unmarshal(response.Payload, &overdueCars)
+	if len(overdueCars) != 0 {
+		t.Error("Inspected car should not be overdue")
+	}
+
+	// without certification, the garage cannot inspect anymore
+	stub.MockInvoke(uuid, util.ToChaincodeArgs("revokeGarageCertification", "dot-user", "dot", garage))
+	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("recordInspection", garage, "garage", vin, `{ "result": "passed" }`))
+	if response.Status != shim.ERROR {
+		t.Error("Garage certification not withdrawn")
+	}
+}
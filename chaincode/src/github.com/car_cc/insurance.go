@@ -4,12 +4,40 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"sort"
 	"strings"
 
 	"github.com/hyperledger/fabric/core/chaincode/shim"
 	pb "github.com/hyperledger/fabric/protos/peer"
 )
 
+// unanswered insurance proposals expire after 30 days
+const insureProposalMaxAge int64 = 30 * 24 * 60 * 60
+
+/*
+ * Returns the status of an insurance proposal at a point in time.
+ *
+ * Pending proposals older than 'insureProposalMaxAge' are expired,
+ * quoted proposals expire with their last valid quote.
+ * Proposals recorded without a status or creation time are pending.
+ */
+func InsureProposalStatus(proposal *InsureProposal, ts int64) string {
+	if proposal.Status != "" && proposal.Status != "pending" {
+		return proposal.Status
+	} else if len(proposal.Quotes) > 0 {
+		for _, quote := range proposal.Quotes {
+			if ts < quote.ValidUntil {
+				return "pending"
+			}
+		}
+		return "expired"
+	} else if proposal.CreatedTs > 0 && ts-proposal.CreatedTs >= insureProposalMaxAge {
+		return "expired"
+	}
+
+	return "pending"
+}
+
 /*
  * Checks for an active car insurance.
  *
@@ -22,14 +50,19 @@ import (
  * occur when changing numberplates.
  *
  * In any case, the car has to be registered before it can be insured.
+ * Cars with insurance policies need a policy active at the given time,
+ * older cars only name their insurer.
  */
-func IsInsured(car *Car) bool {
+func IsInsured(car *Car, ts int64) bool {
 	// cannot be insured without car papers
 	if !IsRegistered(car) {
 		return false
 	}
 
 	insured := car.Certificate.Insurer != ""
+	if len(car.Policies) > 0 {
+		insured = insured && CurrentPolicy(car, ts) != nil
+	}
 
 	if insured {
 		fmt.Printf("Car with VIN '%s' is insured by company '%s'\n", car.Vin, car.Certificate.Insurer)
@@ -54,8 +87,204 @@ func (t *CarChaincode) getInsurerIndex(stub shim.ChaincodeStubInterface) (map[st
 	return insurerIndex, nil
 }
 
+/*
+ * Returns the names of all insurers in alphabetical order.
+ *
+ * Map iteration order is random, but all endorsing peers
+ * have to notify applicants in the same order.
+ */
+func sortedInsurers(insurerIndex map[string]Insurer) []string {
+	companies := make([]string, 0, len(insurerIndex))
+	for company := range insurerIndex {
+		companies = append(companies, company)
+	}
+	sort.Strings(companies)
+
+	return companies
+}
+
+/*
+ * Records the outcome of an insurance proposal for the applicant in 'users'.
+ *
+ * Accepted proposals show on the insured car, the applicant
+ * is only notified if the car was not insured.
+ */
+func (t *CarChaincode) closeInsureProposal(stub shim.ChaincodeStubInterface, users map[string]*User, company string, proposal InsureProposal, status string, reason string) {
+	user, err := t.loadUser(stub, users, proposal.User)
+	if err != nil {
+		fmt.Printf("Dropped insurance proposal outcome for unknown user '%s'\n", proposal.User)
+		return
+	}
+
+	now := txTimestamp(stub)
+	for i := range user.InsureProposals {
+		own := &user.InsureProposals[i]
+		if own.Car == proposal.Car && own.Company == company && (own.Status == "" || own.Status == "pending") {
+			own.Status = status
+			own.Reason = reason
+			own.DecidedTs = now
+		}
+	}
+
+	if status == "accepted" {
+		return
+	}
+
+	t.notify(stub, users, proposal.User, Notification{
+		Type:    "insureProposal",
+		Subject: proposal.Car,
+		Status:  status,
+		Message: fmt.Sprintf("Insurance proposal to '%s': %s", company, reason)})
+}
+
+/*
+ * Removes all pending insurance proposals for a car
+ * from all insurers. The applicants in 'users' are told the reason.
+ */
+func (t *CarChaincode) clearInsureProposals(stub shim.ChaincodeStubInterface, users map[string]*User, vin string, reason string) error {
+	insurerIndex, err := t.getInsurerIndex(stub)
+	if err != nil {
+		return errors.New("Error getting insurer index.")
+	}
+
+	for _, company := range sortedInsurers(insurerIndex) {
+		insurer := insurerIndex[company]
+		var newProposals []InsureProposal
+		for _, insProposal := range insurer.Proposals {
+			if insProposal.Car != vin {
+				newProposals = append(newProposals, insProposal)
+			} else {
+				t.closeInsureProposal(stub, users, company, insProposal, "cancelled", reason)
+			}
+		}
+		insurer.Proposals = newProposals
+		insurerIndex[company] = insurer
+	}
+
+	// write insurer index to ledger
+	indexAsBytes, _ := json.Marshal(insurerIndex)
+	err = stub.PutState(insurerIndexStr, indexAsBytes)
+	if err != nil {
+		return errors.New("Error writing insurer index")
+	}
+
+	return nil
+}
+
+/*
+ * Charges the premium of a policy from the keeper
+ * to the insurer account. The balance of the keeper
+ * has to cover the premium.
+ *
+ * Keeper and insurer account are changed in 'users',
+ * the caller writes them back to the ledger.
+ */
+func (t *CarChaincode) chargePremium(stub shim.ChaincodeStubInterface, users map[string]*User, keeper string, company string, policy *InsurancePolicy) error {
+	if policy.Premium.Amount == 0 {
+		return nil
+	}
+
+	user, err := t.loadUser(stub, users, keeper)
+	if err != nil {
+		return err
+	} else if !user.Balance.Covers(policy.Premium) {
+		return errors.New("Insufficient balance for the premium")
+	}
+
+	insurer, err := t.openInsurerAccount(stub, users, company)
+	if err != nil {
+		return err
+	}
+
+	reference := policy.Id
+	if policy.QuoteId != "" {
+		reference = policy.QuoteId
+	}
+
+	_, err = t.transfer(stub, user, insurer, policy.Premium, "premium", reference)
+	return err
+}
+
+/*
+ * Checks that an insurer user acts for an insurance company.
+ *
+ * Insurer users are assigned to their company
+ * by the federal office with 'assignInsurer'.
+ */
+func (t *CarChaincode) checkInsurer(stub shim.ChaincodeStubInterface, username string, company string) error {
+	insurerIndex, err := t.getInsurerIndex(stub)
+	if err != nil {
+		return err
+	}
+
+	for _, member := range insurerIndex[strings.ToLower(company)].Members {
+		if member == username {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("Insurer user '%s' does not act for '%s'", username, company)
+}
+
+/*
+ * Assigns an insurer user to an insurance company.
+ *
+ * Only the federal office assigns insurer users.
+ *
+ * Arguments required:
+ * [0] Insurer username     (string)
+ * [1] Insurance company    (string)
+ *
+ * On success,
+ * returns the insurer.
+ */
+func (t *CarChaincode) assignInsurer(stub shim.ChaincodeStubInterface, username string, args []string) pb.Response {
+	insurerUser := args[0]
+	company := strings.ToLower(args[1])
+	if insurerUser == "" || company == "" {
+		return shim.Error("'assignInsurer' expects a non-empty insurer username and insurance company")
+	}
+
+	authority, err := t.getAuthority(stub, username)
+	if err != nil {
+		return shim.Error(err.Error())
+	} else if authority != "" {
+		return shim.Error(fmt.Sprintf("Only the federal office can assign insurers, '%s' acts for canton %s", username, authority))
+	}
+
+	insurerIndex, err := t.getInsurerIndex(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	insurer, insurerExisting := insurerIndex[company]
+	if !insurerExisting {
+		insurer = Insurer{Name: company}
+	}
+
+	assigned := false
+	for _, member := range insurer.Members {
+		assigned = assigned || member == insurerUser
+	}
+	if !assigned {
+		insurer.Members = append(insurer.Members, insurerUser)
+	}
+	insurerIndex[company] = insurer
+
+	indexAsBytes, _ := json.Marshal(insurerIndex)
+	err = stub.PutState(insurerIndexStr, indexAsBytes)
+	if err != nil {
+		return shim.Error("Error writing insurer index")
+	}
+
+	insurerAsBytes, _ := json.Marshal(insurer)
+	return shim.Success(insurerAsBytes)
+}
+
 /*
  * Returns an insurer with a list of insurance proposals.
+ *
+ * Expired proposals are left out.
  */
 func (t *CarChaincode) getInsurer(stub shim.ChaincodeStubInterface, company string) pb.Response {
 
@@ -69,6 +298,14 @@ func (t *CarChaincode) getInsurer(stub shim.ChaincodeStubInterface, company stri
 	}
 
 	ret := insurerIndex[company]
+	now := txTimestamp(stub)
+	var pending []InsureProposal
+	for _, proposal := range ret.Proposals {
+		if InsureProposalStatus(&proposal, now) == "pending" {
+			pending = append(pending, proposal)
+		}
+	}
+	ret.Proposals = pending
 	retAsBytes, _ := json.Marshal(ret)
 	return shim.Success(retAsBytes)
 }
@@ -78,52 +315,131 @@ func (t *CarChaincode) getInsurer(stub shim.ChaincodeStubInterface, company stri
  * and creates an insurance contract. The proposal
  * will be removed from the ledger afterwards.
  *
+ * The insurance contract is made with the keeper of the car.
  * The car needs to be registered.
  * A car numberplate (confirmation) is not required.
+ * The contract is recorded as insurance policy on the car,
+ * with optional terms (coverage, premium, start and end).
+ * Quotes are bound by the applicant with 'bindQuote' only.
  *
  * On success,
  * returns the removed insurance proposal
  */
-func (t *CarChaincode) insuranceAccept(stub shim.ChaincodeStubInterface, username string, vin string, company string) pb.Response {
+func (t *CarChaincode) insuranceAccept(stub shim.ChaincodeStubInterface, username string, vin string, company string, termsArg string) pb.Response {
+
+	// parse the policy terms, if provided
+	terms := InsurancePolicy{}
+	if termsArg != "" {
+		err := json.Unmarshal([]byte(termsArg), &terms)
+		if err != nil {
+			return shim.Error("Error parsing policy terms. Expecting InsurancePolicy as json.")
+		}
+	}
+
+	if terms.QuoteId != "" {
+		return shim.Error("Quotes can only be bound by the applicant")
+	}
+
+	proposal, _, err := t.acceptInsureProposal(stub, username, vin, company, terms)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	proposalAsBytes, _ := json.Marshal(proposal)
+	return shim.Success(proposalAsBytes)
+}
+
+/*
+ * Accepts an insurance proposal with the given terms.
+ *
+ * The keeper is charged the premium of the new policy,
+ * the balance has to cover it.
+ *
+ * Returns the removed insurance proposal and the new policy.
+ */
+func (t *CarChaincode) acceptInsureProposal(stub shim.ChaincodeStubInterface, username string, vin string, company string, terms InsurancePolicy) (InsureProposal, InsurancePolicy, error) {
 
 	// lowercase insurance company string
 	company = strings.ToLower(company)
 
-	car, err := t.getCar(stub, username, vin)
+	car, err := t.getCarAsKeeper(stub, username, vin)
 	if err != nil {
-		return shim.Error("Error fetching car")
+		return InsureProposal{}, InsurancePolicy{}, errors.New("Error fetching car")
 	}
 
 	insurerIndex, err := t.getInsurerIndex(stub)
 	if err != nil {
-		return shim.Error("Error fetching insurer index")
+		return InsureProposal{}, InsurancePolicy{}, errors.New("Error fetching insurer index")
 	}
 
+	users := make(map[string]*User)
 	insurer := insurerIndex[company]
 	proposals := insurer.Proposals
 	validProposal := InsureProposal{}
+	validPolicy := InsurancePolicy{}
 	var newProposals []InsureProposal
 	for i, proposal := range proposals {
 		newProposals = append(newProposals, proposal)
 
 		if proposal.Car == vin && proposal.User == username {
+			// unanswered proposals expire
+			if InsureProposalStatus(&proposal, txTimestamp(stub)) == "expired" {
+				return InsureProposal{}, InsurancePolicy{}, fmt.Errorf("The insurance proposal for car '%s' has expired", vin)
+			}
+
 			// check if we can create an insurance contract
 			// we can only create an insurance contract,
 			// if we are sure the car VIN is approved by the DOT
 			if !IsRegistered(&car) {
-				return shim.Error("Go register your car first")
+				return InsureProposal{}, InsurancePolicy{}, errors.New("Go register your car first")
+			}
+
+			// the terms have to make a valid policy
+			policy, err := newPolicy(stub, &car, company, terms)
+			if err != nil {
+				return InsureProposal{}, InsurancePolicy{}, err
+			}
+
+			// a change of insurer keeps the status,
+			// otherwise the car becomes insured
+			status := CarStatus(&car)
+			if status != "insured" && status != "confirmed" {
+				err = transitionCar(stub, &car, "insured", company, "insuranceAccept")
+				if err != nil {
+					return InsureProposal{}, InsurancePolicy{}, err
+				}
+			}
+
+			// a deregistered car returns to its owner's active cars
+			if status == "deregistered" {
+				err = t.setCarActive(stub, users, vin, true)
+				if err != nil {
+					return InsureProposal{}, InsurancePolicy{}, err
+				}
 			}
 
+			// replace earlier policies by the new one
+			cancelPolicies(&car, txTimestamp(stub))
+			car.Policies = append(car.Policies, policy)
+
 			// insure the car
 			car.Certificate.Insurer = company
 			carAsBytes, err := json.Marshal(car)
 			err = stub.PutState(car.Vin, carAsBytes)
 			if err != nil {
-				return shim.Error("Error writing car")
+				return InsureProposal{}, InsurancePolicy{}, errors.New("Error writing car")
+			}
+
+			// the keeper pays the premium to the insurer,
+			// the proposal is closed on the same user below
+			err = t.chargePremium(stub, users, username, company, &policy)
+			if err != nil {
+				return InsureProposal{}, InsurancePolicy{}, err
 			}
 
 			// remove proposal
 			validProposal = proposal
+			validPolicy = policy
 			newProposals = newProposals[:i]
 		}
 	}
@@ -132,13 +448,19 @@ func (t *CarChaincode) insuranceAccept(stub shim.ChaincodeStubInterface, usernam
 	insurer.Proposals = newProposals
 	insurerIndex[company] = insurer
 
+	// tell the applicant
+	if validProposal.Car != "" {
+		t.closeInsureProposal(stub, users, company, validProposal, "accepted", "The car is insured")
+	}
+
 	// create an empty index which will hold the new insurer
 	// index, but without competing insurance proposals from
 	// other companies on the same username and vin combination
 	indexWithoutCompetingProposals := make(map[string]Insurer)
 
 	// remove all other proposals for this user and vin
-	for companyName, competitorInsurance := range insurerIndex {
+	for _, companyName := range sortedInsurers(insurerIndex) {
+		competitorInsurance := insurerIndex[companyName]
 		var newCompetitorProposals []InsureProposal
 		for _, proposal := range competitorInsurance.Proposals {
 			if proposal.User == username && proposal.Car == vin {
@@ -147,6 +469,7 @@ func (t *CarChaincode) insuranceAccept(stub shim.ChaincodeStubInterface, usernam
 				// remove this proposal, because the car is now
 				// insured and we remove the possibility of this other
 				// cmpy to accept this proposal
+				t.closeInsureProposal(stub, users, companyName, proposal, "cancelled", "The car was insured by '"+company+"'")
 			} else {
 				newCompetitorProposals = append(newCompetitorProposals, proposal)
 			}
@@ -155,22 +478,27 @@ func (t *CarChaincode) insuranceAccept(stub shim.ChaincodeStubInterface, usernam
 		indexWithoutCompetingProposals[companyName] = competitorInsurance
 	}
 
+	err = t.saveUsers(stub, users)
+	if err != nil {
+		return InsureProposal{}, InsurancePolicy{}, err
+	}
+
 	// write udpated insurer index back to ledger
 
 	indexAsBytes, _ := json.Marshal(indexWithoutCompetingProposals)
 	err = stub.PutState(insurerIndexStr, indexAsBytes)
 	if err != nil {
-		return shim.Error("Error writing insurer index")
+		return InsureProposal{}, InsurancePolicy{}, errors.New("Error writing insurer index")
 	}
 
-	propAsBytes, _ := json.Marshal(validProposal)
-	return shim.Success(propAsBytes)
+	return validProposal, validPolicy, nil
 }
 
 /*
  * Creates an insurance proposal for an insurance
  * company 'company' and a car with 'vin'.
  *
+ * Only the keeper of the car can ask for insurance.
  * The car does not need to be registered.
  * A car numberplate is not required.
  * The proposal will be recorded even if no
@@ -184,6 +512,17 @@ func (t *CarChaincode) insureProposal(stub shim.ChaincodeStubInterface, username
 	// lowercase insurance company string
 	company = strings.ToLower(company)
 
+	// only the keeper can insure the car,
+	// stolen cars cannot be insured
+	car, err := t.getCarAsKeeper(stub, username, vin)
+	if err != nil {
+		return shim.Error(err.Error())
+	} else if IsStolen(&car) {
+		return shim.Error(fmt.Sprintf("Car with VIN '%s' is reported stolen", vin))
+	} else if IsDisposed(&car) {
+		return shim.Error(fmt.Sprintf("Car with VIN '%s' is %s", vin, CarStatus(&car)))
+	}
+
 	// load all insurers
 	insurerIndex, err := t.getInsurerIndex(stub)
 	if err != nil {
@@ -201,19 +540,41 @@ func (t *CarChaincode) insureProposal(stub shim.ChaincodeStubInterface, username
 	}
 
 	// check if there is already a proposal
-	// for this car and this insurance company
+	// for this car and this insurance company,
+	// an expired proposal is replaced
+	now := txTimestamp(stub)
+	users := make(map[string]*User)
+	var proposals []InsureProposal
 	for _, proposal := range insurer.Proposals {
-		if proposal.Car == vin {
+		if proposal.Car != vin {
+			proposals = append(proposals, proposal)
+		} else if InsureProposalStatus(&proposal, now) != "expired" {
 			return shim.Error("You have already submitted an inquiry for this car '" + vin + "' to the insurance company '" + company + "'.")
+		} else {
+			t.closeInsureProposal(stub, users, company, proposal, "expired", "The proposal was not answered in time")
 		}
 	}
 
 	// create the proposal
 	proposal := InsureProposal{User: username,
-		Car: vin}
+		Car:       vin,
+		Company:   company,
+		Status:    "pending",
+		CreatedTs: now}
+
+	// keep a copy for the applicant
+	user, err := t.loadUser(stub, users, username)
+	if err == nil {
+		user.InsureProposals = append(user.InsureProposals, proposal)
+	}
+
+	err = t.saveUsers(stub, users)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
 
 	// inform the insurer of the new proposal
-	insurer.Proposals = append(insurer.Proposals, proposal)
+	insurer.Proposals = append(proposals, proposal)
 	insurerIndex[company] = insurer
 
 	// write udpated insurer index back to ledger
@@ -226,3 +587,150 @@ func (t *CarChaincode) insureProposal(stub shim.ChaincodeStubInterface, username
 	proposalAsBytes, _ := json.Marshal(proposal)
 	return shim.Success(proposalAsBytes)
 }
+
+/*
+ * Rejects an insurance proposal.
+ *
+ * The proposal is removed from the insurer,
+ * the applicant is notified of the reason.
+ * Only insurer users of the company can reject.
+ *
+ * Arguments required:
+ * [0] Username of the applicant    (string)
+ * [1] Vin                          (string)
+ * [2] Insurance company            (string)
+ * [3] Reason                       (string)
+ *
+ * On success,
+ * returns the rejected insurance proposal.
+ */
+func (t *CarChaincode) insuranceReject(stub shim.ChaincodeStubInterface, username string, args []string) pb.Response {
+	applicant := args[0]
+	vin := args[1]
+	company := strings.ToLower(args[2])
+	reason := strings.TrimSpace(args[3])
+	if reason == "" {
+		return shim.Error("A rejection needs a reason")
+	}
+
+	err := t.checkInsurer(stub, username, company)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	insurerIndex, err := t.getInsurerIndex(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	insurer := insurerIndex[company]
+	rejected := InsureProposal{}
+	var newProposals []InsureProposal
+	for _, proposal := range insurer.Proposals {
+		if proposal.Car == vin && proposal.User == applicant {
+			rejected = proposal
+		} else {
+			newProposals = append(newProposals, proposal)
+		}
+	}
+
+	if rejected.Car == "" {
+		return shim.Error(fmt.Sprintf("There is no insurance proposal of '%s' for car '%s' at '%s'", applicant, vin, company))
+	} else if InsureProposalStatus(&rejected, txTimestamp(stub)) == "expired" {
+		return shim.Error(fmt.Sprintf("The insurance proposal for car '%s' has expired", vin))
+	}
+
+	users := make(map[string]*User)
+	t.closeInsureProposal(stub, users, company, rejected, "rejected", reason)
+	err = t.saveUsers(stub, users)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	insurer.Proposals = newProposals
+	insurerIndex[company] = insurer
+
+	indexAsBytes, _ := json.Marshal(insurerIndex)
+	err = stub.PutState(insurerIndexStr, indexAsBytes)
+	if err != nil {
+		return shim.Error("Error writing insurer index")
+	}
+
+	rejected.Status = "rejected"
+	rejected.Reason = reason
+	rejectedAsBytes, _ := json.Marshal(rejected)
+	return shim.Success(rejectedAsBytes)
+}
+
+/*
+ * Removes all expired insurance proposals from the insurers.
+ *
+ * The applicants are notified of the expiry.
+ *
+ * On success,
+ * returns a list with the expired proposals.
+ */
+func (t *CarChaincode) expireInsureProposals(stub shim.ChaincodeStubInterface) pb.Response {
+	insurerIndex, err := t.getInsurerIndex(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	now := txTimestamp(stub)
+	users := make(map[string]*User)
+	expired := []InsureProposal{}
+	for _, company := range sortedInsurers(insurerIndex) {
+		insurer := insurerIndex[company]
+		var pending []InsureProposal
+		for _, proposal := range insurer.Proposals {
+			if InsureProposalStatus(&proposal, now) != "expired" {
+				pending = append(pending, proposal)
+				continue
+			}
+
+			t.closeInsureProposal(stub, users, company, proposal, "expired", "The proposal was not answered in time")
+			proposal.Status = "expired"
+			expired = append(expired, proposal)
+		}
+		insurer.Proposals = pending
+		insurerIndex[company] = insurer
+	}
+
+	err = t.saveUsers(stub, users)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	indexAsBytes, _ := json.Marshal(insurerIndex)
+	err = stub.PutState(insurerIndexStr, indexAsBytes)
+	if err != nil {
+		return shim.Error("Error writing insurer index")
+	}
+
+	expiredAsBytes, _ := json.Marshal(expired)
+	return shim.Success(expiredAsBytes)
+}
+
+/*
+ * Reads the insurance proposals of a user
+ * with their current status.
+ *
+ * On success,
+ * returns a list with proposals, oldest first.
+ */
+func (t *CarChaincode) readInsureProposals(stub shim.ChaincodeStubInterface, username string) pb.Response {
+	user, err := t.getUser(stub, username)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	now := txTimestamp(stub)
+	proposals := []InsureProposal{}
+	for _, proposal := range user.InsureProposals {
+		proposal.Status = InsureProposalStatus(&proposal, now)
+		proposals = append(proposals, proposal)
+	}
+
+	proposalsAsBytes, _ := json.Marshal(proposals)
+	return shim.Success(proposalsAsBytes)
+}
@@ -3,7 +3,9 @@ package main
 import (
     "fmt"
     "encoding/json"
+    "strings"
     "testing"
+    "time"
 
     "github.com/hyperledger/fabric/core/chaincode/shim"
     "github.com/hyperledger/fabric/common/util"
@@ -13,14 +15,14 @@ func TestIsInsured(t *testing.T) {
     // create a new car without insurance
     car := &Car{}
 
-    if (IsInsured(car)) {
+    if (IsInsured(car, time.Now().Unix())) {
         t.Error("Car should not be insured initially")
     }
 }
 
 func TestInsureProposal(t *testing.T) {
     username         := "amag"
-    vin              := "WVW ZZZ 6RZ HY26 0780"
+    vin              := "WVWZZZ6RZHY260780"
     insuranceCompany := "axa"
 
     // create and name a new chaincode mock
@@ -73,7 +75,7 @@ func TestInsureProposal(t *testing.T) {
 
 func TestGetInsurerAndInsuranceAccept(t *testing.T) {
     username         := "amag"
-    vin              := "WVW ZZZ 6RZ HY26 0780"
+    vin              := "WVWZZZ6RZHY260780"
     insuranceCompany := "axa"
     competitor       := "mobiliar"
 
@@ -132,13 +134,13 @@ func TestGetInsurerAndInsuranceAccept(t *testing.T) {
     }
 
     // the DOT registers the car
-    response = stub.MockInvoke(uuid, util.ToChaincodeArgs("register", username, "dot", vin))
+    response = stub.MockInvoke(uuid, util.ToChaincodeArgs("register", "dot-user", "dot", vin, "individual"))
     err = json.Unmarshal(response.Payload, &car)
     if (err != nil) {
         t.Error(response.Message)
     }
 
-    if IsInsured(&car) {
+    if IsInsured(&car, time.Now().Unix()) {
         t.Error("The reigistered car should not yet be insured")
     }
 
@@ -196,7 +198,140 @@ func TestGetInsurerAndInsuranceAccept(t *testing.T) {
 
     fmt.Println(car.Certificate)
 
-    if !IsInsured(&car) {
+    if !IsInsured(&car, time.Now().Unix()) {
         t.Error("The reigistered car should be insured by now")
     }
-}
\ No newline at end of file
+}
+func TestInsureProposalStatus(t *testing.T) {
+    proposal := &InsureProposal{Status: "pending", CreatedTs: 1000}
+
+    if InsureProposalStatus(proposal, 1000+insureProposalMaxAge-1) != "pending" {
+        t.Error("Proposal should still be pending")
+    }
+
+    if InsureProposalStatus(proposal, 1000+insureProposalMaxAge) != "expired" {
+        t.Error("Proposal should be expired")
+    }
+
+    // proposals recorded before the status tracking never expire
+    if InsureProposalStatus(&InsureProposal{}, 1000+insureProposalMaxAge) != "pending" {
+        t.Error("Legacy proposal should be pending")
+    }
+
+    // quoted proposals expire with their last quote
+    quoted := &InsureProposal{Status: "pending", CreatedTs: 1000, Quotes: []Quote{{ValidUntil: 2000}, {ValidUntil: 1000 + 2*insureProposalMaxAge}}}
+    if InsureProposalStatus(quoted, 1000+insureProposalMaxAge) != "pending" {
+        t.Error("Quoted proposal should be pending while a quote is valid")
+    }
+
+    if InsureProposalStatus(quoted, 1000+2*insureProposalMaxAge) != "expired" {
+        t.Error("Quoted proposal should expire with its quotes")
+    }
+
+    proposal.Status = "rejected"
+    if InsureProposalStatus(proposal, 1000+insureProposalMaxAge) != "rejected" {
+        t.Error("Rejected proposal should stay rejected")
+    }
+}
+
+func TestInsuranceReject(t *testing.T) {
+    username := "amag"
+    vin := "WVWZZZ6RZHY260780"
+
+    // create and name a new chaincode mock
+    carChaincode := &CarChaincode{}
+    stub := shim.NewMockStub("car", carChaincode)
+
+    ccSetup(t, stub)
+
+    stub.MockInvoke(uuid, util.ToChaincodeArgs("create", username, "garage", `{ "vin": "`+vin+`" }`))
+    stub.MockInvoke(uuid, util.ToChaincodeArgs("register", "dot-user", "dot", vin, "individual"))
+    stub.MockInvoke(uuid, util.ToChaincodeArgs("insureProposal", username, "garage", vin, "axa"))
+    stub.MockInvoke(uuid, util.ToChaincodeArgs("insureProposal", username, "garage", vin, "mobiliar"))
+
+    // rejections need a reason
+    response := stub.MockInvoke(uuid, util.ToChaincodeArgs("insuranceReject", "insurance-user", "insurer", username, vin, "axa", " "))
+    if response.Status != shim.ERROR {
+        t.Error("Rejection without reason should fail")
+    }
+
+    // only insurer users of the company can reject
+    response = stub.MockInvoke(uuid, util.ToChaincodeArgs("insuranceReject", "insurance-user", "insurer", username, vin, "axa", "Too many claims"))
+    if response.Status != shim.ERROR {
+        t.Error("Rejection by an insurer user not acting for the company should fail")
+    }
+
+    stub.MockInvoke(uuid, util.ToChaincodeArgs("assignInsurer", "dot-user", "dot", "insurance-user", "axa"))
+
+    response = stub.MockInvoke(uuid, util.ToChaincodeArgs("insuranceReject", "insurance-user", "insurer", username, vin, "axa", "Too many claims"))
+    if response.Status == shim.ERROR {
+        t.Error(response.Message)
+        return
+    }
+
+    response = stub.MockInvoke(uuid, util.ToChaincodeArgs("getInsurer", "insurance-user", "insurer", "axa"))
+    insurer := Insurer{}
+    json.Unmarshal(response.Payload, &insurer)
+    if len(insurer.Proposals) != 0 {
+        t.Error("Rejected proposal should be removed from the insurer")
+    }
+
+    // the other insurer accepts, the applicant sees both outcomes
+    stub.MockInvoke(uuid, util.ToChaincodeArgs("insuranceAccept", "insurance-user", "insurer", username, vin, "mobiliar"))
+
+    response = stub.MockInvoke(uuid, util.ToChaincodeArgs("readInsureProposals", username, "garage"))
+    var proposals []InsureProposal
+    json.Unmarshal(response.Payload, &proposals)
+    if len(proposals) != 2 {
+        t.Errorf("Expected 2 proposals, got %v", proposals)
+        return
+    }
+
+    if proposals[0].Status != "rejected" || proposals[0].Reason != "Too many claims" || proposals[1].Status != "accepted" {
+        t.Errorf("Unexpected proposal outcomes: %v", proposals)
+    }
+
+    user, _ := carChaincode.getUser(stub, username)
+    if len(user.Notifications) != 1 || user.Notifications[0].Status != "rejected" {
+        t.Error("Applicant should be notified of the rejection")
+    }
+}
+
+func TestCompetingProposalsClosedInOrder(t *testing.T) {
+    username := "amag"
+    vin := "WVWZZZ6RZHY260780"
+
+    // create and name a new chaincode mock
+    carChaincode := &CarChaincode{}
+    stub := shim.NewMockStub("car", carChaincode)
+
+    ccSetup(t, stub)
+
+    stub.MockInvoke(uuid, util.ToChaincodeArgs("create", username, "garage", `{ "vin": "`+vin+`" }`))
+    stub.MockInvoke(uuid, util.ToChaincodeArgs("register", "dot-user", "dot", vin, "individual"))
+    for _, company := range []string{"zurich", "axa", "mobiliar", "allianz", "generali"} {
+        stub.MockInvoke(uuid, util.ToChaincodeArgs("insureProposal", username, "garage", vin, company))
+    }
+
+    stub.MockInvoke(uuid, util.ToChaincodeArgs("insuranceAccept", "insurance-user", "insurer", username, vin, "mobiliar"))
+
+    // every endorsing peer has to write the notifications in the same order
+    user, _ := carChaincode.getUser(stub, username)
+    var notified []string
+    for _, notification := range user.Notifications {
+        notified = append(notified, notification.Message)
+    }
+
+    expected := []string{"allianz", "axa", "generali", "zurich"}
+    if len(notified) != len(expected) {
+        t.Errorf("Expected %d notifications, got %v", len(expected), notified)
+        return
+    }
+
+    for i, company := range expected {
+        if !strings.Contains(notified[i], "'"+company+"'") {
+            t.Errorf("Notifications not in insurer order: %v", notified)
+            return
+        }
+    }
+}
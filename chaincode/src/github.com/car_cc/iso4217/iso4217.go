@@ -0,0 +1,69 @@
+/*
+ * Currencies of the car chaincode and their minor units.
+ *
+ * Shared by the chaincode and its tools, so amounts in
+ * minor units are formatted the same way everywhere.
+ */
+package iso4217
+
+import "fmt"
+
+// supported ISO 4217 currencies with their number of minor unit digits
+var currencyDigits = map[string]int{
+	"CHF": 2,
+	"EUR": 2,
+	"USD": 2,
+	"GBP": 2,
+	"JPY": 0,
+}
+
+/*
+ * Returns the number of minor unit digits of a currency
+ * and whether the currency is supported.
+ */
+func Digits(currency string) (int, bool) {
+	digits, supported := currencyDigits[currency]
+	return digits, supported
+}
+
+/*
+ * Formats an amount in minor units as major units
+ * without currency code, e.g. '-12.50' for -1250 CHF.
+ *
+ * Unsupported currencies are formatted with two digits.
+ */
+func Format(amount int64, currency string) string {
+	digits, supported := currencyDigits[currency]
+	if !supported {
+		digits = 2
+	}
+
+	sign := ""
+	if amount < 0 {
+		sign = "-"
+	}
+
+	// stays positive for the smallest int64 as well
+	major := amount / pow10(digits)
+	minor := amount % pow10(digits)
+	if major < 0 {
+		major = -major
+	}
+	if minor < 0 {
+		minor = -minor
+	}
+
+	if digits == 0 {
+		return fmt.Sprintf("%s%d", sign, major)
+	}
+
+	return fmt.Sprintf("%s%d.%0*d", sign, major, digits, minor)
+}
+
+func pow10(n int) int64 {
+	result := int64(1)
+	for i := 0; i < n; i++ {
+		result *= 10
+	}
+	return result
+}
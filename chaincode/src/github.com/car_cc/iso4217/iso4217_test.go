@@ -0,0 +1,35 @@
+package iso4217
+
+import (
+	"math"
+	"testing"
+)
+
+func TestFormat(t *testing.T) {
+	amounts := []struct {
+		amount   int64
+		currency string
+		expected string
+	}{
+		{9950, "CHF", "99.50"},
+		{-1205, "EUR", "-12.05"},
+		{5, "USD", "0.05"},
+		{-5, "CHF", "-0.05"},
+		{1500, "JPY", "1500"},
+		{-1500, "JPY", "-1500"},
+		{1250, "XYZ", "12.50"},
+		{math.MinInt64, "CHF", "-92233720368547758.08"},
+	}
+
+	for _, a := range amounts {
+		if formatted := Format(a.amount, a.currency); formatted != a.expected {
+			t.Errorf("%d %s formatted as '%s', expected '%s'", a.amount, a.currency, formatted, a.expected)
+		}
+	}
+
+	if digits, supported := Digits("JPY"); !supported || digits != 0 {
+		t.Error("JPY has no minor units")
+	} else if _, supported := Digits("XYZ"); supported {
+		t.Error("XYZ is not a supported currency")
+	}
+}
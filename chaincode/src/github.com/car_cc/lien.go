@@ -0,0 +1,337 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+/*
+ * Checks for an active lien on a car.
+ *
+ * A car with an active lien is still financed by a lender
+ * and cannot change ownership until the lien is released.
+ */
+func HasActiveLien(car *Car) bool {
+	for _, lien := range car.Liens {
+		if lien.ReleasedTs == 0 {
+			fmt.Printf("Car with VIN '%s' has an active lien held by '%s'\n", car.Vin, lien.Lender)
+			return true
+		}
+	}
+
+	return false
+}
+
+/*
+ * Returns the lien index with all proposed and active liens.
+ */
+func (t *CarChaincode) getLienIndex(stub shim.ChaincodeStubInterface) (map[string]Lien, error) {
+	response := t.read(stub, lienIndexStr)
+	lienIndex := make(map[string]Lien)
+	err := json.Unmarshal(response.Payload, &lienIndex)
+	if err != nil {
+		return nil, errors.New("Error parsing lien index")
+	}
+
+	return lienIndex, nil
+}
+
+/*
+ * Checks if a user is involved in a proposed or
+ * active lien, either as lender or as debtor.
+ */
+func (t *CarChaincode) hasActiveLiens(stub shim.ChaincodeStubInterface, username string) (bool, error) {
+	lienIndex, err := t.getLienIndex(stub)
+	if err != nil {
+		return false, err
+	}
+
+	for _, lien := range lienIndex {
+		if lien.Lender == username || lien.Debtor == username {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+/*
+ * Proposes a lien on a car.
+ *
+ * Only one proposed or active lien per car is allowed.
+ * The current car owner is recorded as the debtor of
+ * the lien and notified. The lien only becomes active
+ * once the owner accepts it with 'acceptLien'.
+ *
+ * Arguments required:
+ * [0] VIN of the financed car  (string)
+ * [1] Financed amount          (string, e.g. '20000 CHF')
+ *
+ * On success,
+ * returns the proposed lien.
+ */
+func (t *CarChaincode) registerLien(stub shim.ChaincodeStubInterface, lender string, args []string) pb.Response {
+	vin := args[0]
+
+	// amount input sanitation
+	amount, err := ParsePositiveMoney(args[1])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// fetch the car from the ledger
+	car, err := t.getCarAsDot(stub, vin)
+	if err != nil {
+		return shim.Error("Failed to fetch car with vin '" + vin + "' from ledger")
+	}
+
+	// check if the car is already financed
+	if HasActiveLien(&car) {
+		return shim.Error(fmt.Sprintf("Car with VIN '%s' already has an active lien.", vin))
+	}
+
+	lienIndex, err := t.getLienIndex(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	} else if _, proposed := lienIndex[vin]; proposed {
+		return shim.Error(fmt.Sprintf("Car with VIN '%s' already has a proposed lien.", vin))
+	}
+
+	owner, err := t.getOwner(stub, vin)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	lien := Lien{
+		Lender:    lender,
+		Debtor:    owner,
+		Vin:       vin,
+		Amount:    amount,
+		CreatedTs: txTimestamp(stub)}
+
+	// tell the owner about the proposed lien
+	users := make(map[string]*User)
+	t.notify(stub, users, owner, Notification{
+		Type:    "lien",
+		Subject: vin,
+		Status:  "proposed",
+		Message: fmt.Sprintf("Lender '%s' proposes a lien of %s", lender, amount)})
+	err = t.saveUsers(stub, users)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// add the lien to the index,
+	// it waits there for the owner
+	lienIndex[vin] = lien
+
+	indexAsBytes, _ := json.Marshal(lienIndex)
+	err = stub.PutState(lienIndexStr, indexAsBytes)
+	if err != nil {
+		return shim.Error("Error writing lien index")
+	}
+
+	lienAsBytes, _ := json.Marshal(lien)
+	return shim.Success(lienAsBytes)
+}
+
+/*
+ * Accepts the proposed lien on a car.
+ *
+ * Only the owner recorded as debtor can accept the lien.
+ * The lien becomes active and is attached to the car,
+ * like this it shows up in the car history.
+ *
+ * On success,
+ * returns the active lien.
+ */
+func (t *CarChaincode) acceptLien(stub shim.ChaincodeStubInterface, username string, vin string) pb.Response {
+	lienIndex, err := t.getLienIndex(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	lien, lienExisting := lienIndex[vin]
+	if !lienExisting || lien.AcceptedTs != 0 {
+		return shim.Error(fmt.Sprintf("There is no proposed lien on car with VIN '%s'.", vin))
+	} else if lien.Debtor != username {
+		return shim.Error("Forbidden: only the owner of the car can accept the lien")
+	}
+
+	owner, err := t.getOwner(stub, vin)
+	if err != nil {
+		return shim.Error(err.Error())
+	} else if owner != lien.Debtor {
+		return shim.Error(fmt.Sprintf("Car with VIN '%s' changed owner since the lien was proposed.", vin))
+	}
+
+	// fetch the car from the ledger
+	car, err := t.getCarAsDot(stub, vin)
+	if err != nil {
+		return shim.Error("Failed to fetch car with vin '" + vin + "' from ledger")
+	}
+
+	lien.AcceptedTs = txTimestamp(stub)
+	car.Liens = append(car.Liens, lien)
+	carAsBytes, _ := json.Marshal(car)
+	err = stub.PutState(car.Vin, carAsBytes)
+	if err != nil {
+		return shim.Error("Error writing car")
+	}
+
+	lienIndex[vin] = lien
+	indexAsBytes, _ := json.Marshal(lienIndex)
+	err = stub.PutState(lienIndexStr, indexAsBytes)
+	if err != nil {
+		return shim.Error("Error writing lien index")
+	}
+
+	lienAsBytes, _ := json.Marshal(lien)
+	return shim.Success(lienAsBytes)
+}
+
+/*
+ * Declines the proposed lien on a car.
+ *
+ * Only the owner recorded as debtor can decline the lien.
+ *
+ * On success,
+ * returns the declined lien.
+ */
+func (t *CarChaincode) declineLien(stub shim.ChaincodeStubInterface, username string, vin string) pb.Response {
+	lienIndex, err := t.getLienIndex(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	lien, lienExisting := lienIndex[vin]
+	if !lienExisting || lien.AcceptedTs != 0 {
+		return shim.Error(fmt.Sprintf("There is no proposed lien on car with VIN '%s'.", vin))
+	} else if lien.Debtor != username {
+		return shim.Error("Forbidden: only the owner of the car can decline the lien")
+	}
+
+	delete(lienIndex, vin)
+	indexAsBytes, _ := json.Marshal(lienIndex)
+	err = stub.PutState(lienIndexStr, indexAsBytes)
+	if err != nil {
+		return shim.Error("Error writing lien index")
+	}
+
+	lienAsBytes, _ := json.Marshal(lien)
+	return shim.Success(lienAsBytes)
+}
+
+/*
+ * Releases the active lien on a car.
+ *
+ * Only the lender holding the lien can release it,
+ * usually after the loan has been paid back. A lien
+ * not yet accepted by the owner is withdrawn.
+ *
+ * On success,
+ * returns the released lien.
+ */
+func (t *CarChaincode) releaseLien(stub shim.ChaincodeStubInterface, lender string, vin string) pb.Response {
+	if vin == "" {
+		return shim.Error("'releaseLien' expects a non-empty VIN")
+	}
+
+	lienIndex, err := t.getLienIndex(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	lien, lienExisting := lienIndex[vin]
+	if !lienExisting {
+		return shim.Error(fmt.Sprintf("There is no active lien on car with VIN '%s'.", vin))
+	} else if lien.Lender != lender {
+		return shim.Error("Forbidden: this lien is held by another lender")
+	}
+
+	// a proposed lien is not on the car yet
+	if lien.AcceptedTs == 0 {
+		delete(lienIndex, vin)
+		indexAsBytes, _ := json.Marshal(lienIndex)
+		err = stub.PutState(lienIndexStr, indexAsBytes)
+		if err != nil {
+			return shim.Error("Error writing lien index")
+		}
+
+		lienAsBytes, _ := json.Marshal(lien)
+		return shim.Success(lienAsBytes)
+	}
+
+	// fetch the car from the ledger
+	car, err := t.getCarAsDot(stub, vin)
+	if err != nil {
+		return shim.Error("Failed to fetch car with vin '" + vin + "' from ledger")
+	}
+
+	// mark the lien as released in the car record
+	releasedTs := txTimestamp(stub)
+	for i := range car.Liens {
+		if car.Liens[i].ReleasedTs == 0 {
+			car.Liens[i].ReleasedTs = releasedTs
+			lien = car.Liens[i]
+		}
+	}
+
+	carAsBytes, _ := json.Marshal(car)
+	err = stub.PutState(car.Vin, carAsBytes)
+	if err != nil {
+		return shim.Error("Error writing car")
+	}
+
+	// remove the lien from the active liens
+	delete(lienIndex, vin)
+
+	indexAsBytes, _ := json.Marshal(lienIndex)
+	err = stub.PutState(lienIndexStr, indexAsBytes)
+	if err != nil {
+		return shim.Error("Error writing lien index")
+	}
+
+	lienAsBytes, _ := json.Marshal(lien)
+	return shim.Success(lienAsBytes)
+}
+
+/*
+ * Reads liens.
+ *
+ * If a VIN is given, all liens of that car are returned,
+ * including the released ones. Otherwise all proposed and
+ * active liens held by the lender are returned.
+ *
+ * On success,
+ * returns a list of liens.
+ */
+func (t *CarChaincode) readLiens(stub shim.ChaincodeStubInterface, lender string, args []string) pb.Response {
+	var liens []Lien
+
+	if len(args) > 0 && args[0] != "" {
+		car, err := t.getCarAsDot(stub, args[0])
+		if err != nil {
+			return shim.Error("Failed to fetch car with vin '" + args[0] + "' from ledger")
+		}
+		liens = car.Liens
+	} else {
+		lienIndex, err := t.getLienIndex(stub)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+
+		for _, lien := range lienIndex {
+			if lien.Lender == lender {
+				liens = append(liens, lien)
+			}
+		}
+	}
+
+	liensAsBytes, _ := json.Marshal(liens)
+	return shim.Success(liensAsBytes)
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/hyperledger/fabric/common/util"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+func TestHasActiveLien(t *testing.T) {
+	// create a new car without liens
+	car := &Car{}
+
+	if HasActiveLien(car) {
+		t.Error("Car should not have an active lien initially")
+	}
+}
+
+func TestRegisterAndReleaseLien(t *testing.T) {
+	username := "amag"
+	buyer := "bobby"
+	lender := "ubs"
+	vin := "WVWZZZ6RZHY260780"
+
+	// create and name a new chaincode mock
+	carChaincode := &CarChaincode{}
+	stub := shim.NewMockStub("car", carChaincode)
+
+	ccSetup(t, stub)
+
+	// create a new car and a prospective buyer
+	carData := `{ "vin": "` + vin + `" }`
+	stub.MockInvoke(uuid, util.ToChaincodeArgs("create", username, "garage", carData))
+	stub.MockInvoke(uuid, util.ToChaincodeArgs("createUser", username, "garage", buyer))
+
+	// registering a lien as normal user should be forbidden
+	response := stub.MockInvoke(uuid, util.ToChaincodeArgs("registerLien", username, "user", vin, "20000"))
+	if response.Status != shim.ERROR {
+		t.Error("Registering a lien as 'user' should not be possible")
+	}
+
+	// register a lien as lender
+	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("registerLien", lender, "lender", vin, "20000"))
+	lien := Lien{}
+	err := json.Unmarshal(response.Payload, &lien)
+	if err != nil {
+		t.Error(response.Message)
+		return
+	}
+
+	if lien.Debtor != username || lien.Lender != lender || lien.AcceptedTs != 0 {
+		t.Error("Lien registered with wrong parties")
+	}
+
+	// a second lien on the same car should be rejected
+	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("registerLien", "credit-suisse", "lender", vin, "1000"))
+	if response.Status != shim.ERROR {
+		t.Error("Only one active lien per car should be possible")
+	}
+
+	// the lien only becomes active with the consent of the owner
+	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("readCar", username, "user", vin))
+	car := Car{}
+	json.Unmarshal(response.Payload, &car)
+	if HasActiveLien(&car) {
+		t.Error("Proposed lien should not be active yet")
+	}
+
+	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("acceptLien", buyer, "user", vin))
+	if response.Status != shim.ERROR {
+		t.Error("Only the owner should accept the lien")
+	}
+
+	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("acceptLien", username, "garage", vin))
+	if response.Status == shim.ERROR {
+		t.Error(response.Message)
+		return
+	}
+
+	// the lien should be visible on the car
+	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("readCar", username, "user", vin))
+	car = Car{}
+	err = json.Unmarshal(response.Payload, &car)
+	if err != nil {
+		t.Error("Failed to fetch car")
+	} else if !HasActiveLien(&car) {
+		t.Error("Lien not attached to the car")
+	}
+
+	// the financed car cannot be offered, sold or deleted
+	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("createSellingOffer", username, "garage", "99", vin, buyer))
+	if response.Status != shim.ERROR {
+		t.Error("Creating a selling offer for a financed car should not be possible")
+	}
+
+	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("sell", username, "garage", vin, buyer))
+	if response.Status != shim.ERROR {
+		t.Error("Selling a financed car should not be possible")
+	}
+
+	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("delete", "dot-user", "dot", vin))
+	if response.Status != shim.ERROR {
+		t.Error("Deleting a financed car should not be possible")
+	}
+
+	// the lender should see its active lien
+	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("readLiens", lender, "lender"))
+	var liens []Lien
+	err = json.Unmarshal(response.Payload, &liens)
+	if err != nil || len(liens) != 1 {
+		t.Error("Lender should hold exactly one active lien")
+	}
+
+	// only the lender holding the lien can release it
+	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("releaseLien", "credit-suisse", "lender", vin))
+	if response.Status != shim.ERROR {
+		t.Error("Another lender should not be able to release the lien")
+	}
+
+	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("releaseLien", lender, "lender", vin))
+	err = json.Unmarshal(response.Payload, &lien)
+	if err != nil {
+		t.Error(response.Message)
+		return
+	}
+
+	if lien.ReleasedTs == 0 {
+		t.Error("Lien should be released by now")
+	}
+
+	// the released lien remains in the history of the car
+	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("readLiens", lender, "lender", vin))
+	liens = nil
+	err = json.Unmarshal(response.Payload, &liens)
+	if err != nil || len(liens) != 1 {
+		t.Error("Released lien should still be recorded on the car")
+	}
+
+	fmt.Printf("Liens of car '%s': %v\n", vin, liens)
+
+	// with the lien released, the car can be offered again
+	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("createSellingOffer", username, "garage", "99", vin, buyer))
+	if response.Status == shim.ERROR {
+		t.Error(response.Message)
+	}
+}
+
+func TestDeclineAndWithdrawLien(t *testing.T) {
+	username := "amag"
+	lender := "ubs"
+	vin := "WVWZZZ6RZHY260780"
+
+	// create and name a new chaincode mock
+	carChaincode := &CarChaincode{}
+	stub := shim.NewMockStub("car", carChaincode)
+
+	ccSetup(t, stub)
+
+	stub.MockInvoke(uuid, util.ToChaincodeArgs("create", username, "garage", `{ "vin": "`+vin+`" }`))
+
+	// the owner is told about the proposed lien and declines it
+	stub.MockInvoke(uuid, util.ToChaincodeArgs("registerLien", lender, "lender", vin, "20000"))
+	user, _ := carChaincode.getUser(stub, username)
+	if len(user.Notifications) != 1 || user.Notifications[0].Status != "proposed" {
+		t.Errorf("Owner not notified of the proposed lien: %v", user.Notifications)
+	}
+
+	response := stub.MockInvoke(uuid, util.ToChaincodeArgs("declineLien", username, "garage", vin))
+	if response.Status == shim.ERROR {
+		t.Error(response.Message)
+		return
+	}
+
+	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("acceptLien", username, "garage", vin))
+	if response.Status != shim.ERROR {
+		t.Error("Declined lien should not be accepted")
+	}
+
+	// the lender withdraws a proposed lien
+	stub.MockInvoke(uuid, util.ToChaincodeArgs("registerLien", lender, "lender", vin, "20000"))
+	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("releaseLien", lender, "lender", vin))
+	if response.Status == shim.ERROR {
+		t.Error(response.Message)
+		return
+	}
+
+	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("readLiens", lender, "lender", vin))
+	var liens []Lien
+	json.Unmarshal(response.Payload, &liens)
+	if len(liens) != 0 {
+		t.Errorf("Withdrawn lien should not be on the car: %v", liens)
+	}
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+/*
+ * Allowed status changes of a car.
+ *
+ * created              car is on the ledger, no registration proposal
+ * registrationPending  registration proposal waits for the DOT
+ * registered           VIN approved by the DOT, certificate issued
+ * insured              insurance contract accepted by an insurer
+ * confirmed            numberplate assigned, allowed on the road
+ * revoked              insurance and numberplate withdrawn
+ * deregistered         taken off the road, can be insured again
+ * scrapped             destroyed by a recycler, final
+ * exported             left the country, final
+ */
+var carTransitions = map[string][]string{
+	"created":             {"registrationPending"},
+	"registrationPending": {"registered", "created"},
+	"registered":          {"insured", "deregistered"},
+	"insured":             {"confirmed", "revoked", "deregistered"},
+	"confirmed":           {"revoked", "deregistered"},
+	"revoked":             {"insured", "deregistered"},
+	"deregistered":        {"insured", "scrapped", "exported"},
+	"scrapped":            {},
+	"exported":            {},
+}
+
+/*
+ * Statuses in which a car allows an action without a status change.
+ *
+ * The numberplate and the insurance contract are bound to
+ * the keeper, confirmed cars have to be revoked before they
+ * change hands.
+ */
+var carActions = map[string][]string{
+	"sell":      {"created", "registrationPending", "registered", "insured", "revoked", "deregistered"},
+	"setKeeper": {"created", "registrationPending", "registered", "insured", "revoked", "deregistered"},
+	"delete":    {"created", "registrationPending"},
+}
+
+/*
+ * Checks if the status of a car allows an action.
+ */
+func checkCarAction(car *Car, action string) error {
+	status := CarStatus(car)
+	for _, allowed := range carActions[action] {
+		if allowed == status {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("Car with VIN '%s' does not allow '%s' in status '%s'", car.Vin, action, status)
+}
+
+/*
+ * Checks if the transition table allows a status change.
+ */
+func CanTransition(from string, to string) bool {
+	for _, allowed := range carTransitions[from] {
+		if allowed == to {
+			return true
+		}
+	}
+
+	return false
+}
+
+/*
+ * Returns the lifecycle status of a car.
+ *
+ * Cars created before the status was introduced
+ * get their status derived from the certificate.
+ */
+func CarStatus(car *Car) string {
+	if car.Status != "" {
+		return car.Status
+	}
+
+	insured := IsRegistered(car) && car.Certificate.Insurer != ""
+	if car.Certificate.Numberplate != "" && insured {
+		return "confirmed"
+	} else if insured {
+		return "insured"
+	} else if IsRegistered(car) {
+		return "registered"
+	}
+
+	return "registrationPending"
+}
+
+/*
+ * Changes the status of a car and records the transition.
+ *
+ * Returns an error if the transition table does not allow
+ * the status change. The car is not written to the ledger.
+ */
+func transitionCar(stub shim.ChaincodeStubInterface, car *Car, to string, by string, reason string) error {
+	from := CarStatus(car)
+	if !CanTransition(from, to) {
+		return fmt.Errorf("Car with VIN '%s' cannot change from status '%s' to '%s'", car.Vin, from, to)
+	}
+
+	recordTransition(stub, car, from, to, by, reason)
+	return nil
+}
+
+/*
+ * Sets the status of a car and appends the transition log.
+ */
+func recordTransition(stub shim.ChaincodeStubInterface, car *Car, from string, to string, by string, reason string) {
+	car.Status = to
+	car.Transitions = append(car.Transitions, StatusTransition{
+		From:      from,
+		To:        to,
+		By:        by,
+		Reason:    reason,
+		TxId:      stub.GetTxID(),
+		CreatedTs: txTimestamp(stub)})
+
+	fmt.Printf("Car with VIN '%s' changed from status '%s' to '%s' (%s)\n", car.Vin, from, to, reason)
+}
+
+/*
+ * Checks if a car was scrapped or exported.
+ *
+ * Disposed cars stay on the ledger for their
+ * history, but cannot be used in any workflow.
+ */
+func IsDisposed(car *Car) bool {
+	status := CarStatus(car)
+	disposed := status == "scrapped" || status == "exported"
+
+	if disposed {
+		fmt.Printf("Car with VIN '%s' is %s\n", car.Vin, status)
+	}
+
+	return disposed
+}
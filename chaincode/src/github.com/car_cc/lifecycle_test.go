@@ -0,0 +1,118 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/hyperledger/fabric/common/util"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+func TestCarTransitions(t *testing.T) {
+	if !CanTransition("insured", "confirmed") || !CanTransition("revoked", "insured") {
+		t.Error("Allowed transitions rejected")
+	}
+
+	if CanTransition("created", "confirmed") || CanTransition("scrapped", "insured") || CanTransition("confirmed", "confirmed") {
+		t.Error("Forbidden transitions allowed")
+	}
+
+	// every status is declared in the transition table
+	for _, targets := range carTransitions {
+		for _, target := range targets {
+			if _, declared := carTransitions[target]; !declared {
+				t.Errorf("Status '%s' is not declared", target)
+			}
+		}
+	}
+
+	for action, statuses := range carActions {
+		for _, status := range statuses {
+			if _, declared := carTransitions[status]; !declared {
+				t.Errorf("Status '%s' of action '%s' is not declared", status, action)
+			}
+		}
+	}
+}
+
+func TestCarActions(t *testing.T) {
+	confirmed := &Car{Vin: "WVWZZZ6RZHY260780", Status: "confirmed"}
+	if checkCarAction(confirmed, "sell") == nil || checkCarAction(confirmed, "setKeeper") == nil {
+		t.Error("Confirmed cars should not change hands")
+	}
+
+	revoked := &Car{Vin: "WVWZZZ6RZHY260780", Status: "revoked"}
+	if checkCarAction(revoked, "sell") != nil || checkCarAction(revoked, "setKeeper") != nil {
+		t.Error("Revoked cars should change hands")
+	}
+
+	scrapped := &Car{Vin: "WVWZZZ6RZHY260780", Status: "scrapped"}
+	if checkCarAction(scrapped, "sell") == nil {
+		t.Error("Scrapped cars should not be sold")
+	}
+}
+
+func TestCarLifecycle(t *testing.T) {
+	username := "amag"
+	vin := "WVWZZZ6RZHY260780"
+	numberplate := "ZH 7878"
+	insuranceCompany := "axa"
+
+	// create and name a new chaincode mock
+	carChaincode := &CarChaincode{}
+	stub := shim.NewMockStub("car", carChaincode)
+
+	ccSetup(t, stub)
+
+	// the status cannot be set by the creator
+	response := stub.MockInvoke(uuid, util.ToChaincodeArgs("create", username, "garage", `{ "vin": "`+vin+`", "status": "confirmed" }`))
+	car := Car{}
+	err := json.Unmarshal(response.Payload, &car)
+	if err != nil {
+		t.Error(response.Message)
+		return
+	}
+
+	if car.Status != "registrationPending" {
+		t.Errorf("New car has status '%s', expected 'registrationPending'", car.Status)
+	}
+
+	// confirmation needs an insured car
+	stub.MockInvoke(uuid, util.ToChaincodeArgs("register", "dot-user", "dot", vin, "individual"))
+	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("confirm", "dot-user", "dot", vin, numberplate))
+	if response.Status != shim.ERROR {
+		t.Error("Confirming a car which is not insured should not be possible")
+	}
+
+	stub.MockInvoke(uuid, util.ToChaincodeArgs("insureProposal", username, "user", vin, insuranceCompany))
+	stub.MockInvoke(uuid, util.ToChaincodeArgs("insuranceAccept", "insurance-user", "insurer", username, vin, insuranceCompany))
+	stub.MockInvoke(uuid, util.ToChaincodeArgs("confirm", "dot-user", "dot", vin, numberplate))
+	stub.MockInvoke(uuid, util.ToChaincodeArgs("revoke", "dot-user", "dot", vin))
+
+	// a revoked car cannot be revoked again
+	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("revoke", "dot-user", "dot", vin))
+	if response.Status != shim.ERROR {
+		t.Error("Revoking a revoked car should not be possible")
+	}
+
+	// every status change is logged with the car
+	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("readCar", "dot-user", "dot", vin))
+	car = Car{}
+	json.Unmarshal(response.Payload, &car)
+
+	expected := []string{"created", "registrationPending", "registered", "insured", "confirmed", "revoked"}
+	if len(car.Transitions) != len(expected) {
+		t.Errorf("Wrong transition log: %v", car.Transitions)
+		return
+	}
+
+	for i, status := range expected {
+		if car.Transitions[i].To != status {
+			t.Errorf("Transition %d changed to '%s', expected '%s'", i, car.Transitions[i].To, status)
+		}
+	}
+
+	if car.Status != "revoked" || car.Transitions[3].By != insuranceCompany || car.Transitions[5].Reason != "revoke" {
+		t.Error("Wrong status transitions")
+	}
+}
@@ -1,10 +1,106 @@
 package main
 
 type Car struct {
-	Certificate Certificate `json:"certificate"` // vehicle certificate issued by the DOT
-	CreatedTs   int64       `json:"createdTs"`   // birth date
-	Vin         string      `json:"vin"`         // vehicle identification number ('WVW ZZZ 6RZ HY26 0780')
-	UsageData   UsageData   `json:"usageData"`   // car usage profile, interesting for car rentals
+	Certificate  Certificate        `json:"certificate"`  // vehicle certificate issued by the DOT
+	CreatedTs    int64              `json:"createdTs"`    // birth date
+	Vin          string             `json:"vin"`          // vehicle identification number ('WVWZZZ6RZHY260780')
+	Wmi          string             `json:"wmi"`          // World Manufacturer Identifier, first 3 VIN characters
+	Manufacturer string             `json:"manufacturer"` // decoded from the WMI, empty if unknown
+	ModelYear    int                `json:"modelYear"`    // decoded from VIN position 10, 0 if not encoded
+	UsageData    UsageData          `json:"usageData"`    // car usage profile, interesting for car rentals
+	Liens        []Lien             `json:"liens"`        // financing holds, active and released
+	Inspections  []Inspection       `json:"inspections"`  // periodic inspections (MFK), oldest first
+	TheftReports []TheftReport      `json:"theftReports"` // stolen and recovered reports, oldest first
+	Status       string             `json:"status"`       // lifecycle status, see 'carTransitions'
+	Transitions  []StatusTransition `json:"transitions"`  // status changes, oldest first
+	Disposals    []Disposal         `json:"disposals"`    // deregistrations, scrapping and export, oldest first
+
+	Authority       string            `json:"authority"`       // canton of the registering authority, empty before registration
+	Reregistrations []Reregistration  `json:"reregistrations"` // moves to other cantons, oldest first
+	Policies        []InsurancePolicy `json:"policies"`        // insurance policies, oldest first
+	Claims          []Claim           `json:"claims"`          // insurance claims, oldest first
+}
+
+/*
+ * Insurance claim of a car owner or keeper
+ *
+ * Filed against the active policy of the car and
+ * decided by its insurer. Claims stay with the car,
+ * future buyers see its damage history.
+ */
+type Claim struct {
+	Id              string   `json:"id"`       // '<policy id>-<n>'
+	PolicyId        string   `json:"policyId"` // policy the claim is filed against
+	Insurer         string   `json:"insurer"`
+	Claimant        string   `json:"claimant"` // receives the payout
+	Vin             string   `json:"vin"`
+	IncidentTs      int64    `json:"incidentTs"` // within the term of the policy
+	Description     string   `json:"description"`
+	EstimatedDamage Money    `json:"estimatedDamage"`
+	Documents       []string `json:"documents"` // SHA-256 hashes of the supporting documents
+	Status          string   `json:"status"`    // 'filed', 'inReview', 'approved' or 'rejected'
+	Payout          Money    `json:"payout"`    // paid to the claimant, if approved
+	Comment         string   `json:"comment"`   // reason of the insurer for its decision
+	ReviewedBy      string   `json:"reviewedBy"`
+	ReviewedTs      int64    `json:"reviewedTs"`
+	TxId            string   `json:"txId"`
+	CreatedTs       int64    `json:"createdTs"`
+}
+
+/*
+ * Insurer decision on a claim
+ */
+type ClaimDecision struct {
+	Decision string `json:"decision"` // 'review', 'approve' or 'reject'
+	Payout   Money  `json:"payout"`   // required for approvals
+	Comment  string `json:"comment"`
+}
+
+/*
+ * Insurance policy of a car
+ *
+ * Created when an insurer accepts an insurance proposal.
+ * The car counts as insured while its latest policy is
+ * active and within its term.
+ */
+type InsurancePolicy struct {
+	Id         string `json:"id"`      // '<insurer>-<vin>-<n>'
+	Insurer    string `json:"insurer"` // insurance company
+	Holder     string `json:"holder"`  // insured party, the keeper
+	Vin        string `json:"vin"`
+	Coverage   string `json:"coverage"`   // 'liability', 'partial' or 'comprehensive'
+	Premium    Money  `json:"premium"`    // yearly premium
+	Deductible Money  `json:"deductible"` // paid by the holder per claim
+	QuoteId    string `json:"quoteId"`    // bound quote, empty for direct acceptance
+	StartTs    int64  `json:"startTs"`    // start of the term (inclusive)
+	EndTs      int64  `json:"endTs"`      // end of the term (exclusive)
+	Status     string `json:"status"`     // 'active' or 'cancelled', 'expired' and 'pending' are derived
+	TxId       string `json:"txId"`
+	CreatedTs  int64  `json:"createdTs"`
+}
+
+/*
+ * Handover of a car to the authority of another canton
+ *
+ * Confirmed cars get a numberplate of the new canton.
+ */
+type Reregistration struct {
+	From           string `json:"from"` // canton of the previous authority
+	To             string `json:"to"`   // canton of the new authority
+	OldNumberplate string `json:"oldNumberplate"`
+	NewNumberplate string `json:"newNumberplate"`
+	By             string `json:"by"` // DOT user of the new authority
+	TxId           string `json:"txId"`
+	CreatedTs      int64  `json:"createdTs"`
+}
+
+type StatusTransition struct {
+	From      string `json:"from"`
+	To        string `json:"to"`
+	By        string `json:"by"`     // user who triggered the change
+	Reason    string `json:"reason"` // function that changed the status, e.g. 'register'
+	TxId      string `json:"txId"`
+	CreatedTs int64  `json:"createdTs"`
 }
 
 type UsageData struct {
@@ -21,27 +117,249 @@ type DataContribution struct {
 }
 
 type User struct {
-	Name    string   `json:"name"`
-	Cars    []string `json:"cars"`
-	Balance int      `json:"balance"`
-	Offers  []Offer  `json:"offers"`
+	Name          string         `json:"name"`
+	Cars          []string       `json:"cars"`
+	FormerCars    []string       `json:"formerCars"` // deregistered, scrapped and exported cars
+	KeptCars      []string       `json:"keptCars"`   // cars of other owners kept by the user, e.g. leased cars
+	Balance       Money          `json:"balance"`
+	Offers        []Offer        `json:"offers"`
+	Receipts      []FeeReceipt   `json:"receipts"`      // fees and taxes paid to the DOT
+	BankReceipts  []BankReceipt  `json:"bankReceipts"`  // deposits and withdrawals
+	Notifications []Notification `json:"notifications"` // outcomes of requests, newest last
+
+	InsureProposals []InsureProposal `json:"insureProposals"` // own insurance proposals with their outcome
+}
+
+/*
+ * Message to a user about the outcome of a request
+ */
+type Notification struct {
+	Type      string `json:"type"`    // e.g. 'revocation'
+	Subject   string `json:"subject"` // e.g. the car VIN
+	Status    string `json:"status"`  // e.g. 'approved' or 'denied'
+	Message   string `json:"message"`
+	TxId      string `json:"txId"`
+	CreatedTs int64  `json:"createdTs"`
+}
+
+/*
+ * Request of a keeper to revoke a car
+ *
+ * Pending requests are decided by the DOT,
+ * the requester is notified of the outcome.
+ */
+type RevocationRequest struct {
+	Vin       string `json:"vin"`
+	Requester string `json:"requester"` // keeper at the time of the request
+	Reason    string `json:"reason"`    // 'sale', 'deregistration', 'plateChange', 'insuranceChange' or 'other'
+	CreatedTs int64  `json:"createdTs"`
+	TxId      string `json:"txId"`
+}
+
+/*
+ * DOT decision on a revocation request in a batch
+ */
+type RevocationDecision struct {
+	Vin      string `json:"vin"`
+	Decision string `json:"decision"` // 'approve' or 'deny'
+	Retain   bool   `json:"retain"`   // retain the numberplate for its holder
+	Comment  string `json:"comment"`
+}
+
+/*
+ * Outcome of a revocation decision in a batch
+ */
+type RevocationResult struct {
+	Vin     string `json:"vin"`
+	Status  string `json:"status"` // 'approved', 'denied' or 'failed'
+	Message string `json:"message"`
 }
 
 type Insurer struct {
 	Name      string           `json:"name"`
+	Members   []string         `json:"members"` // insurer users acting for the company
 	Proposals []InsureProposal `json:"proposals"`
 }
 
+/*
+ * Insurance proposal of a keeper
+ *
+ * Pending proposals are listed on the insurer, the
+ * applicant keeps a copy with the outcome. Unanswered
+ * proposals expire after 'insureProposalMaxAge'.
+ */
 type InsureProposal struct {
-	User string `json:"user"`
-	Car  string `json:"car"`
+	User      string  `json:"user"`
+	Car       string  `json:"car"`
+	Company   string  `json:"company"`
+	Status    string  `json:"status"` // 'pending', 'accepted', 'rejected', 'expired' or 'cancelled'
+	Reason    string  `json:"reason"` // why the proposal was rejected or cancelled
+	CreatedTs int64   `json:"createdTs"`
+	DecidedTs int64   `json:"decidedTs"`
+	Quotes    []Quote `json:"quotes"` // offers of the insurer, the applicant binds one of them
+}
+
+/*
+ * Offer of an insurer in response to an insurance proposal
+ *
+ * Binding the quote creates the policy and charges
+ * the premium to the applicant.
+ */
+type Quote struct {
+	Id         string `json:"id"` // '<insurer>-<vin>-q<n>'
+	Coverage   string `json:"coverage"`
+	Premium    Money  `json:"premium"`
+	Deductible Money  `json:"deductible"`
+	ValidUntil int64  `json:"validUntil"` // the quote can be bound before
+	CreatedTs  int64  `json:"createdTs"`
+}
+
+/*
+ * Financing hold on a car
+ *
+ * A lien is proposed by the lender and becomes active
+ * once the owner accepts it. As long as a lien is active,
+ * the car cannot be sold and neither the car nor its
+ * owner can be deleted.
+ */
+type Lien struct {
+	Lender     string `json:"lender"`     // bank that financed the car
+	Debtor     string `json:"debtor"`     // car owner at the time the lien was registered
+	Vin        string `json:"vin"`        // vehicle identification number
+	Amount     Money  `json:"amount"`     // financed amount
+	CreatedTs  int64  `json:"createdTs"`  // registration date of the lien
+	AcceptedTs int64  `json:"acceptedTs"` // acceptance by the owner, 0 while the lien is proposed
+	ReleasedTs int64  `json:"releasedTs"` // release date, 0 while the lien is active
+}
+
+/*
+ * Report of a stolen car
+ *
+ * Filed by the owner or the police, the car counts
+ * as stolen until the report is closed on recovery.
+ */
+type TheftReport struct {
+	ReportedBy  string `json:"reportedBy"`
+	Reference   string `json:"reference"` // police case number
+	ReportedTs  int64  `json:"reportedTs"`
+	RecoveredBy string `json:"recoveredBy"`
+	RecoveredTs int64  `json:"recoveredTs"` // 0 while the car is missing
+}
+
+/*
+ * Removal of a car from the road
+ *
+ * Deregistered cars can be insured again,
+ * scrapped and exported cars are gone for good.
+ */
+type Disposal struct {
+	Type        string `json:"type"`        // 'deregistration', 'scrapping' or 'export'
+	By          string `json:"by"`          // DOT user
+	Recycler    string `json:"recycler"`    // licensed recycler, scrapping only
+	Certificate string `json:"certificate"` // certificate of destruction, scrapping only
+	Country     string `json:"country"`     // destination country code, export only
+	TxId        string `json:"txId"`
+	CreatedTs   int64  `json:"createdTs"`
+}
+
+/*
+ * Periodic roadworthiness inspection (MFK)
+ *
+ * Recorded by the DOT or a certified garage.
+ */
+type Inspection struct {
+	Inspector   string   `json:"inspector"`   // DOT user or certified garage
+	Result      string   `json:"result"`      // 'passed' or 'failed'
+	Defects     []string `json:"defects"`     // defects found, required for failed inspections
+	InspectedTs int64    `json:"inspectedTs"` // inspection date
+	NextDueTs   int64    `json:"nextDueTs"`   // due date of the next inspection
+	TxId        string   `json:"txId"`
+}
+
+/*
+ * Fees and taxes charged by the DOT
+ *
+ * Maintained by the DOT, fees are collected
+ * into the DOT treasury account.
+ */
+type FeeSchedule struct {
+	Registration Money `json:"registration"` // fee for registering a car
+	Confirmation Money `json:"confirmation"` // fee for confirming a car (numberplate)
+	SalesTax     int   `json:"salesTax"`     // tax on private sales in percent of the price
+	VanityPlate  Money `json:"vanityPlate"`  // fee for reserving a numberplate of choice
+}
+
+type FeeReceipt struct {
+	Payer     string `json:"payer"`
+	Fee       string `json:"fee"` // 'registration', 'confirmation', 'salesTax', 'vanityPlate'
+	Vin       string `json:"vin"` // the car, or the numberplate for vanity plates
+	Amount    Money  `json:"amount"`
+	CreatedTs int64  `json:"createdTs"`
+	TxId      string `json:"txId"` // transaction that collected the fee
+}
+
+/*
+ * Confirmation of a deposit or withdrawal by a bank
+ */
+type BankReceipt struct {
+	Id        string `json:"id"`      // transaction of the deposit or withdrawal
+	Type      string `json:"type"`    // 'deposit' or 'withdrawal'
+	Account   string `json:"account"` // username of the account holder
+	Bank      string `json:"bank"`    // bank that moved the money
+	Amount    Money  `json:"amount"`
+	Reference string `json:"reference"` // external reference, e.g. the bank transaction
+	CreatedTs int64  `json:"createdTs"`
+}
+
+/*
+ * Balance movement between two accounts
+ *
+ * The debit account is charged,
+ * the credit account receives the amount.
+ */
+type JournalEntry struct {
+	Debit     string `json:"debit"`
+	Credit    string `json:"credit"`
+	Amount    Money  `json:"amount"`
+	Reason    string `json:"reason"`    // 'sale', 'transfer', 'deposit', 'withdrawal', 'closing' or the fee type
+	Reference string `json:"reference"` // e.g. the car VIN of a sale
+	TxId      string `json:"txId"`
+	CreatedTs int64  `json:"createdTs"`
+}
+
+/*
+ * Balance movements of an account in a time range
+ */
+type Statement struct {
+	Account        string          `json:"account"`
+	From           int64           `json:"from"`           // start of the range (inclusive)
+	To             int64           `json:"to"`             // end of the range (inclusive)
+	OpeningBalance Money           `json:"openingBalance"` // balance before the first movement in range
+	ClosingBalance Money           `json:"closingBalance"` // balance after the last movement in range
+	Lines          []StatementLine `json:"lines"`
+}
+
+type StatementLine struct {
+	CreatedTs    int64  `json:"createdTs"`
+	TxId         string `json:"txId"`
+	Reason       string `json:"reason"`       // 'sale', 'deposit', the fee type, ...
+	Reference    string `json:"reference"`    // related car VIN, bank reference, ...
+	Counterparty string `json:"counterparty"` // the other account of the movement
+	Amount       Money  `json:"amount"`       // negative if the account was charged
+	Balance      Money  `json:"balance"`      // running balance after the movement
+}
+
+type BalanceCheck struct {
+	TotalBalances Money `json:"totalBalances"` // sum of all account balances
+	TotalMinted   Money `json:"totalMinted"`   // money brought into the system
+	Balanced      bool  `json:"balanced"`
 }
 
 type Offer struct {
 	Seller string `json:"seller"`
 	Buyer  string `json:"buyer"`
 	Vin    string `json:"vin"`
-	Price  int    `json:"price"`
+	Price  Money  `json:"price"`
 }
 
 /*
@@ -50,13 +368,148 @@ type Offer struct {
  * The car certificate information is attested by the DOT
  */
 type Certificate struct {
-	Username    string `json:"username"`    // car owners name
+	Owner       string `json:"owner"`       // legal owner, e.g. the leasing company
+	Keeper      string `json:"keeper"`      // registered keeper, insures the car and holds the numberplate
 	Insurer     string `json:"insurer"`     // the name of an insurance company
-	Numberplate string `json:"numberplate"` // number plate ('AG 104 739')
-	Vin         string `json:"vin"`         // vehicle identification number ('WVW ZZZ 6RZ HY26 0780')
+	Numberplate string `json:"numberplate"` // number plate ('AG 104739')
+	Vin         string `json:"vin"`         // vehicle identification number ('WVWZZZ6RZHY260780')
 	Color       string `json:"color"`
 	Type        string `json:"type"` // type: 'passenger car', 'truck', ...
 	Brand       string `json:"brand"`
+
+	// registered without type approval, approved individually by the DOT
+	IndividualApproval bool `json:"individualApproval"`
+
+	// approved test report values, copied at registration
+	TechnicalData
+}
+
+/*
+ * Technical data of the test report (Form. 13.20 A)
+ *
+ * Submitted with the registration proposal,
+ * zero values are not reported.
+ */
+type TechnicalData struct {
+	NumberOfDoors      DoorCount `json:"numberOfDoors"`      // including the tailgate, 5 for '4+1'
+	NumberOfCylinders  int       `json:"numberOfCylinders"`  // 0 for electric cars
+	NumberOfAxis       int       `json:"numberOfAxis"`       // typically 2
+	MaxSpeed           int       `json:"maxSpeed"`           // maximum speed as tested, km/h
+	Displacement       int       `json:"displacement"`       // engine displacement, cm3
+	Power              int       `json:"power"`              // engine power, kW
+	FuelType           string    `json:"fuelType"`           // 'petrol', 'diesel', 'electric', 'hybrid', 'gas' or 'hydrogen'
+	EmissionsClass     string    `json:"emissionsClass"`     // e.g. 'Euro 6d'
+	Co2                int       `json:"co2"`                // CO2 emissions, g/km
+	EmptyWeight        int       `json:"emptyWeight"`        // kg
+	GrossWeight        int       `json:"grossWeight"`        // permitted gross weight, kg
+	Seats              int       `json:"seats"`              // including the driver
+	HomologationNumber string    `json:"homologationNumber"` // type approval number
+	TyreSizes          []string  `json:"tyreSizes"`          // e.g. '205/55 R16 91V'
+}
+
+/*
+ * Numberplate issued by the DOT
+ *
+ * A plate is held by the keeper of the cars carrying it.
+ * Interchangeable plates are carried by two cars of the
+ * same owner. After revocation, a plate either returns
+ * to the pool or is retained for its holder for a while.
+ */
+type Numberplate struct {
+	Numberplate   string                  `json:"numberplate"`   // normalised plate, e.g. 'AG 104739'
+	Holder        string                  `json:"holder"`        // keeper holding the plate
+	Vins          []string                `json:"vins"`          // cars carrying the plate, empty if free or retained
+	RetainedUntil int64                   `json:"retainedUntil"` // end of retention after revocation, 0 if not retained
+	History       []NumberplateAssignment `json:"history"`       // which car carried the plate when, oldest first
+}
+
+type NumberplateAssignment struct {
+	Vin        string `json:"vin"`
+	Holder     string `json:"holder"`
+	Insurer    string `json:"insurer"` // insurer of the car when the plate was assigned
+	AssignedTs int64  `json:"assignedTs"`
+	ReleasedTs int64  `json:"releasedTs"` // 0 while the car carries the plate
+}
+
+/*
+ * Result of a numberplate lookup
+ *
+ * Lists the cars the plate pointed to at the time
+ * of the lookup, two for interchangeable plates.
+ */
+type NumberplateLookup struct {
+	Numberplate string        `json:"numberplate"`
+	Timestamp   int64         `json:"timestamp"` // point in time of the lookup
+	Cars        []PlateHolder `json:"cars"`
+}
+
+type PlateHolder struct {
+	Vin       string `json:"vin"`
+	Keeper    string `json:"keeper"`
+	Insurer   string `json:"insurer"`
+	Confirmed bool   `json:"confirmed"` // car is allowed on the road, only for current lookups
+	Stolen    bool   `json:"stolen"`    // car is reported stolen, only for current lookups
+}
+
+/*
+ * Access to personal data, kept for data-protection audits
+ */
+type AccessLogEntry struct {
+	Username  string `json:"username"`
+	Role      string `json:"role"`
+	Function  string `json:"function"`
+	Subject   string `json:"subject"` // what was looked up, e.g. the numberplate
+	TxId      string `json:"txId"`
+	CreatedTs int64  `json:"createdTs"`
+}
+
+/*
+ * Vanity plate reserved by a user
+ *
+ * The reservation is consumed when the plate
+ * is assigned to a car kept by the user.
+ */
+type NumberplateReservation struct {
+	Numberplate string `json:"numberplate"` // normalised plate, e.g. 'ZH 1000'
+	Username    string `json:"username"`
+	Fee         Money  `json:"fee"` // vanity plate fee paid
+	TxId        string `json:"txId"`
+	CreatedTs   int64  `json:"createdTs"`
+}
+
+type NumberRange struct {
+	From int `json:"from"`
+	To   int `json:"to"` // inclusive
+}
+
+type NumberplateRanges struct {
+	Canton   string        `json:"canton"`
+	Used     []NumberRange `json:"used"`     // plates assigned to cars
+	Retained []NumberRange `json:"retained"` // plates retained for their holder after revocation
+	Reserved []NumberRange `json:"reserved"` // vanity plates not yet assigned
+	Free     []NumberRange `json:"free"`     // plates available for allocation
+}
+
+/*
+ * Approved vehicle type (Typengenehmigung)
+ *
+ * Maintained by the DOT. Cars with the homologation number
+ * of the type have to be within its technical ranges.
+ * Zero values in 'min' and 'max' do not limit the range,
+ * empty lists allow any value.
+ */
+type TypeApproval struct {
+	HomologationNumber string        `json:"homologationNumber"` // e.g. '1VA123'
+	Manufacturer       string        `json:"manufacturer"`       // as decoded from the VIN, e.g. 'Volkswagen'
+	Model              string        `json:"model"`              // e.g. 'Polo'
+	Variant            string        `json:"variant"`            // e.g. '1.0 TSI'
+	Min                TechnicalData `json:"min"`                // lower bounds of the numeric values
+	Max                TechnicalData `json:"max"`                // upper bounds of the numeric values
+	FuelTypes          []string      `json:"fuelTypes"`
+	EmissionsClasses   []string      `json:"emissionsClasses"`
+	TyreSizes          []string      `json:"tyreSizes"`
+	ApprovedBy         string        `json:"approvedBy"` // DOT user
+	CreatedTs          int64         `json:"createdTs"`
 }
 
 /*
@@ -64,10 +517,53 @@ type Certificate struct {
  * (Form. 13.20 A)
  */
 type RegistrationProposal struct {
-	Username          string `json:"username"`
-	Car               string `json:"car"`
-	NumberOfDoors     string `json:"numberOfDoors"`     // '4+1' for a passenger car
-	NumberOfCylinders int    `json:"numberOfCylinders"` // 3, 4, 6, 8 ?
-	NumberOfAxis      int    `json:"numberOfAxis"`      // typically 2
-	MaxSpeed          int    `json:"maxSpeed"`          // maximum speed as tested
+	Id        string             `json:"id"` // transaction that submitted the proposal
+	Username  string             `json:"username"`
+	Car       string             `json:"car"`
+	Canton    string             `json:"canton"`    // canton of the keeper, decided by its authority
+	Status    string             `json:"status"`    // 'pending', 'approved', 'rejected', 'withdrawn'
+	Reason    string             `json:"reason"`    // why the DOT rejected the proposal
+	CreatedTs int64              `json:"createdTs"` // (re)submission date
+	History   []ProposalDecision `json:"history"`   // all status changes, oldest first
+
+	// test report values, validated on submission
+	TechnicalData
+}
+
+type ProposalDecision struct {
+	ProposalId string `json:"proposalId"` // the submission the decision was taken on
+	Status     string `json:"status"`     // status after the decision
+	By         string `json:"by"`         // DOT user or owner
+	Reason     string `json:"reason"`
+	TxId       string `json:"txId"`
+	CreatedTs  int64  `json:"createdTs"`
+}
+
+/*
+ * Queue sizes and processing times of the DOT
+ *
+ * Processing times are medians in seconds over the cars
+ * registered or confirmed within the time window.
+ */
+type DotStatistics struct {
+	From                   int64          `json:"from"` // start of the window (inclusive)
+	To                     int64          `json:"to"`   // end of the window (inclusive)
+	CarsByStatus           map[string]int `json:"carsByStatus"`
+	PendingRegistrations   int            `json:"pendingRegistrations"`
+	PendingRevocations     int            `json:"pendingRevocations"`
+	PendingConfirmations   int            `json:"pendingConfirmations"`
+	OldestPending          *PendingItem   `json:"oldestPending"` // nil if all queues are empty
+	Registrations          int            `json:"registrations"`
+	MedianRegistrationTime int64          `json:"medianRegistrationTime"` // from 'createCar' to 'registerCar'
+	Confirmations          int            `json:"confirmations"`
+	MedianConfirmationTime int64          `json:"medianConfirmationTime"` // from 'registerCar' to 'confirmCar'
+}
+
+/*
+ * Item waiting in a DOT queue
+ */
+type PendingItem struct {
+	Queue     string `json:"queue"` // 'registration', 'revocation' or 'confirmation'
+	Vin       string `json:"vin"`
+	CreatedTs int64  `json:"createdTs"` // since when the item is waiting
 }
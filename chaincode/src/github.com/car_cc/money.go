@@ -0,0 +1,242 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/car_cc/iso4217"
+)
+
+// currency of amounts without currency code
+const defaultCurrency string = "CHF"
+
+/*
+ * Fixed-point amount of money
+ *
+ * The amount is kept in minor units of the currency,
+ * e.g. 1250 CHF minor units are 'CHF 12.50'.
+ */
+type Money struct {
+	Amount   int64  `json:"amount"`   // amount in minor units ('Rappen')
+	Currency string `json:"currency"` // ISO 4217 currency code ('CHF')
+}
+
+/*
+ * Creates an amount in the default currency from minor units
+ */
+func NewMoney(amount int64) Money {
+	return Money{Amount: amount, Currency: defaultCurrency}
+}
+
+/*
+ * Parses an amount of money.
+ *
+ * Accepts the major units with an optional fraction
+ * and an optional currency code before or after the amount,
+ * e.g. '99', '99.5', '99.50 CHF' or 'EUR 12.00'.
+ * Amounts without currency code are in the default currency.
+ */
+func ParseMoney(value string) (Money, error) {
+	fields := strings.Fields(value)
+	currency := defaultCurrency
+	number := ""
+
+	switch len(fields) {
+	case 1:
+		number = fields[0]
+	case 2:
+		if _, err := strconv.ParseFloat(fields[0], 64); err == nil {
+			number, currency = fields[0], fields[1]
+		} else {
+			currency, number = fields[0], fields[1]
+		}
+	default:
+		return Money{}, fmt.Errorf("Invalid amount '%s'", value)
+	}
+
+	digits, supported := iso4217.Digits(currency)
+	if !supported {
+		return Money{}, fmt.Errorf("Unsupported currency '%s'", currency)
+	}
+
+	negative := strings.HasPrefix(number, "-")
+	number = strings.TrimPrefix(number, "-")
+
+	// split major and minor units
+	parts := strings.Split(number, ".")
+	if len(parts) > 2 || parts[0] == "" || (len(parts) == 2 && (parts[1] == "" || len(parts[1]) > digits)) {
+		return Money{}, fmt.Errorf("Invalid amount '%s' for currency %s", value, currency)
+	}
+
+	for _, part := range parts {
+		for _, digit := range part {
+			if digit < '0' || digit > '9' {
+				return Money{}, fmt.Errorf("Invalid amount '%s'", value)
+			}
+		}
+	}
+
+	minor := int64(0)
+	if len(parts) == 2 {
+		minor, _ = strconv.ParseInt(parts[1], 10, 64)
+		minor *= pow10(digits - len(parts[1]))
+	}
+
+	// the amount in minor units has to fit into an int64
+	major, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil || major > (math.MaxInt64-minor)/pow10(digits) {
+		return Money{}, fmt.Errorf("Invalid amount '%s', out of range", value)
+	}
+	amount := major*pow10(digits) + minor
+
+	if negative {
+		amount = -amount
+	}
+
+	return Money{Amount: amount, Currency: currency}, nil
+}
+
+/*
+ * Parses a strictly positive amount of money
+ */
+func ParsePositiveMoney(value string) (Money, error) {
+	money, err := ParseMoney(value)
+	if err != nil {
+		return Money{}, err
+	} else if money.Amount <= 0 {
+		return Money{}, fmt.Errorf("Amount '%s' has to be positive", value)
+	}
+
+	return money, nil
+}
+
+func pow10(n int) int64 {
+	result := int64(1)
+	for i := 0; i < n; i++ {
+		result *= 10
+	}
+	return result
+}
+
+/*
+ * Returns the currency code, amounts without
+ * currency are in the default currency
+ */
+func (m Money) currency() string {
+	if m.Currency == "" {
+		return defaultCurrency
+	}
+	return m.Currency
+}
+
+/*
+ * Adds two amounts of the same currency
+ */
+func (m Money) Add(other Money) (Money, error) {
+	if m.currency() != other.currency() {
+		return Money{}, fmt.Errorf("Cannot add %s to %s, currencies differ", other, m)
+	}
+
+	sum := m.Amount + other.Amount
+	if (other.Amount > 0 && sum < m.Amount) || (other.Amount < 0 && sum > m.Amount) {
+		return Money{}, fmt.Errorf("Cannot add %s to %s, amount out of range", other, m)
+	}
+
+	return Money{Amount: sum, Currency: m.currency()}, nil
+}
+
+/*
+ * Subtracts an amount of the same currency
+ */
+func (m Money) Sub(other Money) (Money, error) {
+	if other.Amount == math.MinInt64 {
+		return Money{}, fmt.Errorf("Cannot subtract %s from %s, amount out of range", other, m)
+	}
+
+	return m.Add(other.Neg())
+}
+
+/*
+ * Returns the negated amount
+ */
+func (m Money) Neg() Money {
+	return Money{Amount: -m.Amount, Currency: m.currency()}
+}
+
+/*
+ * Returns a percentage of the amount,
+ * rounded down to the next minor unit
+ */
+func (m Money) Percent(percent int) (Money, error) {
+	product := m.Amount * int64(percent)
+	if percent != 0 && (product/int64(percent) != m.Amount || (percent == -1 && m.Amount == math.MinInt64)) {
+		return Money{}, fmt.Errorf("Cannot take %d%% of %s, amount out of range", percent, m)
+	}
+
+	return Money{Amount: product / 100, Currency: m.currency()}, nil
+}
+
+/*
+ * Checks if both amounts are in the same currency
+ * and the amount is at least as big as the other one
+ */
+func (m Money) Covers(other Money) bool {
+	return m.currency() == other.currency() && m.Amount >= other.Amount
+}
+
+/*
+ * Formats the amount with its currency, e.g. '99.50 CHF'
+ */
+func (m Money) String() string {
+	return iso4217.Format(m.Amount, m.currency()) + " " + m.currency()
+}
+
+/*
+ * Decodes an amount of money.
+ *
+ * Besides the '{ "amount": 9950, "currency": "CHF" }' format,
+ * legacy integers in major units of the default currency
+ * and strings like '"99.50 CHF"' are accepted, so existing
+ * ledger data and clients keep working during migration.
+ */
+func (m *Money) UnmarshalJSON(data []byte) error {
+	var legacy int64
+	if err := json.Unmarshal(data, &legacy); err == nil {
+		digits, _ := iso4217.Digits(defaultCurrency)
+		if legacy > math.MaxInt64/pow10(digits) || legacy < math.MinInt64/pow10(digits) {
+			return errors.New("Invalid amount of money, out of range")
+		}
+		*m = Money{Amount: legacy * pow10(digits), Currency: defaultCurrency}
+		return nil
+	}
+
+	var value string
+	if err := json.Unmarshal(data, &value); err == nil {
+		parsed, err := ParseMoney(value)
+		if err != nil {
+			return err
+		}
+		*m = parsed
+		return nil
+	}
+
+	// plain struct without custom decoding
+	type money Money
+	var decoded money
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return errors.New("Invalid amount of money")
+	}
+
+	if decoded.Currency != "" {
+		if _, supported := iso4217.Digits(decoded.Currency); !supported {
+			return fmt.Errorf("Unsupported currency '%s'", decoded.Currency)
+		}
+	}
+
+	*m = Money(decoded)
+	return nil
+}
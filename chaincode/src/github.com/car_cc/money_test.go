@@ -0,0 +1,137 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+)
+
+func TestParseMoney(t *testing.T) {
+	valid := map[string]Money{
+		"99":          NewMoney(9900),
+		"99.5":        NewMoney(9950),
+		"99.50 CHF":   NewMoney(9950),
+		"CHF 0.05":    NewMoney(5),
+		"-12.00":      NewMoney(-1200),
+		"12 EUR":      {Amount: 1200, Currency: "EUR"},
+		"1500 JPY":    {Amount: 1500, Currency: "JPY"},
+		" 42.10  CHF": NewMoney(4210),
+	}
+
+	for value, expected := range valid {
+		money, err := ParseMoney(value)
+		if err != nil {
+			t.Errorf("'%s' should be a valid amount: %s", value, err.Error())
+		} else if money != expected {
+			t.Errorf("'%s' parsed as %s, expected %s", value, money, expected)
+		}
+	}
+
+	invalid := []string{"", "abc", "9.999", "1.", ".5", "1e3", "12 XYZ", "15.5 JPY", "1 2 CHF", "+5"}
+	for _, value := range invalid {
+		_, err := ParseMoney(value)
+		if err == nil {
+			t.Errorf("'%s' should not be a valid amount", value)
+		}
+	}
+
+	// amounts in minor units have to fit into an int64
+	outOfRange := []string{"92233720368547758.08", "92233720368547759", "100000000000000000000", "9223372036854775808 JPY"}
+	for _, value := range outOfRange {
+		_, err := ParseMoney(value)
+		if err == nil {
+			t.Errorf("'%s' should be out of range", value)
+		}
+	}
+
+	money, err := ParseMoney("92233720368547758.07")
+	if err != nil || money != NewMoney(math.MaxInt64) {
+		t.Error("The largest amount should be valid")
+	}
+
+	money, err = ParseMoney("-9223372036854775807 JPY")
+	if err != nil || money != (Money{Amount: -math.MaxInt64, Currency: "JPY"}) {
+		t.Error("The smallest negated amount should be valid")
+	}
+
+	_, err = ParsePositiveMoney("0")
+	if err == nil {
+		t.Error("Zero is not a positive amount")
+	}
+}
+
+func TestMoneyArithmetic(t *testing.T) {
+	sum, err := NewMoney(1050).Add(NewMoney(250))
+	if err != nil || sum != NewMoney(1300) {
+		t.Error("Error adding amounts")
+	}
+
+	_, err = NewMoney(1050).Add(Money{Amount: 250, Currency: "EUR"})
+	if err == nil {
+		t.Error("Adding amounts of different currencies should fail")
+	}
+
+	_, err = NewMoney(math.MaxInt64).Add(NewMoney(1))
+	if err == nil {
+		t.Error("Adding beyond the largest amount should fail")
+	}
+
+	_, err = NewMoney(math.MinInt64).Add(NewMoney(-1))
+	if err == nil {
+		t.Error("Adding below the smallest amount should fail")
+	}
+
+	_, err = NewMoney(-2).Sub(NewMoney(math.MaxInt64))
+	if err == nil {
+		t.Error("Subtracting below the smallest amount should fail")
+	}
+
+	sum, err = NewMoney(math.MaxInt64).Add(NewMoney(-1))
+	if err != nil || sum != NewMoney(math.MaxInt64-1) {
+		t.Error("Error adding a negative amount to the largest amount")
+	}
+
+	percentage, err := NewMoney(12345).Percent(10)
+	if err != nil || percentage != NewMoney(1234) {
+		t.Error("Percentage should be rounded down to the next minor unit")
+	}
+
+	_, err = NewMoney(math.MaxInt64 / 10).Percent(20)
+	if err == nil {
+		t.Error("Percentage out of range should fail")
+	}
+
+	if NewMoney(-1205).String() != "-12.05 CHF" {
+		t.Errorf("Wrong formatting of '%s'", NewMoney(-1205))
+	}
+}
+
+func TestMoneyJSON(t *testing.T) {
+	// legacy integers are whole francs
+	var offer Offer
+	err := json.Unmarshal([]byte(`{ "price": 99 }`), &offer)
+	if err != nil || offer.Price != NewMoney(9900) {
+		t.Error("Legacy integer amounts should be accepted")
+	}
+
+	err = json.Unmarshal([]byte(`{ "price": "12.50 EUR" }`), &offer)
+	if err != nil || offer.Price != (Money{Amount: 1250, Currency: "EUR"}) {
+		t.Error("Amounts as string should be accepted")
+	}
+
+	err = json.Unmarshal([]byte(`{ "price": 92233720368547759 }`), &offer)
+	if err == nil {
+		t.Error("Legacy integer amounts out of range should be rejected")
+	}
+
+	err = json.Unmarshal([]byte(`{ "price": { "amount": 5, "currency": "XYZ" } }`), &offer)
+	if err == nil {
+		t.Error("Unsupported currencies should be rejected")
+	}
+
+	// amounts are encoded with their currency
+	moneyAsBytes, _ := json.Marshal(NewMoney(9950))
+	if string(moneyAsBytes) != `{"amount":9950,"currency":"CHF"}` {
+		t.Errorf("Wrong encoding: %s", moneyAsBytes)
+	}
+}
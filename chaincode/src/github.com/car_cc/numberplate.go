@@ -0,0 +1,597 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// highest plate number per canton, given in number of digits
+var cantonPlateDigits = map[string]int{
+	"AG": 6, "AI": 4, "AR": 5, "BE": 6, "BL": 6, "BS": 6, "FR": 6,
+	"GE": 6, "GL": 5, "GR": 6, "JU": 5, "LU": 6, "NE": 6, "NW": 5,
+	"OW": 5, "SG": 6, "SH": 5, "SO": 6, "SZ": 6, "TG": 6, "TI": 6,
+	"UR": 5, "VD": 6, "VS": 6, "ZG": 6, "ZH": 6,
+}
+
+/*
+ * Splits a numberplate into canton and number.
+ *
+ * Accepts plates as written on papers, e.g. 'AG 104 739',
+ * 'ag104739' or 'AG 104'739'. The number has no leading zero
+ * and stays within the number of digits of the canton.
+ */
+func ParseNumberplate(numberplate string) (string, int, error) {
+	plate := strings.ToUpper(numberplate)
+	for _, separator := range []string{" ", ".", "'", "-"} {
+		plate = strings.Replace(plate, separator, "", -1)
+	}
+
+	if len(plate) < 3 {
+		return "", 0, fmt.Errorf("Invalid numberplate '%s', expected canton and number, e.g. 'AG 104739'", numberplate)
+	}
+
+	canton := plate[:2]
+	digits, exists := cantonPlateDigits[canton]
+	if !exists {
+		return "", 0, fmt.Errorf("Invalid numberplate '%s', unknown canton '%s'", numberplate, canton)
+	}
+
+	// Atoi accepts a sign, the number has to be plain digits
+	number, err := strconv.Atoi(plate[2:])
+	if err != nil || strings.Trim(plate[2:], "0123456789") != "" || plate[2] == '0' || number < 1 {
+		return "", 0, fmt.Errorf("Invalid numberplate '%s', expected a number without leading zero", numberplate)
+	} else if len(plate[2:]) > digits {
+		return "", 0, fmt.Errorf("Invalid numberplate '%s', canton %s has at most %d digits", numberplate, canton, digits)
+	}
+
+	return canton, number, nil
+}
+
+/*
+ * Formats a numberplate the way it is stored
+ * on the ledger, e.g. 'AG 104739'.
+ */
+func FormatNumberplate(canton string, number int) string {
+	return fmt.Sprintf("%s %d", canton, number)
+}
+
+/*
+ * Validates and normalises a numberplate.
+ */
+func NormalizeNumberplate(numberplate string) (string, error) {
+	canton, number, err := ParseNumberplate(numberplate)
+	if err != nil {
+		return "", err
+	}
+
+	return FormatNumberplate(canton, number), nil
+}
+
+/*
+ * Returns the numberplate index with all plates
+ * ever issued, mapped by numberplate.
+ */
+func (t *CarChaincode) getNumberplateIndex(stub shim.ChaincodeStubInterface) (map[string]Numberplate, error) {
+	response := t.read(stub, numberplateIndex)
+	index := make(map[string]Numberplate)
+	err := json.Unmarshal(response.Payload, &index)
+	if err != nil {
+		return nil, errors.New("Error parsing numberplate index")
+	}
+
+	return index, nil
+}
+
+/*
+ * Saves the numberplate index.
+ */
+func (t *CarChaincode) saveNumberplateIndex(stub shim.ChaincodeStubInterface, index map[string]Numberplate) error {
+	indexAsBytes, _ := json.Marshal(index)
+	err := stub.PutState(numberplateIndex, indexAsBytes)
+	if err != nil {
+		return errors.New("Error writing numberplate index to ledger")
+	}
+
+	return nil
+}
+
+/*
+ * Checks if a plate is retained for its holder at a point in time.
+ *
+ * Retention ends when the plate is assigned again
+ * or when the retention period is over.
+ */
+func IsRetained(plate *Numberplate, ts int64) bool {
+	return len(plate.Vins) == 0 && plate.RetainedUntil > ts
+}
+
+/*
+ * Checks if a plate is carried by a car or retained at a point in time.
+ */
+func IsTaken(plate *Numberplate, ts int64) bool {
+	return len(plate.Vins) > 0 || IsRetained(plate, ts)
+}
+
+/*
+ * Puts a plate on a car and records the assignment.
+ */
+func assignNumberplate(plate *Numberplate, car *Car, now int64) {
+	plate.Holder = car.Certificate.Keeper
+	plate.Vins = append(plate.Vins, car.Vin)
+	plate.RetainedUntil = 0
+	plate.History = append(plate.History, NumberplateAssignment{
+		Vin:        car.Vin,
+		Holder:     car.Certificate.Keeper,
+		Insurer:    car.Certificate.Insurer,
+		AssignedTs: now})
+
+	car.Certificate.Numberplate = plate.Numberplate
+}
+
+/*
+ * Takes the plate off a car.
+ *
+ * If no other car carries the plate, it either returns
+ * to the pool or is retained for its holder for the
+ * retention period. The car is not written to the ledger.
+ */
+func (t *CarChaincode) releaseNumberplate(stub shim.ChaincodeStubInterface, car *Car, retain bool) error {
+	if car.Certificate.Numberplate == "" {
+		return nil
+	}
+
+	plates, err := t.getNumberplateIndex(stub)
+	if err != nil {
+		return err
+	}
+
+	unassignNumberplate(plates, car, retain, txTimestamp(stub))
+	return t.saveNumberplateIndex(stub, plates)
+}
+
+/*
+ * Takes the plate off a car in the numberplate index.
+ *
+ * Like 'releaseNumberplate', but neither the index
+ * nor the car are written to the ledger.
+ */
+func unassignNumberplate(plates map[string]Numberplate, car *Car, retain bool, now int64) {
+	if car.Certificate.Numberplate == "" {
+		return
+	}
+
+	plate, exists := plates[car.Certificate.Numberplate]
+	if exists {
+		vins := []string{}
+		for _, vin := range plate.Vins {
+			if vin != car.Vin {
+				vins = append(vins, vin)
+			}
+		}
+		plate.Vins = vins
+
+		for i := range plate.History {
+			if plate.History[i].Vin == car.Vin && plate.History[i].ReleasedTs == 0 {
+				plate.History[i].ReleasedTs = now
+			}
+		}
+
+		if retain && len(plate.Vins) == 0 {
+			plate.RetainedUntil = now + plateRetentionPeriod
+		}
+
+		plates[plate.Numberplate] = plate
+	}
+
+	fmt.Printf("Released numberplate '%s' of car with VIN '%s'\n", car.Certificate.Numberplate, car.Vin)
+	car.Certificate.Numberplate = ""
+}
+
+/*
+ * Reads a numberplate with its assignment history.
+ *
+ * On success,
+ * returns the numberplate.
+ */
+func (t *CarChaincode) readNumberplate(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	numberplate, err := NormalizeNumberplate(args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	plates, err := t.getNumberplateIndex(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	plate, exists := plates[numberplate]
+	if !exists {
+		return shim.Error(fmt.Sprintf("Numberplate '%s' was never issued", numberplate))
+	}
+
+	plateAsBytes, _ := json.Marshal(plate)
+	return shim.Success(plateAsBytes)
+}
+
+/*
+ * Resolves a numberplate to the cars carrying it.
+ *
+ * Without a timestamp, the current keeper, insurer,
+ * confirmation and theft status are returned. With a timestamp, the
+ * cars the plate pointed to at that time are looked up in
+ * the plate history, with keeper and insurer at assignment.
+ * Every lookup is written to the access log.
+ *
+ * Arguments required:
+ * [0] Numberplate          (string)
+ * [1] Timestamp            (int, unix seconds, optional)
+ *
+ * On success,
+ * returns the numberplate lookup.
+ */
+func (t *CarChaincode) readCarByNumberplate(stub shim.ChaincodeStubInterface, username string, role string, args []string) pb.Response {
+	numberplate, err := NormalizeNumberplate(args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	now := txTimestamp(stub)
+	lookup := NumberplateLookup{Numberplate: numberplate, Timestamp: now, Cars: []PlateHolder{}}
+	if len(args) > 1 && args[1] != "" {
+		lookup.Timestamp, err = strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			return shim.Error("'readCarByNumberplate' expects a unix timestamp as point in time")
+		}
+	}
+
+	// log the access before anything is disclosed
+	err = t.logAccess(stub, username, role, "readCarByNumberplate", numberplate)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	plates, err := t.getNumberplateIndex(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	plate, exists := plates[numberplate]
+	if !exists {
+		return shim.Error(fmt.Sprintf("Numberplate '%s' was never issued", numberplate))
+	}
+
+	if lookup.Timestamp >= now {
+		// current cars with their current state
+		for _, vin := range plate.Vins {
+			car, err := t.getCarAsDot(stub, vin)
+			if err != nil {
+				return shim.Error(err.Error())
+			}
+
+			lookup.Cars = append(lookup.Cars, PlateHolder{
+				Vin:       car.Vin,
+				Keeper:    car.Certificate.Keeper,
+				Insurer:   car.Certificate.Insurer,
+				Confirmed: IsConfirmed(&car, now),
+				Stolen:    IsStolen(&car)})
+		}
+	} else {
+		// cars carrying the plate at that time
+		for _, assignment := range plate.History {
+			if assignment.AssignedTs <= lookup.Timestamp && (assignment.ReleasedTs == 0 || assignment.ReleasedTs > lookup.Timestamp) {
+				lookup.Cars = append(lookup.Cars, PlateHolder{
+					Vin:     assignment.Vin,
+					Keeper:  assignment.Holder,
+					Insurer: assignment.Insurer})
+			}
+		}
+	}
+
+	lookupAsBytes, _ := json.Marshal(lookup)
+	return shim.Success(lookupAsBytes)
+}
+
+/*
+ * Returns the vanity plate reservations,
+ * mapped by numberplate.
+ */
+func (t *CarChaincode) getReservationIndex(stub shim.ChaincodeStubInterface) (map[string]NumberplateReservation, error) {
+	response := t.read(stub, numberplateReservationIndexStr)
+	index := make(map[string]NumberplateReservation)
+	err := json.Unmarshal(response.Payload, &index)
+	if err != nil {
+		return nil, errors.New("Error parsing numberplate reservation index")
+	}
+
+	return index, nil
+}
+
+/*
+ * Saves the vanity plate reservations.
+ */
+func (t *CarChaincode) saveReservationIndex(stub shim.ChaincodeStubInterface, index map[string]NumberplateReservation) error {
+	indexAsBytes, _ := json.Marshal(index)
+	err := stub.PutState(numberplateReservationIndexStr, indexAsBytes)
+	if err != nil {
+		return errors.New("Error writing numberplate reservation index")
+	}
+
+	return nil
+}
+
+/*
+ * Reserves a vanity plate for a user.
+ *
+ * The plate must neither be in use nor reserved.
+ * The user is charged the vanity plate fee and can
+ * have the plate assigned when the DOT confirms
+ * one of the cars the user keeps.
+ *
+ * Arguments required:
+ * [0] Numberplate          (string, e.g. 'ZH 1000')
+ *
+ * On success,
+ * returns the reservation.
+ */
+func (t *CarChaincode) reserveNumberplate(stub shim.ChaincodeStubInterface, username string, args []string) pb.Response {
+	numberplate, err := NormalizeNumberplate(args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	plates, err := t.getNumberplateIndex(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	} else if plate, exists := plates[numberplate]; exists && IsTaken(&plate, txTimestamp(stub)) {
+		return shim.Error(fmt.Sprintf("Numberplate '%s' is already in use", numberplate))
+	}
+
+	reservations, err := t.getReservationIndex(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	} else if _, reserved := reservations[numberplate]; reserved {
+		return shim.Error(fmt.Sprintf("Numberplate '%s' is already reserved", numberplate))
+	}
+
+	// the user pays for the vanity plate
+	fees, err := t.getFeeSchedule(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	users := make(map[string]*User)
+	err = t.chargeFee(stub, users, username, "vanityPlate", numberplate, fees.VanityPlate)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	err = t.saveUsers(stub, users)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	reservation := NumberplateReservation{
+		Numberplate: numberplate,
+		Username:    username,
+		Fee:         fees.VanityPlate,
+		TxId:        stub.GetTxID(),
+		CreatedTs:   txTimestamp(stub)}
+	reservations[numberplate] = reservation
+
+	err = t.saveReservationIndex(stub, reservations)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	reservationAsBytes, _ := json.Marshal(reservation)
+	return shim.Success(reservationAsBytes)
+}
+
+/*
+ * Finds the lowest free plate number of a canton.
+ *
+ * Plates in use, retained plates and reserved vanity plates are skipped.
+ */
+func (t *CarChaincode) nextFreeNumberplate(stub shim.ChaincodeStubInterface, canton string) (string, error) {
+	digits, exists := cantonPlateDigits[canton]
+	if !exists {
+		return "", fmt.Errorf("Unknown canton '%s'", canton)
+	}
+
+	plates, err := t.getNumberplateIndex(stub)
+	if err != nil {
+		return "", err
+	}
+
+	reservations, err := t.getReservationIndex(stub)
+	if err != nil {
+		return "", err
+	}
+
+	now := txTimestamp(stub)
+	for number := 1; number < int(pow10(digits)); number++ {
+		numberplate := FormatNumberplate(canton, number)
+		plate, used := plates[numberplate]
+		_, reserved := reservations[numberplate]
+		if (!used || !IsTaken(&plate, now)) && !reserved {
+			return numberplate, nil
+		}
+	}
+
+	return "", fmt.Errorf("No free numberplates left in canton %s", canton)
+}
+
+/*
+ * Confirms a car with the next free numberplate of a canton.
+ *
+ * The canton defaults to the canton the car is registered
+ * in, then to the canton of the DOT user. Plates from
+ * outside the jurisdiction of either are refused.
+ *
+ * Arguments required:
+ * [0] Vin                  (string)
+ * [1] Canton               (string, optional, e.g. 'ZH')
+ *
+ * On success,
+ * returns the car with numberplate.
+ */
+func (t *CarChaincode) allocateNumberplate(stub shim.ChaincodeStubInterface, username string, args []string) pb.Response {
+	vin := args[0]
+	canton := ""
+	if len(args) > 1 {
+		canton = args[1]
+	}
+	canton, err := NormalizeCanton(canton)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	car, err := t.getCarAsDot(stub, vin)
+	if err != nil {
+		return shim.Error("Failed to fetch car with vin '" + vin + "' from ledger")
+	}
+
+	authority, err := t.getAuthority(stub, username)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	if canton == "" {
+		canton = car.Authority
+	}
+	if canton == "" {
+		canton = authority
+	}
+
+	if canton == "" {
+		return shim.Error("'allocateNumberplate' expects a canton for cars not registered in a canton")
+	} else if !inJurisdiction(authority, canton) {
+		return shim.Error(fmt.Sprintf("DOT user '%s' acts for canton %s, not for %s", username, authority, canton))
+	} else if !inJurisdiction(car.Authority, canton) {
+		return shim.Error(fmt.Sprintf("Car with VIN '%s' is registered in canton %s, not in %s", vin, car.Authority, canton))
+	}
+
+	numberplate, err := t.nextFreeNumberplate(stub, canton)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Printf("Allocating numberplate '%s' to car with VIN '%s'\n", numberplate, vin)
+	return t.confirmCar(stub, username, []string{vin, numberplate})
+}
+
+/*
+ * Collects plate numbers into ranges of consecutive numbers.
+ */
+func numberRanges(numbers map[int]bool) []NumberRange {
+	sorted := []int{}
+	for number := range numbers {
+		sorted = append(sorted, number)
+	}
+	sort.Ints(sorted)
+
+	ranges := []NumberRange{}
+	for _, number := range sorted {
+		last := len(ranges) - 1
+		if last >= 0 && ranges[last].To == number-1 {
+			ranges[last].To = number
+		} else {
+			ranges = append(ranges, NumberRange{From: number, To: number})
+		}
+	}
+
+	return ranges
+}
+
+/*
+ * Returns the gaps between taken ranges up to the highest plate number.
+ */
+func freeRanges(taken []NumberRange, max int) []NumberRange {
+	ranges := []NumberRange{}
+	next := 1
+	for _, r := range taken {
+		if r.From > next {
+			ranges = append(ranges, NumberRange{From: next, To: r.From - 1})
+		}
+		next = r.To + 1
+	}
+	if next <= max {
+		ranges = append(ranges, NumberRange{From: next, To: max})
+	}
+
+	return ranges
+}
+
+/*
+ * Returns the used, retained, reserved and free
+ * numberplate ranges of a canton.
+ *
+ * Arguments required:
+ * [0] Canton               (string, e.g. 'ZH')
+ *
+ * On success,
+ * returns the numberplate ranges.
+ */
+func (t *CarChaincode) readNumberplateRanges(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	canton := strings.ToUpper(strings.TrimSpace(args[0]))
+	digits, exists := cantonPlateDigits[canton]
+	if !exists {
+		return shim.Error(fmt.Sprintf("Unknown canton '%s'", canton))
+	}
+
+	plates, err := t.getNumberplateIndex(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	reservations, err := t.getReservationIndex(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// collect the taken numbers of the canton
+	now := txTimestamp(stub)
+	used := make(map[int]bool)
+	retained := make(map[int]bool)
+	taken := make(map[int]bool)
+	for numberplate, plate := range plates {
+		plateCanton, number, err := ParseNumberplate(numberplate)
+		if err != nil || plateCanton != canton {
+			continue
+		}
+
+		if len(plate.Vins) > 0 {
+			used[number] = true
+			taken[number] = true
+		} else if IsRetained(&plate, now) {
+			retained[number] = true
+			taken[number] = true
+		}
+	}
+
+	reserved := make(map[int]bool)
+	for numberplate := range reservations {
+		plateCanton, number, err := ParseNumberplate(numberplate)
+		if err == nil && plateCanton == canton {
+			reserved[number] = true
+			taken[number] = true
+		}
+	}
+
+	ranges := NumberplateRanges{
+		Canton:   canton,
+		Used:     numberRanges(used),
+		Retained: numberRanges(retained),
+		Reserved: numberRanges(reserved),
+		Free:     freeRanges(numberRanges(taken), int(pow10(digits))-1)}
+
+	rangesAsBytes, _ := json.Marshal(ranges)
+	return shim.Success(rangesAsBytes)
+}
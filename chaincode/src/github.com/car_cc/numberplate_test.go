@@ -0,0 +1,295 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric/common/util"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+func TestNormalizeNumberplate(t *testing.T) {
+	valid := map[string]string{
+		"AG 104 739": "AG 104739",
+		"ag104739":   "AG 104739",
+		"ZH 7878":    "ZH 7878",
+		"AI 1'234":   "AI 1234",
+	}
+
+	for value, expected := range valid {
+		numberplate, err := NormalizeNumberplate(value)
+		if err != nil {
+			t.Errorf("'%s' should be a valid numberplate: %s", value, err.Error())
+		} else if numberplate != expected {
+			t.Errorf("'%s' normalised to '%s', expected '%s'", value, numberplate, expected)
+		}
+	}
+
+	invalid := []string{"", "ZH", "XX 1234", "ZH 0123", "ZH 1234567", "AI 12345", "ZH 12A4", "AG+5", "ZH +12"}
+	for _, value := range invalid {
+		_, err := NormalizeNumberplate(value)
+		if err == nil {
+			t.Errorf("'%s' should not be a valid numberplate", value)
+		}
+	}
+}
+
+func TestAllocateAndReserveNumberplates(t *testing.T) {
+	username := "amag"
+	vin := "WVWZZZ6RZHY260780"
+	insuranceCompany := "axa"
+
+	// create and name a new chaincode mock
+	carChaincode := &CarChaincode{}
+	stub := shim.NewMockStub("car", carChaincode)
+
+	ccSetup(t, stub)
+
+	stub.MockInvoke(uuid, util.ToChaincodeArgs("setFeeSchedule", "dot-user", "dot", `{ "vanityPlate": "300" }`))
+	stub.MockInvoke(uuid, util.ToChaincodeArgs("createUser", username, "garage", username))
+
+	// reserve a vanity plate, only once
+	response := stub.MockInvoke(uuid, util.ToChaincodeArgs("reserveNumberplate", username, "garage", "ZH 1"))
+	reservation := NumberplateReservation{}
+	err := json.Unmarshal(response.Payload, &reservation)
+	if err != nil {
+		t.Error(response.Message)
+		return
+	}
+
+	if reservation.Numberplate != "ZH 1" || reservation.Fee != NewMoney(30000) {
+		t.Error("Wrong vanity plate reservation")
+	}
+
+	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("reserveNumberplate", "someone", "user", "zh 1"))
+	if response.Status != shim.ERROR {
+		t.Error("Reserved plates should not be reserved twice")
+	}
+
+	// create, register and insure a car
+	stub.MockInvoke(uuid, util.ToChaincodeArgs("create", username, "garage", `{ "vin": "`+vin+`" }`))
+	stub.MockInvoke(uuid, util.ToChaincodeArgs("register", "dot-user", "dot", vin, "individual"))
+	stub.MockInvoke(uuid, util.ToChaincodeArgs("insureProposal", username, "user", vin, insuranceCompany))
+	stub.MockInvoke(uuid, util.ToChaincodeArgs("insuranceAccept", "insurance-user", "insurer", username, vin, insuranceCompany))
+
+	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("confirm", "dot-user", "dot", vin, "ZH 01"))
+	if response.Status != shim.ERROR {
+		t.Error("Invalid numberplates should be rejected")
+	}
+
+	// cantonal authorities only allocate plates of their canton
+	stub.MockInvoke(uuid, util.ToChaincodeArgs("assignAuthority", "federal-user", "dot", "zurich-user", "ZH"))
+	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("allocateNumberplate", "zurich-user", "dot", vin, "be"))
+	if response.Status != shim.ERROR {
+		t.Error("Zurich should not allocate plates of Bern")
+	}
+
+	// allocation skips the reserved plate,
+	// the canton defaults to the one of the authority
+	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("allocateNumberplate", "zurich-user", "dot", vin))
+	car := Car{}
+	err = json.Unmarshal(response.Payload, &car)
+	if err != nil {
+		t.Error(response.Message)
+		return
+	}
+
+	if car.Certificate.Numberplate != "ZH 2" {
+		t.Errorf("Allocated numberplate '%s', expected 'ZH 2'", car.Certificate.Numberplate)
+	}
+
+	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("readNumberplateRanges", "dot-user", "dot", "ZH"))
+	ranges := NumberplateRanges{}
+	err = json.Unmarshal(response.Payload, &ranges)
+	if err != nil {
+		t.Error(response.Message)
+		return
+	}
+
+	fmt.Printf("Numberplate ranges: %v\n", ranges)
+
+	if len(ranges.Used) != 1 || ranges.Used[0] != (NumberRange{From: 2, To: 2}) {
+		t.Error("Wrong used numberplate ranges")
+	} else if len(ranges.Reserved) != 1 || ranges.Reserved[0] != (NumberRange{From: 1, To: 1}) {
+		t.Error("Wrong reserved numberplate ranges")
+	} else if len(ranges.Free) != 1 || ranges.Free[0] != (NumberRange{From: 3, To: 999999}) {
+		t.Error("Wrong free numberplate ranges")
+	}
+
+	// the reserved plate goes to the car of the reserving user
+	stub.MockInvoke(uuid, util.ToChaincodeArgs("revoke", "dot-user", "dot", vin))
+	stub.MockInvoke(uuid, util.ToChaincodeArgs("insureProposal", username, "user", vin, insuranceCompany))
+	stub.MockInvoke(uuid, util.ToChaincodeArgs("insuranceAccept", "insurance-user", "insurer", username, vin, insuranceCompany))
+	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("confirm", "dot-user", "dot", vin, "ZH 1"))
+	car = Car{}
+	err = json.Unmarshal(response.Payload, &car)
+	if err != nil {
+		t.Error(response.Message)
+		return
+	}
+
+	if car.Certificate.Numberplate != "ZH 1" {
+		t.Error("Reserved numberplate not assigned")
+	}
+
+	// the revoked plate is free again
+	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("readNumberplateRanges", "dot-user", "dot", "ZH"))
+	ranges = NumberplateRanges{}
+	json.Unmarshal(response.Payload, &ranges)
+	if len(ranges.Reserved) != 0 || len(ranges.Free) != 1 || ranges.Free[0].From != 2 {
+		t.Error("Numberplates not returned to the pool")
+	}
+}
+
+func TestNumberplateLifecycle(t *testing.T) {
+	username := "amag"
+	vin := "WVWZZZ6RZHY260780"
+	vin2 := "WVWZZZ6RZHY260781"
+	numberplate := "ZH 7878"
+	insuranceCompany := "axa"
+
+	// create and name a new chaincode mock
+	carChaincode := &CarChaincode{}
+	stub := shim.NewMockStub("car", carChaincode)
+
+	ccSetup(t, stub)
+
+	// create, register and insure two cars of the same owner
+	for _, carVin := range []string{vin, vin2} {
+		stub.MockInvoke(uuid, util.ToChaincodeArgs("create", username, "garage", `{ "vin": "`+carVin+`" }`))
+		stub.MockInvoke(uuid, util.ToChaincodeArgs("register", "dot-user", "dot", carVin, "individual"))
+		stub.MockInvoke(uuid, util.ToChaincodeArgs("insureProposal", username, "user", carVin, insuranceCompany))
+		stub.MockInvoke(uuid, util.ToChaincodeArgs("insuranceAccept", "insurance-user", "insurer", username, carVin, insuranceCompany))
+	}
+
+	stub.MockInvoke(uuid, util.ToChaincodeArgs("confirm", "dot-user", "dot", vin, numberplate))
+
+	// plates in use are only shared on request
+	response := stub.MockInvoke(uuid, util.ToChaincodeArgs("confirm", "dot-user", "dot", vin2, numberplate))
+	if response.Status != shim.ERROR {
+		t.Error("Numberplate should not be assigned twice")
+	}
+
+	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("confirmInterchangeable", "dot-user", "dot", vin2, numberplate))
+	car := Car{}
+	err := json.Unmarshal(response.Payload, &car)
+	if err != nil {
+		t.Error(response.Message)
+		return
+	}
+
+	if car.Certificate.Numberplate != numberplate {
+		t.Error("Interchangeable numberplate not assigned")
+	}
+
+	// revoking one car keeps the plate on the other
+	stub.MockInvoke(uuid, util.ToChaincodeArgs("revoke", "dot-user", "dot", vin, "retain"))
+
+	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("readNumberplate", "dot-user", "dot", numberplate))
+	plate := Numberplate{}
+	json.Unmarshal(response.Payload, &plate)
+	if len(plate.Vins) != 1 || plate.Vins[0] != vin2 || IsRetained(&plate, time.Now().Unix()) {
+		t.Error("Numberplate should stay on the other car")
+	}
+
+	// revoking the last car retains the plate for the holder
+	stub.MockInvoke(uuid, util.ToChaincodeArgs("revoke", "dot-user", "dot", vin2, "retain"))
+
+	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("readNumberplate", "dot-user", "dot", numberplate))
+	plate = Numberplate{}
+	json.Unmarshal(response.Payload, &plate)
+
+	fmt.Printf("Numberplate history: %v\n", plate.History)
+
+	if !IsRetained(&plate, time.Now().Unix()) || plate.Holder != username {
+		t.Error("Numberplate should be retained for the holder")
+	} else if len(plate.History) != 2 || plate.History[0].Vin != vin || plate.History[1].ReleasedTs == 0 {
+		t.Error("Numberplate history not recorded")
+	}
+
+	// retained plates are not allocated to others
+	stub.MockInvoke(uuid, util.ToChaincodeArgs("createUser", "bobby", "user", "bobby"))
+	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("reserveNumberplate", "bobby", "user", numberplate))
+	if response.Status != shim.ERROR {
+		t.Error("Retained numberplates should not be reserved by others")
+	}
+
+	// the holder gets the plate back
+	stub.MockInvoke(uuid, util.ToChaincodeArgs("insureProposal", username, "user", vin, insuranceCompany))
+	stub.MockInvoke(uuid, util.ToChaincodeArgs("insuranceAccept", "insurance-user", "insurer", username, vin, insuranceCompany))
+	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("confirm", "dot-user", "dot", vin, numberplate))
+	if response.Status == shim.ERROR {
+		t.Error(response.Message)
+	}
+
+	// revoking without retention returns the plate to the pool
+	stub.MockInvoke(uuid, util.ToChaincodeArgs("revoke", "dot-user", "dot", vin))
+
+	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("readNumberplate", "dot-user", "dot", numberplate))
+	plate = Numberplate{}
+	json.Unmarshal(response.Payload, &plate)
+	if IsTaken(&plate, time.Now().Unix()) || len(plate.History) != 3 {
+		t.Error("Numberplate of revoked car not released")
+	}
+}
+
+func TestReadCarByNumberplate(t *testing.T) {
+	username := "amag"
+	vin := "WVWZZZ6RZHY260780"
+	numberplate := "ZH 7878"
+	insuranceCompany := "axa"
+
+	// create and name a new chaincode mock
+	carChaincode := &CarChaincode{}
+	stub := shim.NewMockStub("car", carChaincode)
+
+	ccSetup(t, stub)
+
+	stub.MockInvoke(uuid, util.ToChaincodeArgs("create", username, "garage", `{ "vin": "`+vin+`" }`))
+	stub.MockInvoke(uuid, util.ToChaincodeArgs("register", "dot-user", "dot", vin, "individual"))
+	stub.MockInvoke(uuid, util.ToChaincodeArgs("insureProposal", username, "user", vin, insuranceCompany))
+	stub.MockInvoke(uuid, util.ToChaincodeArgs("insuranceAccept", "insurance-user", "insurer", username, vin, insuranceCompany))
+	stub.MockInvoke(uuid, util.ToChaincodeArgs("confirm", "dot-user", "dot", vin, numberplate))
+
+	// users cannot resolve numberplates
+	response := stub.MockInvoke(uuid, util.ToChaincodeArgs("readCarByNumberplate", "bobby", "user", numberplate))
+	if response.Status != shim.ERROR {
+		t.Error("Looking up numberplates as 'user' should not be possible")
+	}
+
+	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("readCarByNumberplate", "officer", "police", "zh7878"))
+	lookup := NumberplateLookup{}
+	err := json.Unmarshal(response.Payload, &lookup)
+	if err != nil {
+		t.Error(response.Message)
+		return
+	}
+
+	if len(lookup.Cars) != 1 {
+		t.Error("Numberplate not resolved")
+		return
+	}
+
+	holder := lookup.Cars[0]
+	if holder.Vin != vin || holder.Keeper != username || holder.Insurer != insuranceCompany || !holder.Confirmed {
+		t.Error("Wrong car for numberplate")
+	}
+
+	// the plate was not issued back then
+	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("readCarByNumberplate", "insurance-user", "insurer", numberplate, "1"))
+	lookup = NumberplateLookup{}
+	json.Unmarshal(response.Payload, &lookup)
+	if response.Status == shim.ERROR || len(lookup.Cars) != 0 {
+		t.Error("Numberplate should not point to a car in the past")
+	}
+
+	// both lookups are logged
+	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("readAccessLog", "dot-user", "dot"))
+	var accessLog []AccessLogEntry
+	json.Unmarshal(response.Payload, &accessLog)
+	if len(accessLog) != 2 || accessLog[0].Username != "officer" || accessLog[0].Subject != numberplate {
+		t.Error("Numberplate lookups not logged")
+	}
+}
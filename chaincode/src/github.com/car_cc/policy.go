@@ -0,0 +1,200 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// default term of an insurance policy
+const policyTerm int64 = 365 * 24 * 60 * 60
+
+// coverage types of insurance policies
+var coverageTypes = map[string]bool{
+	"liability":     true,
+	"partial":       true,
+	"comprehensive": true,
+}
+
+/*
+ * Returns the status of a policy at a point in time.
+ *
+ * Active policies are 'pending' before their term
+ * and 'expired' after their term.
+ */
+func PolicyStatus(policy *InsurancePolicy, ts int64) string {
+	if policy.Status != "active" {
+		return policy.Status
+	} else if ts < policy.StartTs {
+		return "pending"
+	} else if ts >= policy.EndTs {
+		return "expired"
+	}
+
+	return "active"
+}
+
+/*
+ * Returns the policy insuring a car at a point in time,
+ * nil if the car has no active policy.
+ */
+func CurrentPolicy(car *Car, ts int64) *InsurancePolicy {
+	for i := len(car.Policies) - 1; i >= 0; i-- {
+		if PolicyStatus(&car.Policies[i], ts) == "active" {
+			return &car.Policies[i]
+		}
+	}
+
+	return nil
+}
+
+/*
+ * Cancels the active or pending policies of a car.
+ *
+ * Active policies end now, pending ones never start.
+ */
+func cancelPolicies(car *Car, now int64) {
+	for i := range car.Policies {
+		policy := &car.Policies[i]
+		status := PolicyStatus(policy, now)
+		if status == "active" || status == "pending" {
+			policy.Status = "cancelled"
+			if policy.EndTs > now {
+				policy.EndTs = now
+			}
+			fmt.Printf("Cancelled insurance policy '%s'\n", policy.Id)
+		}
+	}
+}
+
+/*
+ * Creates the policy for an accepted insurance proposal.
+ *
+ * Terms not given default to a liability insurance
+ * starting now for one year. Earlier policies of
+ * the car are cancelled.
+ */
+func newPolicy(stub shim.ChaincodeStubInterface, car *Car, company string, terms InsurancePolicy) (InsurancePolicy, error) {
+	now := txTimestamp(stub)
+
+	policy := InsurancePolicy{
+		Id:         fmt.Sprintf("%s-%s-%d", company, car.Vin, len(car.Policies)+1),
+		Insurer:    company,
+		Holder:     car.Certificate.Keeper,
+		Vin:        car.Vin,
+		Coverage:   terms.Coverage,
+		Premium:    terms.Premium,
+		Deductible: terms.Deductible,
+		QuoteId:    terms.QuoteId,
+		StartTs:    terms.StartTs,
+		EndTs:      terms.EndTs,
+		Status:     "active",
+		TxId:       stub.GetTxID(),
+		CreatedTs:  now}
+
+	if policy.Coverage == "" {
+		policy.Coverage = "liability"
+	} else if !coverageTypes[policy.Coverage] {
+		return policy, fmt.Errorf("Unknown coverage '%s', expected 'liability', 'partial' or 'comprehensive'", policy.Coverage)
+	}
+
+	if policy.Premium.Amount < 0 {
+		return policy, errors.New("The premium cannot be negative")
+	} else if policy.Premium.Currency == "" {
+		policy.Premium.Currency = defaultCurrency
+	}
+
+	if policy.Deductible.Amount < 0 {
+		return policy, errors.New("The deductible cannot be negative")
+	} else if policy.Deductible.Currency == "" {
+		policy.Deductible.Currency = defaultCurrency
+	}
+
+	if policy.StartTs == 0 {
+		policy.StartTs = now
+	}
+	if policy.EndTs == 0 {
+		policy.EndTs = policy.StartTs + policyTerm
+	} else if policy.EndTs <= policy.StartTs {
+		return policy, errors.New("The policy has to end after its start")
+	} else if policy.EndTs <= now {
+		return policy, errors.New("The policy has to end in the future")
+	}
+
+	return policy, nil
+}
+
+/*
+ * Fetches a car for a policy query.
+ *
+ * The DOT and insurers can read the policies of all cars,
+ * users only those of the cars they own or keep.
+ */
+func (t *CarChaincode) getCarForPolicies(stub shim.ChaincodeStubInterface, username string, role string, vin string) (Car, error) {
+	car, err := t.getCarAsDot(stub, vin)
+	if err != nil {
+		return Car{}, err
+	}
+
+	if role == "dot" || role == "insurer" {
+		return car, nil
+	}
+
+	owner, err := t.getOwner(stub, vin)
+	if err != nil {
+		return Car{}, err
+	} else if owner != username && car.Certificate.Keeper != username {
+		return Car{}, errors.New("Forbidden: this is not your car")
+	}
+
+	return car, nil
+}
+
+/*
+ * Reads all policies of a car.
+ *
+ * The status of every policy is evaluated now.
+ *
+ * On success,
+ * returns a list with policies, oldest first.
+ */
+func (t *CarChaincode) readPolicies(stub shim.ChaincodeStubInterface, username string, role string, vin string) pb.Response {
+	car, err := t.getCarForPolicies(stub, username, role, vin)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	now := txTimestamp(stub)
+	policies := []InsurancePolicy{}
+	for _, policy := range car.Policies {
+		policy.Status = PolicyStatus(&policy, now)
+		policies = append(policies, policy)
+	}
+
+	policiesAsBytes, _ := json.Marshal(policies)
+	return shim.Success(policiesAsBytes)
+}
+
+/*
+ * Reads the policy insuring a car at the time of the transaction.
+ *
+ * On success,
+ * returns the policy.
+ */
+func (t *CarChaincode) readCurrentPolicy(stub shim.ChaincodeStubInterface, username string, role string, vin string) pb.Response {
+	car, err := t.getCarForPolicies(stub, username, role, vin)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	policy := CurrentPolicy(&car, txTimestamp(stub))
+	if policy == nil {
+		return shim.Error(fmt.Sprintf("Car with VIN '%s' has no active insurance policy", vin))
+	}
+
+	policyAsBytes, _ := json.Marshal(policy)
+	return shim.Success(policyAsBytes)
+}
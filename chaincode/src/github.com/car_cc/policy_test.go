@@ -0,0 +1,199 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric/common/util"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+func TestPolicyStatus(t *testing.T) {
+	policy := &InsurancePolicy{Status: "active", StartTs: 100, EndTs: 200}
+
+	expected := map[int64]string{
+		99:  "pending",
+		100: "active",
+		199: "active",
+		200: "expired",
+	}
+	for ts, status := range expected {
+		if PolicyStatus(policy, ts) != status {
+			t.Errorf("Policy should be '%s' at %d", status, ts)
+		}
+	}
+
+	// the current policy depends on the point in time
+	car := &Car{Policies: []InsurancePolicy{*policy}}
+	if CurrentPolicy(car, 150) == nil || CurrentPolicy(car, 200) != nil {
+		t.Error("Current policy not evaluated at the given time")
+	}
+
+	policy.Status = "cancelled"
+	if PolicyStatus(policy, 150) != "cancelled" {
+		t.Error("Cancelled policy should stay cancelled")
+	}
+}
+
+func TestTxTimestamp(t *testing.T) {
+	stub := shim.NewMockStub("car", &CarChaincode{})
+
+	// within a transaction, all peers use the proposal time
+	stub.MockTransactionStart(uuid)
+	ts, _ := stub.GetTxTimestamp()
+	if txTimestamp(stub) != ts.GetSeconds() {
+		t.Error("Transaction time not taken from the proposal")
+	}
+	stub.MockTransactionEnd(uuid)
+}
+
+func TestInsurancePolicies(t *testing.T) {
+	username := "amag"
+	vin := "WVWZZZ6RZHY260780"
+	insuranceCompany := "axa"
+
+	// create and name a new chaincode mock
+	carChaincode := &CarChaincode{}
+	stub := shim.NewMockStub("car", carChaincode)
+
+	ccSetup(t, stub)
+
+	stub.MockInvoke(uuid, util.ToChaincodeArgs("create", username, "garage", `{ "vin": "`+vin+`" }`))
+	stub.MockInvoke(uuid, util.ToChaincodeArgs("register", "dot-user", "dot", vin, "individual"))
+
+	// accepting the insurance creates a default policy
+	stub.MockInvoke(uuid, util.ToChaincodeArgs("insureProposal", username, "user", vin, insuranceCompany))
+	response := stub.MockInvoke(uuid, util.ToChaincodeArgs("insuranceAccept", "insurance-user", "insurer", username, vin, insuranceCompany))
+	if response.Status == shim.ERROR {
+		t.Error(response.Message)
+		return
+	}
+
+	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("readCurrentPolicy", username, "user", vin))
+	policy := InsurancePolicy{}
+	err := json.Unmarshal(response.Payload, &policy)
+	if err != nil {
+		t.Error(response.Message)
+		return
+	}
+
+	if policy.Insurer != insuranceCompany || policy.Holder != username || policy.Coverage != "liability" {
+		t.Errorf("Policy created with wrong terms: %v", policy)
+	}
+
+	// invalid terms are refused
+	stub.MockInvoke(uuid, util.ToChaincodeArgs("insureProposal", username, "user", vin, insuranceCompany))
+	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("insuranceAccept", "insurance-user", "insurer", username, vin, insuranceCompany, `{ "coverage": "everything" }`))
+	if response.Status != shim.ERROR {
+		t.Error("Unknown coverage should be refused")
+	}
+
+	// a policy which already ended is refused
+	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("insuranceAccept", "insurance-user", "insurer", username, vin, insuranceCompany, `{ "coverage": "comprehensive", "startTs": 1000, "endTs": 2000 }`))
+	if response.Status != shim.ERROR {
+		t.Error("Policy which already ended should be refused")
+	}
+
+	// a policy starting later replaces the current one
+	startTs := time.Now().Unix() + 24*60*60
+	terms := fmt.Sprintf(`{ "coverage": "comprehensive", "startTs": %d, "endTs": %d }`, startTs, startTs+policyTerm)
+	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("insuranceAccept", "insurance-user", "insurer", username, vin, insuranceCompany, terms))
+	if response.Status == shim.ERROR {
+		t.Error(response.Message)
+		return
+	}
+
+	car, _ := carChaincode.getCarAsDot(stub, vin)
+	if IsInsured(&car, time.Now().Unix()) {
+		t.Error("Car with a pending policy should not be insured")
+	}
+
+	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("readPolicies", "insurance-user", "insurer", vin))
+	var policies []InsurancePolicy
+	json.Unmarshal(response.Payload, &policies)
+	if len(policies) != 2 || policies[0].Status != "cancelled" || policies[1].Status != "pending" {
+		t.Errorf("Unexpected policy history: %v", policies)
+	}
+
+	if policies[0].EndTs > time.Now().Unix() {
+		t.Error("Cancelled policy should end now")
+	}
+
+	// other users cannot read the policies
+	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("readPolicies", "bobby", "user", vin))
+	if response.Status != shim.ERROR {
+		t.Error("Only owner and keeper should read the policies")
+	}
+}
+
+func TestLapsedPolicyKeepsNumberplate(t *testing.T) {
+	username := "amag"
+	buyer := "bobby"
+	vin := "WVWZZZ6RZHY260780"
+	numberplate := "ZH 1234"
+	insuranceCompany := "axa"
+
+	// create and name a new chaincode mock
+	carChaincode := &CarChaincode{}
+	stub := shim.NewMockStub("car", carChaincode)
+
+	ccSetup(t, stub)
+
+	stub.MockInvoke(uuid, util.ToChaincodeArgs("create", username, "garage", `{ "vin": "`+vin+`" }`))
+	stub.MockInvoke(uuid, util.ToChaincodeArgs("createUser", buyer, "user", buyer))
+	stub.MockInvoke(uuid, util.ToChaincodeArgs("register", "dot-user", "dot", vin, "individual"))
+	stub.MockInvoke(uuid, util.ToChaincodeArgs("insureProposal", username, "garage", vin, insuranceCompany))
+	stub.MockInvoke(uuid, util.ToChaincodeArgs("insuranceAccept", "insurance-user", "insurer", username, vin, insuranceCompany))
+	response := stub.MockInvoke(uuid, util.ToChaincodeArgs("confirm", "dot-user", "dot", vin, numberplate))
+	if response.Status == shim.ERROR {
+		t.Error(response.Message)
+		return
+	}
+
+	// let the policy lapse
+	car, _ := carChaincode.getCarAsDot(stub, vin)
+	car.Policies[0].EndTs = time.Now().Unix() - 1
+	carAsBytes, _ := json.Marshal(car)
+	stub.MockTransactionStart(uuid)
+	stub.PutState(vin, carAsBytes)
+	stub.MockTransactionEnd(uuid)
+
+	if IsInsured(&car, time.Now().Unix()) || !HasNumberplate(&car) {
+		t.Error("Car with a lapsed policy should be uninsured, but keep its numberplate")
+	}
+
+	// the plate is bound to the keeper, the car cannot change hands
+	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("setKeeper", username, "garage", vin, buyer))
+	if response.Status != shim.ERROR {
+		t.Error("Car with a numberplate should not get a new keeper")
+	}
+
+	stub.MockInvoke(uuid, util.ToChaincodeArgs("createSellingOffer", username, "garage", "1000", vin, buyer))
+	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("sell", username, "garage", vin, buyer))
+	if response.Status != shim.ERROR {
+		t.Error("Car with a numberplate should not be sold")
+	}
+
+	// the keeper can still hand back the plate
+	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("revocationProposal", username, "garage", vin, "sale"))
+	if response.Status == shim.ERROR {
+		t.Error(response.Message)
+		return
+	}
+
+	decisions := `[{ "vin": "` + vin + `", "decision": "approve" }]`
+	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("processRevocationRequests", "dot-user", "dot", decisions))
+	var results []RevocationResult
+	json.Unmarshal(response.Payload, &results)
+	if len(results) != 1 || results[0].Status != "approved" {
+		t.Errorf("Revocation of the uninsured car failed: %v", results)
+		return
+	}
+
+	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("sell", username, "garage", vin, buyer))
+	if response.Status == shim.ERROR {
+		t.Error(response.Message)
+	}
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+/*
+ * Answers an insurance proposal with quotes.
+ *
+ * Every quote offers a coverage for a premium and a
+ * deductible. Quotes without validity can be bound for
+ * 'insureProposalMaxAge'. The applicant is notified
+ * and sees the quotes on the own proposal. Quote ids
+ * include the transaction id, so they stay unique when
+ * a proposal is created again.
+ *
+ * Only insurer users of the company can quote.
+ *
+ * Arguments required:
+ * [0] Username of the applicant    (string)
+ * [1] Vin                          (string)
+ * [2] Insurance company            (string)
+ * [3] Quotes                       (string, list of Quote as json)
+ *
+ * On success,
+ * returns the quoted insurance proposal.
+ */
+func (t *CarChaincode) quoteProposal(stub shim.ChaincodeStubInterface, username string, args []string) pb.Response {
+	applicant := args[0]
+	vin := args[1]
+	company := strings.ToLower(args[2])
+
+	err := t.checkInsurer(stub, username, company)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	var quotes []Quote
+	err = json.Unmarshal([]byte(args[3]), &quotes)
+	if err != nil || len(quotes) == 0 {
+		return shim.Error("Error parsing quotes. Expecting a list of Quote as json.")
+	}
+
+	insurerIndex, err := t.getInsurerIndex(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	now := txTimestamp(stub)
+	insurer := insurerIndex[company]
+	var proposal *InsureProposal
+	for i := range insurer.Proposals {
+		if insurer.Proposals[i].Car == vin && insurer.Proposals[i].User == applicant {
+			proposal = &insurer.Proposals[i]
+		}
+	}
+
+	if proposal == nil {
+		return shim.Error(fmt.Sprintf("There is no insurance proposal of '%s' for car '%s' at '%s'", applicant, vin, company))
+	} else if InsureProposalStatus(proposal, now) == "expired" {
+		return shim.Error(fmt.Sprintf("The insurance proposal for car '%s' has expired", vin))
+	}
+
+	for _, quote := range quotes {
+		if quote.Coverage == "" {
+			quote.Coverage = "liability"
+		} else if !coverageTypes[quote.Coverage] {
+			return shim.Error(fmt.Sprintf("Unknown coverage '%s', expected 'liability', 'partial' or 'comprehensive'", quote.Coverage))
+		}
+
+		if quote.Premium.Amount <= 0 {
+			return shim.Error("The premium of a quote has to be positive")
+		} else if quote.Deductible.Amount < 0 {
+			return shim.Error("The deductible cannot be negative")
+		}
+
+		if quote.ValidUntil == 0 {
+			quote.ValidUntil = now + insureProposalMaxAge
+		} else if quote.ValidUntil <= now {
+			return shim.Error("Quotes have to be valid in the future")
+		}
+
+		quote.Id = fmt.Sprintf("%s-%s-%s-q%d", company, vin, stub.GetTxID(), len(proposal.Quotes)+1)
+		quote.CreatedTs = now
+		proposal.Quotes = append(proposal.Quotes, quote)
+	}
+	insurerIndex[company] = insurer
+
+	// show the quotes to the applicant
+	users := make(map[string]*User)
+	user, err := t.loadUser(stub, users, applicant)
+	if err == nil {
+		for i := range user.InsureProposals {
+			own := &user.InsureProposals[i]
+			if own.Car == vin && own.Company == company && own.Status == "pending" {
+				own.Quotes = proposal.Quotes
+			}
+		}
+
+		t.notify(stub, users, applicant, Notification{
+			Type:    "insureProposal",
+			Subject: vin,
+			Status:  "quoted",
+			Message: fmt.Sprintf("Insurance proposal to '%s': %d quote(s) received", company, len(quotes))})
+
+		err = t.saveUsers(stub, users)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+
+	indexAsBytes, _ := json.Marshal(insurerIndex)
+	err = stub.PutState(insurerIndexStr, indexAsBytes)
+	if err != nil {
+		return shim.Error("Error writing insurer index")
+	}
+
+	proposalAsBytes, _ := json.Marshal(proposal)
+	return shim.Success(proposalAsBytes)
+}
+
+/*
+ * Binds a quote of an insurer.
+ *
+ * The proposal is accepted with the terms of the quote,
+ * the premium is charged from the applicant's balance
+ * to the insurer account. The balance has to cover
+ * the premium.
+ *
+ * Arguments required:
+ * [0] Vin                  (string)
+ * [1] Insurance company    (string)
+ * [2] Quote id             (string)
+ *
+ * On success,
+ * returns the new insurance policy.
+ */
+func (t *CarChaincode) bindQuote(stub shim.ChaincodeStubInterface, username string, args []string) pb.Response {
+	vin := args[0]
+	company := strings.ToLower(args[1])
+	quoteId := args[2]
+
+	insurerIndex, err := t.getInsurerIndex(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	var quote *Quote
+	for _, proposal := range insurerIndex[company].Proposals {
+		if proposal.Car == vin && proposal.User == username {
+			for i := range proposal.Quotes {
+				if proposal.Quotes[i].Id == quoteId {
+					quote = &proposal.Quotes[i]
+				}
+			}
+		}
+	}
+
+	if quote == nil {
+		return shim.Error(fmt.Sprintf("There is no quote '%s' for car '%s' at '%s'", quoteId, vin, company))
+	} else if txTimestamp(stub) >= quote.ValidUntil {
+		return shim.Error(fmt.Sprintf("Quote '%s' is no longer valid", quoteId))
+	}
+
+	// accept the proposal with the terms of the quote,
+	// the applicant pays the premium to the insurer
+	terms := InsurancePolicy{
+		Coverage:   quote.Coverage,
+		Premium:    quote.Premium,
+		Deductible: quote.Deductible,
+		QuoteId:    quote.Id}
+	_, policy, err := t.acceptInsureProposal(stub, username, vin, company, terms)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	policyAsBytes, _ := json.Marshal(policy)
+	return shim.Success(policyAsBytes)
+}
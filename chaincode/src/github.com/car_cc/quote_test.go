@@ -0,0 +1,221 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/hyperledger/fabric/common/util"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+func TestQuoteAndBind(t *testing.T) {
+	username := "amag"
+	vin := "WVWZZZ6RZHY260780"
+	insuranceCompany := "axa"
+
+	// create and name a new chaincode mock
+	carChaincode := &CarChaincode{}
+	stub := shim.NewMockStub("car", carChaincode)
+
+	ccSetup(t, stub)
+
+	stub.MockInvoke(uuid, util.ToChaincodeArgs("create", username, "garage", `{ "vin": "`+vin+`" }`))
+	stub.MockInvoke(uuid, util.ToChaincodeArgs("register", "dot-user", "dot", vin, "individual"))
+	stub.MockInvoke(uuid, util.ToChaincodeArgs("insureProposal", username, "garage", vin, insuranceCompany))
+
+	// only insurer users of the company can quote
+	stub.MockInvoke(uuid, util.ToChaincodeArgs("assignAuthority", "federal-user", "dot", "zurich-user", "ZH"))
+	response := stub.MockInvoke(uuid, util.ToChaincodeArgs("assignInsurer", "zurich-user", "dot", "insurance-user", insuranceCompany))
+	if response.Status != shim.ERROR {
+		t.Error("Only the federal office should assign insurers")
+	}
+
+	stub.MockInvoke(uuid, util.ToChaincodeArgs("assignInsurer", "dot-user", "dot", "insurance-user", insuranceCompany))
+	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("quoteProposal", "allianz-user", "insurer", username, vin, insuranceCompany, `[{ "premium": "600.00 CHF" }]`))
+	if response.Status != shim.ERROR {
+		t.Error("Insurer users of other companies should not quote")
+	}
+
+	// quotes need a positive premium
+	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("quoteProposal", "insurance-user", "insurer", username, vin, insuranceCompany, `[{ "coverage": "liability" }]`))
+	if response.Status != shim.ERROR {
+		t.Error("Quote without premium should be refused")
+	}
+
+	quotes := `[{ "coverage": "liability", "premium": "600.00 CHF" },
+		{ "coverage": "comprehensive", "premium": "1400.00 CHF", "deductible": "500.00 CHF" }]`
+	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("quoteProposal", "insurance-user", "insurer", username, vin, insuranceCompany, quotes))
+	proposal := InsureProposal{}
+	err := json.Unmarshal(response.Payload, &proposal)
+	if err != nil {
+		t.Error(response.Message)
+		return
+	}
+
+	if len(proposal.Quotes) != 2 || proposal.Quotes[1].Id != fmt.Sprintf("%s-%s-%s-q2", insuranceCompany, vin, uuid) {
+		t.Errorf("Unexpected quotes: %v", proposal.Quotes)
+		return
+	}
+
+	// the applicant sees the quotes
+	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("readInsureProposals", username, "garage"))
+	var proposals []InsureProposal
+	json.Unmarshal(response.Payload, &proposals)
+	if len(proposals) != 1 || len(proposals[0].Quotes) != 2 {
+		t.Error("Applicant should see the quotes")
+	}
+
+	// binding needs a balance covering the premium
+	quoteId := proposal.Quotes[1].Id
+	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("bindQuote", username, "garage", vin, insuranceCompany, quoteId))
+	if response.Status != shim.ERROR {
+		t.Error("Binding without sufficient balance should fail")
+	}
+
+	stub.MockInvoke(uuid, util.ToChaincodeArgs("deposit", "ubs", "bank", username, "2000", "ubs-0001"))
+	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("bindQuote", username, "garage", vin, insuranceCompany, quoteId))
+	policy := InsurancePolicy{}
+	err = json.Unmarshal(response.Payload, &policy)
+	if err != nil {
+		t.Error(response.Message)
+		return
+	}
+
+	if policy.Coverage != "comprehensive" || policy.Deductible.String() != "500.00 CHF" || policy.QuoteId != quoteId {
+		t.Errorf("Policy not bound with the terms of the quote: %v", policy)
+	}
+
+	user, _ := carChaincode.getUser(stub, username)
+	if user.Balance.String() != "600.00 CHF" {
+		t.Errorf("Premium not charged, balance is %s", user.Balance)
+	}
+
+	insurer, _ := carChaincode.getUser(stub, insurerAccount(insuranceCompany))
+	if insurer.Balance.String() != "1400.00 CHF" {
+		t.Errorf("Premium not credited to the insurer, balance is %s", insurer.Balance)
+	}
+
+	// the proposal is gone, its quotes cannot be bound again
+	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("bindQuote", username, "garage", vin, insuranceCompany, proposal.Quotes[0].Id))
+	if response.Status != shim.ERROR {
+		t.Error("Quotes of an accepted proposal should not be bound")
+	}
+
+	// quotes of a new proposal get new ids
+	stub.MockInvoke(uuid, util.ToChaincodeArgs("insureProposal", username, "garage", vin, insuranceCompany))
+	response = stub.MockInvoke("2", util.ToChaincodeArgs("quoteProposal", "insurance-user", "insurer", username, vin, insuranceCompany, quotes))
+	proposal = InsureProposal{}
+	json.Unmarshal(response.Payload, &proposal)
+	if len(proposal.Quotes) != 2 || proposal.Quotes[1].Id == quoteId {
+		t.Errorf("Quote ids should not be reused: %v", proposal.Quotes)
+	}
+}
+
+func TestBindQuoteOnPeer(t *testing.T) {
+	username := "amag"
+	vin := "WVWZZZ6RZHY260780"
+	insuranceCompany := "axa"
+
+	// writes only show up in later transactions
+	stub := newPeerStub(t)
+
+	stub.invoke("tx1", "create", username, "garage", `{ "vin": "`+vin+`" }`)
+	stub.invoke("tx2", "register", "dot-user", "dot", vin, "individual")
+	stub.invoke("tx3", "insureProposal", username, "garage", vin, insuranceCompany)
+	stub.invoke("tx4", "assignInsurer", "dot-user", "dot", "insurance-user", insuranceCompany)
+	stub.invoke("tx5", "quoteProposal", "insurance-user", "insurer", username, vin, insuranceCompany, `[{ "premium": "600.00 CHF" }]`)
+	stub.invoke("tx6", "deposit", "ubs", "bank", username, "1000", "ubs-0001")
+
+	quoteId := fmt.Sprintf("%s-%s-tx5-q1", insuranceCompany, vin)
+	response := stub.invoke("tx7", "bindQuote", username, "garage", vin, insuranceCompany, quoteId)
+	policy := InsurancePolicy{}
+	err := json.Unmarshal(response.Payload, &policy)
+	if err != nil {
+		t.Error(response.Message)
+		return
+	}
+
+	if policy.QuoteId != quoteId || policy.Premium.String() != "600.00 CHF" {
+		t.Errorf("Policy not bound with the terms of the quote: %v", policy)
+	}
+}
+
+func TestInsuranceAcceptChargesPremium(t *testing.T) {
+	username := "amag"
+	vin := "WVWZZZ6RZHY260780"
+	insuranceCompany := "axa"
+
+	// create and name a new chaincode mock
+	carChaincode := &CarChaincode{}
+	stub := shim.NewMockStub("car", carChaincode)
+
+	ccSetup(t, stub)
+
+	stub.MockInvoke(uuid, util.ToChaincodeArgs("create", username, "garage", `{ "vin": "`+vin+`" }`))
+	stub.MockInvoke(uuid, util.ToChaincodeArgs("register", "dot-user", "dot", vin, "individual"))
+	stub.MockInvoke(uuid, util.ToChaincodeArgs("insureProposal", username, "garage", vin, insuranceCompany))
+
+	// insurers cannot bind quotes on behalf of the applicant
+	response := stub.MockInvoke(uuid, util.ToChaincodeArgs("insuranceAccept", "insurance-user", "insurer", username, vin, insuranceCompany, `{ "premium": "1.00 CHF", "quoteId": "axa-q1" }`))
+	if response.Status != shim.ERROR {
+		t.Error("Insurers should not accept with a quote id")
+	}
+
+	// the premium of direct acceptance has to be covered
+	terms := `{ "coverage": "liability", "premium": "800.00 CHF" }`
+	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("insuranceAccept", "insurance-user", "insurer", username, vin, insuranceCompany, terms))
+	if response.Status != shim.ERROR {
+		t.Error("Accepting without sufficient balance for the premium should fail")
+	}
+
+	stub.MockInvoke(uuid, util.ToChaincodeArgs("deposit", "ubs", "bank", username, "1000", "ubs-0001"))
+	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("insuranceAccept", "insurance-user", "insurer", username, vin, insuranceCompany, terms))
+	if response.Status == shim.ERROR {
+		t.Error(response.Message)
+		return
+	}
+
+	user, _ := carChaincode.getUser(stub, username)
+	if user.Balance.String() != "200.00 CHF" {
+		t.Errorf("Premium not charged, balance is %s", user.Balance)
+	}
+
+	insurer, _ := carChaincode.getUser(stub, insurerAccount(insuranceCompany))
+	if insurer.Balance.String() != "800.00 CHF" {
+		t.Errorf("Premium not credited to the insurer, balance is %s", insurer.Balance)
+	}
+}
+
+func TestInsuranceAcceptOnPeer(t *testing.T) {
+	username := "amag"
+	vin := "WVWZZZ6RZHY260780"
+	insuranceCompany := "axa"
+
+	// writes only show up in later transactions
+	stub := newPeerStub(t)
+
+	stub.invoke("tx1", "create", username, "garage", `{ "vin": "`+vin+`" }`)
+	stub.invoke("tx2", "register", "dot-user", "dot", vin, "individual")
+	stub.invoke("tx3", "insureProposal", username, "garage", vin, insuranceCompany)
+	stub.invoke("tx4", "deposit", "ubs", "bank", username, "1000", "ubs-0001")
+	response := stub.invoke("tx5", "insuranceAccept", "insurance-user", "insurer", username, vin, insuranceCompany, `{ "premium": "800.00 CHF" }`)
+	if response.Status != shim.OK {
+		t.Error(response.Message)
+		return
+	}
+
+	// the premium and the outcome of the proposal both stick
+	user, _ := stub.cc.getUser(stub, username)
+	if user.Balance.String() != "200.00 CHF" {
+		t.Errorf("Premium not charged, balance is %s", user.Balance)
+	}
+	if len(user.InsureProposals) != 1 || user.InsureProposals[0].Status != "accepted" {
+		t.Errorf("Insurance proposal not closed: %v", user.InsureProposals)
+	}
+
+	insurer, _ := stub.cc.getUser(stub, insurerAccount(insuranceCompany))
+	if insurer.Balance.String() != "800.00 CHF" {
+		t.Errorf("Premium not credited to the insurer, balance is %s", insurer.Balance)
+	}
+}
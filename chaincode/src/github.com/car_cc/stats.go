@@ -0,0 +1,180 @@
+package main
+
+import (
+	"encoding/json"
+	"sort"
+	"strconv"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// sorts durations in seconds
+type durations []int64
+
+func (d durations) Len() int           { return len(d) }
+func (d durations) Swap(i, j int)      { d[i], d[j] = d[j], d[i] }
+func (d durations) Less(i, j int) bool { return d[i] < d[j] }
+
+/*
+ * Returns the median of durations, 0 without durations.
+ */
+func median(values []int64) int64 {
+	if len(values) == 0 {
+		return 0
+	}
+
+	sorted := make(durations, len(values))
+	copy(sorted, values)
+	sort.Sort(sorted)
+
+	middle := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[middle-1] + sorted[middle]) / 2
+	}
+	return sorted[middle]
+}
+
+/*
+ * Returns the timestamp of the first status
+ * change to 'status', 0 if there is none.
+ */
+func firstTransitionTs(car *Car, status string) int64 {
+	for _, transition := range car.Transitions {
+		if transition.To == status {
+			return transition.CreatedTs
+		}
+	}
+
+	return 0
+}
+
+/*
+ * Returns the timestamp of the latest status
+ * change to 'status', 0 if there is none.
+ */
+func lastTransitionTs(car *Car, status string) int64 {
+	for i := len(car.Transitions) - 1; i >= 0; i-- {
+		if car.Transitions[i].To == status {
+			return car.Transitions[i].CreatedTs
+		}
+	}
+
+	return 0
+}
+
+/*
+ * Remembers the item if it waits longer
+ * than the oldest pending item so far.
+ */
+func oldestPending(oldest *PendingItem, queue string, vin string, createdTs int64) *PendingItem {
+	if oldest == nil || createdTs < oldest.CreatedTs ||
+		(createdTs == oldest.CreatedTs && vin < oldest.Vin) {
+		return &PendingItem{Queue: queue, Vin: vin, CreatedTs: createdTs}
+	}
+
+	return oldest
+}
+
+/*
+ * Computes the DOT statistics from the ledger.
+ *
+ * Counts cars by lifecycle status and the sizes of the
+ * registration, revocation and confirmation queues. The
+ * processing times only cover cars with a status history.
+ *
+ * Arguments (optional):
+ * [0] From timestamp          (int, unix seconds, default 0)
+ * [1] To timestamp            (int, unix seconds, default now)
+ *
+ * On success,
+ * returns the statistics.
+ */
+func (t *CarChaincode) readStatistics(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	from := int64(0)
+	to := txTimestamp(stub)
+	var err error
+
+	// time window input sanitation
+	if len(args) > 0 && args[0] != "" {
+		from, err = strconv.ParseInt(args[0], 10, 64)
+		if err != nil {
+			return shim.Error("'readStatistics' expects a unix timestamp as start of the window")
+		}
+	}
+	if len(args) > 1 && args[1] != "" {
+		to, err = strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			return shim.Error("'readStatistics' expects a unix timestamp as end of the window")
+		}
+	}
+	if from > to {
+		return shim.Error("Start of the window has to be before its end")
+	}
+
+	stats := DotStatistics{From: from, To: to, CarsByStatus: make(map[string]int)}
+
+	proposals, err := t.getPendingRegistrationProposals(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	stats.PendingRegistrations = len(proposals)
+	for vin, proposal := range proposals {
+		stats.OldestPending = oldestPending(stats.OldestPending, "registration", vin, proposal.CreatedTs)
+	}
+
+	requests, err := t.getRevocationRequests(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	stats.PendingRevocations = len(requests)
+	for vin, request := range requests {
+		stats.OldestPending = oldestPending(stats.OldestPending, "revocation", vin, request.CreatedTs)
+	}
+
+	carIndex, err := t.getCarIndex(stub)
+	if err != nil {
+		return shim.Error("Error getting car index")
+	}
+
+	var registrationTimes, confirmationTimes []int64
+	for vin := range carIndex {
+		car, err := t.getCarAsDot(stub, vin)
+		if err != nil {
+			return shim.Error("Error getting car")
+		}
+
+		status := CarStatus(&car)
+		stats.CarsByStatus[status]++
+
+		// insured cars wait for their numberplate
+		if status == "insured" {
+			stats.PendingConfirmations++
+			insuredTs := lastTransitionTs(&car, "insured")
+			if insuredTs == 0 {
+				insuredTs = car.CreatedTs
+			}
+			stats.OldestPending = oldestPending(stats.OldestPending, "confirmation", vin, insuredTs)
+		}
+
+		registeredTs := firstTransitionTs(&car, "registered")
+		if registeredTs >= from && registeredTs <= to && registeredTs > 0 {
+			registrationTimes = append(registrationTimes, registeredTs-car.CreatedTs)
+		}
+
+		confirmedTs := firstTransitionTs(&car, "confirmed")
+		if confirmedTs >= from && confirmedTs <= to && confirmedTs > 0 && registeredTs > 0 {
+			confirmationTimes = append(confirmationTimes, confirmedTs-registeredTs)
+		}
+	}
+
+	stats.Registrations = len(registrationTimes)
+	stats.MedianRegistrationTime = median(registrationTimes)
+	stats.Confirmations = len(confirmationTimes)
+	stats.MedianConfirmationTime = median(confirmationTimes)
+
+	statsAsBytes, _ := json.Marshal(stats)
+	return shim.Success(statsAsBytes)
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/hyperledger/fabric/common/util"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+func TestMedian(t *testing.T) {
+	cases := []struct {
+		values []int64
+		median int64
+	}{
+		{nil, 0},
+		{[]int64{5}, 5},
+		{[]int64{9, 1, 5}, 5},
+		{[]int64{8, 2, 4, 6}, 5},
+	}
+
+	for _, c := range cases {
+		if m := median(c.values); m != c.median {
+			t.Errorf("Median of %v is %d, expected %d", c.values, m, c.median)
+		}
+	}
+}
+
+func TestReadStatistics(t *testing.T) {
+	username := "amag"
+	insuranceCompany := "axa"
+	vins := []string{"WVWZZZ6RZHY260780", "WVWZZZ6RZHY260781", "WVWZZZ6RZHY260782"}
+
+	// create and name a new chaincode mock
+	carChaincode := &CarChaincode{}
+	stub := shim.NewMockStub("car", carChaincode)
+
+	ccSetup(t, stub)
+
+	// one car waits for registration, one for confirmation,
+	// one is on the road with a revocation request
+	for _, vin := range vins {
+		stub.MockInvoke(uuid, util.ToChaincodeArgs("create", username, "garage", `{ "vin": "`+vin+`" }`))
+	}
+	for _, vin := range vins[1:] {
+		stub.MockInvoke(uuid, util.ToChaincodeArgs("register", "dot-user", "dot", vin, "individual"))
+		stub.MockInvoke(uuid, util.ToChaincodeArgs("insureProposal", username, "user", vin, insuranceCompany))
+		stub.MockInvoke(uuid, util.ToChaincodeArgs("insuranceAccept", "insurance-user", "insurer", username, vin, insuranceCompany))
+	}
+	stub.MockInvoke(uuid, util.ToChaincodeArgs("confirm", "dot-user", "dot", vins[2], "ZH 7878"))
+	stub.MockInvoke(uuid, util.ToChaincodeArgs("revocationProposal", username, "user", vins[2], "sale"))
+
+	response := stub.MockInvoke(uuid, util.ToChaincodeArgs("readStatistics", username, "user"))
+	if response.Status != shim.ERROR {
+		t.Error("Only the DOT should read statistics")
+	}
+
+	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("readStatistics", "dot-user", "dot"))
+	stats := DotStatistics{}
+	err := json.Unmarshal(response.Payload, &stats)
+	if err != nil {
+		t.Error(response.Message)
+		return
+	}
+
+	if stats.CarsByStatus["registrationPending"] != 1 || stats.CarsByStatus["insured"] != 1 || stats.CarsByStatus["confirmed"] != 1 {
+		t.Errorf("Wrong car counts: %v", stats.CarsByStatus)
+	}
+
+	if stats.PendingRegistrations != 1 || stats.PendingConfirmations != 1 || stats.PendingRevocations != 1 {
+		t.Errorf("Wrong queue sizes: %+v", stats)
+	}
+
+	if stats.OldestPending == nil || stats.OldestPending.Queue != "registration" || stats.OldestPending.Vin != vins[0] {
+		t.Errorf("Wrong oldest pending item: %+v", stats.OldestPending)
+	}
+
+	if stats.Registrations != 2 || stats.Confirmations != 1 {
+		t.Errorf("Wrong number of processed cars: %+v", stats)
+	}
+
+	// nothing was processed in the past
+	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("readStatistics", "dot-user", "dot", "0", "1000"))
+	stats = DotStatistics{}
+	json.Unmarshal(response.Payload, &stats)
+	if stats.Registrations != 0 || stats.Confirmations != 0 {
+		t.Error("Processing times should only cover the time window")
+	}
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+/*
+ * Number of doors of a car, including the tailgate
+ */
+type DoorCount int
+
+/*
+ * Decodes the number of doors.
+ *
+ * Besides plain numbers, strings in the notation of the
+ * test report like '"4+1"' (doors plus tailgate) and numbers
+ * as strings are accepted, so existing ledger data and
+ * clients keep working during migration.
+ */
+func (d *DoorCount) UnmarshalJSON(data []byte) error {
+	var count int
+	if err := json.Unmarshal(data, &count); err == nil {
+		*d = DoorCount(count)
+		return nil
+	}
+
+	var legacy string
+	if err := json.Unmarshal(data, &legacy); err != nil {
+		return errors.New("Invalid number of doors")
+	}
+
+	// empty strings were used for unreported values
+	*d = 0
+	if strings.TrimSpace(legacy) == "" {
+		return nil
+	}
+
+	for _, part := range strings.Split(legacy, "+") {
+		doors, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil || doors < 0 {
+			return fmt.Errorf("Invalid number of doors '%s'", legacy)
+		}
+		*d += DoorCount(doors)
+	}
+
+	return nil
+}
+
+// fuel types of the test report
+var fuelTypes = map[string]bool{
+	"petrol":   true,
+	"diesel":   true,
+	"electric": true,
+	"hybrid":   true,
+	"gas":      true,
+	"hydrogen": true,
+}
+
+// emissions classes of the test report
+var emissionsClasses = map[string]bool{
+	"Euro 1": true, "Euro 2": true, "Euro 3": true, "Euro 4": true,
+	"Euro 5": true, "Euro 5a": true, "Euro 5b": true,
+	"Euro 6": true, "Euro 6b": true, "Euro 6c": true,
+	"Euro 6d-TEMP": true, "Euro 6d": true, "Euro 6e": true,
+}
+
+// tyre size as on the sidewall, e.g. '205/55 R16 91V'
+var tyreSizePattern = regexp.MustCompile(`^[0-9]{3}/[0-9]{2} ?Z?R ?[0-9]{2}( [0-9]{2,3}[A-Z])?$`)
+
+// numeric value of the test report
+type technicalValue struct {
+	field string
+	value int
+}
+
+// plausible ranges of the numeric values
+var plausibleRanges = map[string][2]int{
+	"numberOfDoors":     {1, 9},
+	"numberOfCylinders": {1, 16},
+	"numberOfAxis":      {1, 9},
+	"maxSpeed":          {1, 500},
+	"displacement":      {50, 20000},
+	"power":             {1, 2000},
+	"co2":               {1, 1000},
+	"emptyWeight":       {100, 60000},
+	"grossWeight":       {100, 60000},
+	"seats":             {1, 99},
+}
+
+/*
+ * Returns the numeric values of the test report
+ * with their json field names.
+ */
+func numericValues(data *TechnicalData) []technicalValue {
+	return []technicalValue{
+		{"numberOfDoors", int(data.NumberOfDoors)},
+		{"numberOfCylinders", data.NumberOfCylinders},
+		{"numberOfAxis", data.NumberOfAxis},
+		{"maxSpeed", data.MaxSpeed},
+		{"displacement", data.Displacement},
+		{"power", data.Power},
+		{"co2", data.Co2},
+		{"emptyWeight", data.EmptyWeight},
+		{"grossWeight", data.GrossWeight},
+		{"seats", data.Seats},
+	}
+}
+
+/*
+ * Validates the technical data of a test report.
+ *
+ * All values are optional, reported values have to be
+ * within their plausible range and consistent
+ * with each other.
+ */
+func ValidateTechnicalData(data *TechnicalData) error {
+	// zero values are not reported and always pass
+	for _, v := range numericValues(data) {
+		bounds := plausibleRanges[v.field]
+		if v.value != 0 && (v.value < bounds[0] || v.value > bounds[1]) {
+			return fmt.Errorf("'%s' has to be between %d and %d, got %d", v.field, bounds[0], bounds[1], v.value)
+		}
+	}
+
+	if data.FuelType != "" && !fuelTypes[data.FuelType] {
+		return fmt.Errorf("Unknown fuel type '%s'", data.FuelType)
+	}
+
+	if data.EmissionsClass != "" && !emissionsClasses[data.EmissionsClass] {
+		return fmt.Errorf("Unknown emissions class '%s'", data.EmissionsClass)
+	}
+
+	// electric cars have neither cylinders nor displacement
+	if data.FuelType == "electric" && (data.NumberOfCylinders != 0 || data.Displacement != 0) {
+		return fmt.Errorf("Electric cars have no cylinders and no displacement")
+	}
+
+	if data.GrossWeight != 0 && data.GrossWeight < data.EmptyWeight {
+		return fmt.Errorf("Gross weight %d kg is below the empty weight %d kg", data.GrossWeight, data.EmptyWeight)
+	}
+
+	for _, tyreSize := range data.TyreSizes {
+		if !tyreSizePattern.MatchString(tyreSize) {
+			return fmt.Errorf("Tyre size '%s' is invalid, expected e.g. '205/55 R16 91V'", tyreSize)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/hyperledger/fabric/common/util"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+func TestValidateTechnicalData(t *testing.T) {
+	valid := []TechnicalData{
+		{},
+		{NumberOfDoors: 5, NumberOfCylinders: 4, NumberOfAxis: 2, MaxSpeed: 210, Displacement: 1984, Power: 110,
+			FuelType: "petrol", EmissionsClass: "Euro 6d-TEMP", Co2: 139, EmptyWeight: 1320, GrossWeight: 1830, Seats: 5,
+			HomologationNumber: "1VA123", TyreSizes: []string{"205/55 R16 91V", "225/40ZR18"}},
+		{FuelType: "electric", Power: 225, EmptyWeight: 1847, GrossWeight: 2232},
+	}
+
+	for _, data := range valid {
+		if err := ValidateTechnicalData(&data); err != nil {
+			t.Errorf("Technical data %+v should be valid: %s", data, err)
+		}
+	}
+
+	invalid := []TechnicalData{
+		{MaxSpeed: 900},
+		{NumberOfDoors: -1},
+		{FuelType: "coal"},
+		{EmissionsClass: "Euro 7"},
+		{FuelType: "electric", NumberOfCylinders: 4},
+		{EmptyWeight: 1500, GrossWeight: 1200},
+		{TyreSizes: []string{"very big"}},
+	}
+
+	for _, data := range invalid {
+		if err := ValidateTechnicalData(&data); err == nil {
+			t.Errorf("Technical data %+v should be invalid", data)
+		}
+	}
+}
+
+func TestRegisterCarCopiesTechnicalData(t *testing.T) {
+	username := "amag"
+	vin := "WVWZZZ6RZHY260780"
+
+	// create and name a new chaincode mock
+	carChaincode := &CarChaincode{}
+	stub := shim.NewMockStub("car", carChaincode)
+
+	ccSetup(t, stub)
+
+	// implausible or malformed data is refused
+	response := stub.MockInvoke(uuid, util.ToChaincodeArgs("create", username, "garage", `{ "vin": "`+vin+`" }`, `{ "maxSpeed": 900 }`))
+	if response.Status != shim.ERROR {
+		t.Error("Creating a car with an implausible test report should not be possible")
+	}
+
+	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("create", username, "garage", `{ "vin": "`+vin+`" }`, `{ "numberOfDoors": "four" }`))
+	if response.Status != shim.ERROR {
+		t.Error("Creating a car with malformed registration data should not be possible")
+	}
+
+	data := `{ "numberOfDoors": 5, "power": 110, "fuelType": "diesel", "emissionsClass": "Euro 6", "tyreSizes": ["205/55 R16 91V"] }`
+	stub.MockInvoke(uuid, util.ToChaincodeArgs("create", username, "garage", `{ "vin": "`+vin+`" }`, data))
+
+	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("register", "dot-user", "dot", vin, "individual"))
+	car := Car{}
+	err := json.Unmarshal(response.Payload, &car)
+	if err != nil {
+		t.Error(response.Message)
+		return
+	}
+
+	certificate := car.Certificate
+	if certificate.NumberOfDoors != 5 || certificate.Power != 110 || certificate.FuelType != "diesel" ||
+		certificate.EmissionsClass != "Euro 6" || len(certificate.TyreSizes) != 1 {
+		t.Errorf("Technical data not copied to the certificate: %+v", certificate.TechnicalData)
+	}
+}
+
+func TestDoorCount(t *testing.T) {
+	expected := map[string]DoorCount{
+		`5`:     5,
+		`"5"`:   5,
+		`"4+1"`: 5,
+		`"2+1"`: 3,
+		`""`:    0,
+		`null`:  0,
+	}
+
+	for input, doors := range expected {
+		data := TechnicalData{}
+		err := json.Unmarshal([]byte(`{ "numberOfDoors": `+input+` }`), &data)
+		if err != nil || data.NumberOfDoors != doors {
+			t.Errorf("Expected %d doors for %s, got %d (%v)", doors, input, data.NumberOfDoors, err)
+		}
+	}
+
+	for _, input := range []string{`"four"`, `"4+"`, `true`} {
+		data := TechnicalData{}
+		if json.Unmarshal([]byte(`{ "numberOfDoors": `+input+` }`), &data) == nil {
+			t.Errorf("Number of doors %s should be invalid", input)
+		}
+	}
+
+	// proposals stored with the legacy notation can still be read
+	proposals := make(map[string]RegistrationProposal)
+	err := json.Unmarshal([]byte(`{ "WVWZZZ6RZHY260780": { "car": "WVWZZZ6RZHY260780", "numberOfDoors": "4+1" } }`), &proposals)
+	if err != nil || proposals["WVWZZZ6RZHY260780"].NumberOfDoors != 5 {
+		t.Errorf("Legacy registration proposal index not readable: %v", err)
+	}
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+/*
+ * Checks if a car is currently reported stolen.
+ *
+ * Stolen cars cannot be sold, insured, registered
+ * or confirmed until they are recovered.
+ */
+func IsStolen(car *Car) bool {
+	last := len(car.TheftReports) - 1
+	stolen := last >= 0 && car.TheftReports[last].RecoveredTs == 0
+
+	if stolen {
+		fmt.Printf("Car with VIN '%s' is reported stolen\n", car.Vin)
+	}
+
+	return stolen
+}
+
+/*
+ * Returns the index of currently stolen cars.
+ */
+func (t *CarChaincode) getStolenIndex(stub shim.ChaincodeStubInterface) (map[string]TheftReport, error) {
+	response := t.read(stub, stolenIndexStr)
+	stolenIndex := make(map[string]TheftReport)
+	err := json.Unmarshal(response.Payload, &stolenIndex)
+	if err != nil {
+		return nil, errors.New("Error parsing stolen car index")
+	}
+
+	return stolenIndex, nil
+}
+
+/*
+ * Fetches a car for a theft report.
+ *
+ * The police can report any car,
+ * users only the cars they own.
+ */
+func (t *CarChaincode) getCarForTheftReport(stub shim.ChaincodeStubInterface, username string, role string, vin string) (Car, error) {
+	if role == "police" {
+		return t.getCarAsDot(stub, vin)
+	}
+
+	return t.getCar(stub, username, vin)
+}
+
+/*
+ * Flags a car as stolen or as recovered.
+ *
+ * Arguments required:
+ * [0] Vin                  (string)
+ * [1] Reference            (string, police case number, optional)
+ *
+ * On success,
+ * returns the car.
+ */
+func (t *CarChaincode) reportTheft(stub shim.ChaincodeStubInterface, username string, role string, args []string, stolen bool) pb.Response {
+	vin := args[0]
+	reference := ""
+	if len(args) > 1 {
+		reference = args[1]
+	}
+
+	car, err := t.getCarForTheftReport(stub, username, role, vin)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	stolenIndex, err := t.getStolenIndex(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	now := txTimestamp(stub)
+	if stolen {
+		if IsStolen(&car) {
+			return shim.Error(fmt.Sprintf("Car with VIN '%s' is already reported stolen", vin))
+		}
+
+		report := TheftReport{
+			ReportedBy: username,
+			Reference:  reference,
+			ReportedTs: now}
+		car.TheftReports = append(car.TheftReports, report)
+		stolenIndex[vin] = report
+	} else {
+		if !IsStolen(&car) {
+			return shim.Error(fmt.Sprintf("Car with VIN '%s' is not reported stolen", vin))
+		}
+
+		report := &car.TheftReports[len(car.TheftReports)-1]
+		report.RecoveredBy = username
+		report.RecoveredTs = now
+		if reference != "" {
+			report.Reference = reference
+		}
+		delete(stolenIndex, vin)
+	}
+
+	carAsBytes, _ := json.Marshal(car)
+	err = stub.PutState(vin, carAsBytes)
+	if err != nil {
+		return shim.Error("Error writing car")
+	}
+
+	indexAsBytes, _ := json.Marshal(stolenIndex)
+	err = stub.PutState(stolenIndexStr, indexAsBytes)
+	if err != nil {
+		return shim.Error("Error writing stolen car index")
+	}
+
+	return shim.Success(carAsBytes)
+}
+
+/*
+ * Returns all currently stolen cars for border checks.
+ *
+ * On success,
+ * returns a list with stolen cars.
+ */
+func (t *CarChaincode) getStolenCars(stub shim.ChaincodeStubInterface) pb.Response {
+	stolenIndex, err := t.getStolenIndex(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	stolenCars := []Car{}
+	for vin := range stolenIndex {
+		car, err := t.getCarAsDot(stub, vin)
+		if err != nil {
+			return shim.Error("Error getting car")
+		}
+		stolenCars = append(stolenCars, car)
+	}
+
+	stolenCarsAsBytes, _ := json.Marshal(stolenCars)
+	return shim.Success(stolenCarsAsBytes)
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/hyperledger/fabric/common/util"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+func TestStolenCar(t *testing.T) {
+	username := "amag"
+	buyer := "bobby"
+	vin := "WVWZZZ6RZHY260780"
+	numberplate := "ZH 7878"
+	insuranceCompany := "axa"
+
+	// create and name a new chaincode mock
+	carChaincode := &CarChaincode{}
+	stub := shim.NewMockStub("car", carChaincode)
+
+	ccSetup(t, stub)
+
+	stub.MockInvoke(uuid, util.ToChaincodeArgs("create", username, "garage", `{ "vin": "`+vin+`" }`))
+	stub.MockInvoke(uuid, util.ToChaincodeArgs("createUser", buyer, "user", buyer))
+
+	// only the owner or the police can report a car stolen
+	response := stub.MockInvoke(uuid, util.ToChaincodeArgs("reportStolen", buyer, "user", vin))
+	if response.Status != shim.ERROR {
+		t.Error("Only the owner should report a car stolen")
+	}
+
+	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("reportStolen", username, "garage", vin, "ZH-2017-1234"))
+	car := Car{}
+	err := json.Unmarshal(response.Payload, &car)
+	if err != nil {
+		t.Error(response.Message)
+		return
+	}
+
+	if !IsStolen(&car) || car.TheftReports[0].Reference != "ZH-2017-1234" {
+		t.Error("Car not reported stolen")
+	}
+
+	// stolen cars are blocked
+	blocked := map[string][]string{
+		"register":           {"register", "dot-user", "dot", vin},
+		"insureProposal":     {"insureProposal", username, "user", vin, insuranceCompany},
+		"createSellingOffer": {"createSellingOffer", username, "garage", "1000", vin, buyer},
+	}
+	for function, args := range blocked {
+		response = stub.MockInvoke(uuid, util.ToChaincodeArgs(args...))
+		if response.Status != shim.ERROR {
+			t.Errorf("'%s' should refuse stolen cars", function)
+		}
+	}
+
+	// stolen cars show up for border checks
+	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("getStolenCarsAsList", "officer", "police"))
+	var stolenCars []Car
+	json.Unmarshal(response.Payload, &stolenCars)
+	if len(stolenCars) != 1 || stolenCars[0].Vin != vin {
+		t.Error("Stolen car missing in the list")
+	}
+
+	// the police reports the car recovered
+	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("reportRecovered", "officer", "police", vin))
+	car = Car{}
+	json.Unmarshal(response.Payload, &car)
+	if IsStolen(&car) || car.TheftReports[0].RecoveredBy != "officer" {
+		t.Error("Car not reported recovered")
+	}
+
+	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("getStolenCarsAsList", "dot-user", "dot"))
+	stolenCars = nil
+	json.Unmarshal(response.Payload, &stolenCars)
+	if len(stolenCars) != 0 {
+		t.Error("Recovered car should not be in the list")
+	}
+
+	// the recovered car can be confirmed again
+	stub.MockInvoke(uuid, util.ToChaincodeArgs("register", "dot-user", "dot", vin, "individual"))
+	stub.MockInvoke(uuid, util.ToChaincodeArgs("insureProposal", username, "user", vin, insuranceCompany))
+	stub.MockInvoke(uuid, util.ToChaincodeArgs("insuranceAccept", "insurance-user", "insurer", username, vin, insuranceCompany))
+	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("confirm", "dot-user", "dot", vin, numberplate))
+	if response.Status == shim.ERROR {
+		t.Error(response.Message)
+		return
+	}
+
+	// the numberplate lookup shows the theft status
+	stub.MockInvoke(uuid, util.ToChaincodeArgs("reportStolen", "officer", "police", vin))
+	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("readCarByNumberplate", "officer", "police", numberplate))
+	lookup := NumberplateLookup{}
+	json.Unmarshal(response.Payload, &lookup)
+	if len(lookup.Cars) != 1 || !lookup.Cars[0].Stolen {
+		t.Error("Numberplate lookup should show the stolen status")
+	}
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+/*
+ * Returns the type approval catalogue by homologation number.
+ */
+func (t *CarChaincode) getTypeApprovals(stub shim.ChaincodeStubInterface) (map[string]TypeApproval, error) {
+	response := t.read(stub, typeApprovalIndexStr)
+	catalogue := make(map[string]TypeApproval)
+	err := json.Unmarshal(response.Payload, &catalogue)
+	if err != nil {
+		return nil, errors.New("Error parsing type approval catalogue")
+	}
+
+	return catalogue, nil
+}
+
+/*
+ * Saves the type approval catalogue.
+ */
+func (t *CarChaincode) saveTypeApprovals(stub shim.ChaincodeStubInterface, catalogue map[string]TypeApproval) error {
+	catalogueAsBytes, _ := json.Marshal(catalogue)
+	err := stub.PutState(typeApprovalIndexStr, catalogueAsBytes)
+	if err != nil {
+		return errors.New("Error writing type approval catalogue")
+	}
+
+	return nil
+}
+
+/*
+ * Checks if a value is in a list,
+ * an empty list allows any value.
+ */
+func allows(allowed []string, value string) bool {
+	if len(allowed) == 0 {
+		return true
+	}
+
+	for _, a := range allowed {
+		if a == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+/*
+ * Compares the technical data of a car with its type approval.
+ *
+ * Values not reported are not checked. Returns every
+ * deviation, an empty list if the car matches the approved type.
+ */
+func CheckTypeApproval(approval *TypeApproval, car *Car, data *TechnicalData) []string {
+	mismatches := []string{}
+
+	if car.Manufacturer != "" && !MatchesManufacturer(approval.Manufacturer, car.Manufacturer) {
+		mismatches = append(mismatches, fmt.Sprintf("manufacturer '%s' of the VIN, approved '%s'",
+			car.Manufacturer, approval.Manufacturer))
+	}
+
+	min := numericValues(&approval.Min)
+	max := numericValues(&approval.Max)
+	for i, v := range numericValues(data) {
+		if v.value == 0 {
+			continue
+		} else if min[i].value != 0 && v.value < min[i].value {
+			mismatches = append(mismatches, fmt.Sprintf("%s %d below approved %d", v.field, v.value, min[i].value))
+		} else if max[i].value != 0 && v.value > max[i].value {
+			mismatches = append(mismatches, fmt.Sprintf("%s %d above approved %d", v.field, v.value, max[i].value))
+		}
+	}
+
+	if data.FuelType != "" && !allows(approval.FuelTypes, data.FuelType) {
+		mismatches = append(mismatches, fmt.Sprintf("fuelType '%s' not approved", data.FuelType))
+	}
+
+	if data.EmissionsClass != "" && !allows(approval.EmissionsClasses, data.EmissionsClass) {
+		mismatches = append(mismatches, fmt.Sprintf("emissionsClass '%s' not approved", data.EmissionsClass))
+	}
+
+	for _, tyreSize := range data.TyreSizes {
+		if !allows(approval.TyreSizes, tyreSize) {
+			mismatches = append(mismatches, fmt.Sprintf("tyreSize '%s' not approved", tyreSize))
+		}
+	}
+
+	return mismatches
+}
+
+/*
+ * Checks a car against the type approval catalogue.
+ *
+ * Cars without homologation number only pass with an
+ * individual approval of the DOT. Returns an error
+ * listing every deviation.
+ */
+func (t *CarChaincode) checkTypeApproval(stub shim.ChaincodeStubInterface, car *Car, data *TechnicalData, individual bool) error {
+	if data.HomologationNumber == "" && !individual {
+		return fmt.Errorf("Car with VIN '%s' has no homologation number and needs an individual approval", car.Vin)
+	} else if data.HomologationNumber == "" {
+		return nil
+	}
+
+	catalogue, err := t.getTypeApprovals(stub)
+	if err != nil {
+		return err
+	}
+
+	approval, exists := catalogue[data.HomologationNumber]
+	if !exists {
+		return fmt.Errorf("Homologation number '%s' is not in the type approval catalogue", data.HomologationNumber)
+	}
+
+	mismatches := CheckTypeApproval(&approval, car, data)
+	if len(mismatches) > 0 {
+		return fmt.Errorf("Car with VIN '%s' deviates from type approval '%s': %s",
+			car.Vin, approval.HomologationNumber, strings.Join(mismatches, "; "))
+	}
+
+	return nil
+}
+
+/*
+ * Adds or replaces an approved vehicle type.
+ *
+ * Arguments required:
+ * [0] TypeApproval         (json)
+ *
+ * On success,
+ * returns the type approval.
+ */
+func (t *CarChaincode) setTypeApproval(stub shim.ChaincodeStubInterface, username string, args []string) pb.Response {
+	approval := TypeApproval{}
+	err := json.Unmarshal([]byte(args[0]), &approval)
+	if err != nil {
+		return shim.Error("Error parsing type approval. Expecting TypeApproval as json.")
+	}
+
+	if approval.HomologationNumber == "" || approval.Manufacturer == "" || approval.Model == "" {
+		return shim.Error("A type approval needs a homologation number, a manufacturer and a model")
+	}
+
+	// the bounds have to be plausible themselves
+	for _, bound := range []*TechnicalData{&approval.Min, &approval.Max} {
+		err = ValidateTechnicalData(bound)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+
+	min := numericValues(&approval.Min)
+	for i, v := range numericValues(&approval.Max) {
+		if v.value != 0 && v.value < min[i].value {
+			return shim.Error(fmt.Sprintf("Upper bound of '%s' is below its lower bound", v.field))
+		}
+	}
+
+	catalogue, err := t.getTypeApprovals(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	approval.ApprovedBy = username
+	approval.CreatedTs = txTimestamp(stub)
+	catalogue[approval.HomologationNumber] = approval
+
+	err = t.saveTypeApprovals(stub, catalogue)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	approvalAsBytes, _ := json.Marshal(approval)
+	return shim.Success(approvalAsBytes)
+}
+
+/*
+ * Removes an approved vehicle type from the catalogue.
+ *
+ * Registered cars of the type keep their certificate.
+ *
+ * On success,
+ * returns 'nil'.
+ */
+func (t *CarChaincode) removeTypeApproval(stub shim.ChaincodeStubInterface, homologationNumber string) pb.Response {
+	catalogue, err := t.getTypeApprovals(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	if _, exists := catalogue[homologationNumber]; !exists {
+		return shim.Error(fmt.Sprintf("Homologation number '%s' is not in the type approval catalogue", homologationNumber))
+	}
+	delete(catalogue, homologationNumber)
+
+	err = t.saveTypeApprovals(stub, catalogue)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	return shim.Success(nil)
+}
+
+/*
+ * Returns the type approval catalogue.
+ *
+ * On success,
+ * returns a list with type approvals by homologation number.
+ */
+func (t *CarChaincode) readTypeApprovals(stub shim.ChaincodeStubInterface) pb.Response {
+	catalogue, err := t.getTypeApprovals(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	numbers := []string{}
+	for number := range catalogue {
+		numbers = append(numbers, number)
+	}
+	sort.Strings(numbers)
+
+	approvals := []TypeApproval{}
+	for _, number := range numbers {
+		approvals = append(approvals, catalogue[number])
+	}
+
+	approvalsAsBytes, _ := json.Marshal(approvals)
+	return shim.Success(approvalsAsBytes)
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/hyperledger/fabric/common/util"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+const polo string = `{
+	"homologationNumber": "1VA123",
+	"manufacturer": "Volkswagen",
+	"model": "Polo",
+	"variant": "1.0 TSI",
+	"min": { "power": 55, "seats": 4 },
+	"max": { "power": 85, "seats": 5, "maxSpeed": 190 },
+	"fuelTypes": ["petrol"],
+	"emissionsClasses": ["Euro 6", "Euro 6d-TEMP"]
+}`
+
+func TestCheckTypeApproval(t *testing.T) {
+	approval := TypeApproval{}
+	json.Unmarshal([]byte(polo), &approval)
+	car := Car{Vin: "WVWZZZ6RZHY260780", Manufacturer: "Volkswagen"}
+
+	data := TechnicalData{Power: 70, Seats: 5, MaxSpeed: 187, FuelType: "petrol", EmissionsClass: "Euro 6"}
+	if mismatches := CheckTypeApproval(&approval, &car, &data); len(mismatches) != 0 {
+		t.Errorf("Car should match its type approval: %v", mismatches)
+	}
+
+	// every deviation is reported
+	data = TechnicalData{Power: 110, Seats: 2, FuelType: "diesel", EmissionsClass: "Euro 6"}
+	car.Manufacturer = "Audi"
+	mismatches := CheckTypeApproval(&approval, &car, &data)
+	if len(mismatches) != 4 {
+		t.Errorf("Expected 4 deviations, got %v", mismatches)
+	}
+}
+
+func TestRegisterCarChecksTypeApproval(t *testing.T) {
+	username := "amag"
+	vin := "WVWZZZ6RZHY260780"
+
+	// create and name a new chaincode mock
+	carChaincode := &CarChaincode{}
+	stub := shim.NewMockStub("car", carChaincode)
+
+	ccSetup(t, stub)
+
+	// only the DOT maintains the catalogue
+	response := stub.MockInvoke(uuid, util.ToChaincodeArgs("setTypeApproval", username, "garage", polo))
+	if response.Status != shim.ERROR {
+		t.Error("Only the DOT should approve vehicle types")
+	}
+
+	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("setTypeApproval", "dot-user", "dot", `{ "homologationNumber": "1VA999", "manufacturer": "Volkswagen", "model": "Golf", "min": { "power": 100 }, "max": { "power": 50 } }`))
+	if response.Status != shim.ERROR {
+		t.Error("Type approvals with inverted bounds should be refused")
+	}
+
+	stub.MockInvoke(uuid, util.ToChaincodeArgs("setTypeApproval", "dot-user", "dot", polo))
+	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("readTypeApprovals", username, "garage"))
+	var approvals []TypeApproval
+	json.Unmarshal(response.Payload, &approvals)
+	if len(approvals) != 1 || approvals[0].Model != "Polo" || approvals[0].ApprovedBy != "dot-user" {
+		t.Errorf("Wrong type approval catalogue: %v", approvals)
+	}
+
+	// a deviating car is not registered
+	data := `{ "homologationNumber": "1VA123", "power": 110, "fuelType": "diesel" }`
+	stub.MockInvoke(uuid, util.ToChaincodeArgs("create", username, "garage", `{ "vin": "`+vin+`" }`, data))
+
+	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("register", "dot-user", "dot", vin))
+	if response.Status != shim.ERROR {
+		t.Error("A car deviating from its type approval should not be registered")
+	} else if !strings.Contains(response.Message, "power 110 above approved 85") || !strings.Contains(response.Message, "fuelType 'diesel'") {
+		t.Errorf("Deviations not reported: %s", response.Message)
+	}
+
+	// the corrected proposal passes
+	stub.MockInvoke(uuid, util.ToChaincodeArgs("rejectRegistrationProposal", "dot-user", "dot", vin, "deviates from type approval"))
+	stub.MockInvoke(uuid, util.ToChaincodeArgs("resubmitRegistrationProposal", username, "garage", vin, `{ "homologationNumber": "1VA123", "power": 70, "fuelType": "petrol" }`))
+
+	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("register", "dot-user", "dot", vin))
+	car := Car{}
+	err := json.Unmarshal(response.Payload, &car)
+	if err != nil {
+		t.Error(response.Message)
+	} else if car.Certificate.IndividualApproval {
+		t.Error("A type approved car should not be recorded as individually approved")
+	}
+
+	// unknown homologation numbers are refused
+	stub.MockInvoke(uuid, util.ToChaincodeArgs("removeTypeApproval", "dot-user", "dot", "1VA123"))
+	stub.MockInvoke(uuid, util.ToChaincodeArgs("create", username, "garage", `{ "vin": "WVWZZZ6RZHY260781" }`, `{ "homologationNumber": "1VA123" }`))
+	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("register", "dot-user", "dot", "WVWZZZ6RZHY260781"))
+	if response.Status != shim.ERROR {
+		t.Error("A car with an unknown homologation number should not be registered")
+	}
+
+	// cars without homologation number need an individual approval
+	vin = "WVWZZZ6RZHY260782"
+	stub.MockInvoke(uuid, util.ToChaincodeArgs("create", username, "garage", `{ "vin": "`+vin+`" }`, `{ "power": 70 }`))
+	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("register", "dot-user", "dot", vin))
+	if response.Status != shim.ERROR {
+		t.Error("A car without homologation number should not be registered without individual approval")
+	}
+
+	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("register", "dot-user", "dot", vin, "individual"))
+	car = Car{}
+	err = json.Unmarshal(response.Payload, &car)
+	if err != nil {
+		t.Error(response.Message)
+	} else if !car.Certificate.IndividualApproval {
+		t.Error("Individual approval not recorded on the certificate")
+	}
+}
@@ -4,7 +4,9 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"sort"
 	"strconv"
+	"strings"
 
 	"github.com/hyperledger/fabric/core/chaincode/shim"
 	pb "github.com/hyperledger/fabric/protos/peer"
@@ -18,6 +20,11 @@ import (
  * returns the user.
  */
 func (t *CarChaincode) createUser(stub shim.ChaincodeStubInterface, username string) pb.Response {
+	// usernames with a leading underscore are reserved for system accounts
+	if username == "" || strings.HasPrefix(username, "_") {
+		return shim.Error(fmt.Sprintf("Username '%s' is not allowed. Choose another username.", username))
+	}
+
 	// check if user with this username already exists
 	_, err := t.getUser(stub, username)
 	if err == nil {
@@ -27,7 +34,7 @@ func (t *CarChaincode) createUser(stub shim.ChaincodeStubInterface, username str
 	// user does not exist yet,
 	// create user
 	fmt.Printf("User '%s' does not exist yet\nSaving new user with that username\n", username)
-	user := User{Name: username, Cars: []string{}, Balance: 0, Offers: []Offer{}}
+	user := User{Name: username, Cars: []string{}, Balance: NewMoney(0), Offers: []Offer{}}
 
 	userIndex, err := t.getUserIndex(stub)
 	if err != nil {
@@ -51,6 +58,12 @@ func (t *CarChaincode) createUser(stub shim.ChaincodeStubInterface, username str
 		return shim.Error(err.Error())
 	}
 
+	// open an account for the user
+	err = t.updateAccountIndex(stub, username, true)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
 	// user creation successfull,
 	// return the user
 	userAsBytes, _ := json.Marshal(user)
@@ -75,23 +88,46 @@ func (t *CarChaincode) deleteUser(stub shim.ChaincodeStubInterface, username str
 	}
 
 	// getting the user which receives the remaining balance
-	balanceRecipient, err := t.getUser(stub, remainingBalanceRecipient)
+	recipient, err := t.getUser(stub, remainingBalanceRecipient)
 	if err != nil {
 		return shim.Error("User does not exist. Username: '" + username + "'")
 	}
 
 	// check if user doesn't own a car anymore
 	if len(userToDelete.Cars) != 0 {
-		return shim.Error("Deletion of user not possible. User '" + username + "' still owns '" + string(len(userToDelete.Cars)) + "' cars.")
+		return shim.Error("Deletion of user not possible. User '" + username + "' still owns '" + strconv.Itoa(len(userToDelete.Cars)) + "' cars.")
 	}
 
-	// transfer remaining balance to chosen recipient
-	balanceRecipient.Balance += userToDelete.Balance
-	err = t.saveUser(stub, balanceRecipient)
+	// check if user is not involved in a lien anymore
+	activeLiens, err := t.hasActiveLiens(stub, username)
+	if err != nil {
+		return shim.Error(err.Error())
+	} else if activeLiens {
+		return shim.Error("Deletion of user not possible. User '" + username + "' is still involved in an active lien.")
+	}
+
+	// transfer remaining balance to chosen recipient,
+	// a negative balance is taken over by the recipient
+	if userToDelete.Balance.Amount > 0 {
+		_, err = t.transfer(stub, &userToDelete, &recipient, userToDelete.Balance, "closing", username)
+	} else if userToDelete.Balance.Amount < 0 {
+		_, err = t.transfer(stub, &recipient, &userToDelete, userToDelete.Balance.Neg(), "closing", username)
+	}
 	if err != nil {
 		return shim.Error("Transfer of remaining balance failed")
 	}
 
+	err = t.saveUser(stub, recipient)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// close the account of the user
+	err = t.updateAccountIndex(stub, username, false)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
 	// delete user from user index
 	delete(userIndexMap, userToDelete.Name)
 
@@ -178,40 +214,78 @@ func (t *CarChaincode) saveUser(stub shim.ChaincodeStubInterface, user User) err
 }
 
 /*
- * Updates User balance
+ * Returns a user changed by the running transaction.
  *
- * The update amount (can be positive or negative)
- * is added to the user balance.
- *
- * Expects 'args':
- *  username              string
- *  updateAmount          string
- *
- * On success,
- * returns updated user balance
+ * The ledger does not return writes of the own transaction,
+ * therefore every user is read once into 'users', changed
+ * in memory and written back once with 'saveUsers'.
  */
-func (t *CarChaincode) updateBalance(stub shim.ChaincodeStubInterface, username string, updateAmount string) pb.Response {
-	amount, _ := strconv.Atoi(updateAmount)
+func (t *CarChaincode) loadUser(stub shim.ChaincodeStubInterface, users map[string]*User, username string) (*User, error) {
+	if user, loaded := users[username]; loaded {
+		return user, nil
+	}
 
-	// fetch user
 	user, err := t.getUser(stub, username)
 	if err != nil {
-		fmt.Println(err.Error())
+		return nil, err
+	}
+	users[username] = &user
 
-		return shim.Error("Error fetching user, balance not updated")
+	return &user, nil
+}
+
+/*
+ * Writes the users changed by the running transaction back to ledger
+ */
+func (t *CarChaincode) saveUsers(stub shim.ChaincodeStubInterface, users map[string]*User) error {
+	usernames := make([]string, 0, len(users))
+	for username := range users {
+		usernames = append(usernames, username)
 	}
+	sort.Strings(usernames)
 
-	// update user balance
-	user.Balance = user.Balance + amount
+	for _, username := range usernames {
+		err := t.saveUser(stub, *users[username])
+		if err != nil {
+			return err
+		}
+	}
 
-	// save updated user
-	err = t.saveUser(stub, user)
+	return nil
+}
+
+/*
+ * Reads the balance of a user.
+ *
+ * Users can only read their balance, deposits and
+ * withdrawals are done by a bank.
+ *
+ * On success,
+ * returns the user balance.
+ */
+func (t *CarChaincode) readBalance(stub shim.ChaincodeStubInterface, username string) pb.Response {
+	user, err := t.getUser(stub, username)
 	if err != nil {
-		return shim.Error("Error writing user, balance not updated")
+		return shim.Error(err.Error())
 	}
 
-	fmt.Printf("Balance of user '" + user.Name + "' successfully updated\n")
-
-	balanceAsBytes := []byte(strconv.Itoa(user.Balance))
+	balanceAsBytes, _ := json.Marshal(user.Balance)
 	return shim.Success(balanceAsBytes)
 }
+
+/*
+ * Appends a notification to a user in 'users'.
+ *
+ * Notifications to users which no longer exist are dropped.
+ */
+func (t *CarChaincode) notify(stub shim.ChaincodeStubInterface, users map[string]*User, username string, notification Notification) {
+	user, err := t.loadUser(stub, users, username)
+	if err != nil {
+		fmt.Printf("Dropped notification to unknown user '%s'\n", username)
+		return
+	}
+
+	notification.TxId = stub.GetTxID()
+	notification.CreatedTs = txTimestamp(stub)
+	user.Notifications = append(user.Notifications, notification)
+}
@@ -3,7 +3,6 @@ package main
 import (
     "encoding/json"
     "testing"
-    "strconv"
     "fmt"
     "github.com/hyperledger/fabric/common/util"
     "github.com/hyperledger/fabric/core/chaincode/shim"
@@ -29,7 +28,7 @@ func TestUser(t *testing.T) {
         t.Error("Error creating test user")
     }
 
-    if userObject.Balance != 0 {
+    if userObject.Balance != NewMoney(0) {
         t.Error("New user should start with balance 0")
     }
 
@@ -47,18 +46,51 @@ func TestUser(t *testing.T) {
         t.Error("User creation error")
     }
 
-    // update balance of user
-    response = stub.MockInvoke(uuid, util.ToChaincodeArgs("updateBalance", user, "user", "5"))
-    updatedBalance, _ := strconv.Atoi(string(response.Payload))
+    // users cannot mint money themselves
+    response = stub.MockInvoke(uuid, util.ToChaincodeArgs("deposit", user, "user", user, "5", "self"))
+    if response.Status != shim.ERROR {
+        t.Error("Users should not be allowed to deposit money")
+    }
 
-    if updatedBalance != 5 {
-        t.Error("Wrong balance")
+    // deposit money as bank
+    response = stub.MockInvoke(uuid, util.ToChaincodeArgs("deposit", "ubs", "bank", user, "15", "ubs-0001"))
+    receipt := BankReceipt {}
+    err = json.Unmarshal(response.Payload, &receipt)
+    if err != nil {
+        t.Error(response.Message)
+    } else if receipt.Reference != "ubs-0001" || receipt.Amount != NewMoney(1500) || receipt.Type != "deposit" {
+        t.Error("Wrong deposit receipt")
+    }
+
+    // withdrawals cannot overdraw the account
+    response = stub.MockInvoke(uuid, util.ToChaincodeArgs("withdraw", "ubs", "bank", user, "20", "ubs-0002"))
+    if response.Status != shim.ERROR {
+        t.Error("Withdrawal should not overdraw the account")
+    }
+
+    response = stub.MockInvoke(uuid, util.ToChaincodeArgs("withdraw", "ubs", "bank", user, "10.00 CHF", "ubs-0003"))
+    if response.Status == shim.ERROR {
+        t.Error(response.Message)
+    }
+
+    // amounts have to be well formatted
+    response = stub.MockInvoke(uuid, util.ToChaincodeArgs("deposit", "ubs", "bank", user, "5.001", "ubs-0004"))
+    if response.Status != shim.ERROR {
+        t.Error("Amounts with more than two decimals should be rejected")
+    }
+
+    // and in the currency of the account
+    response = stub.MockInvoke(uuid, util.ToChaincodeArgs("deposit", "ubs", "bank", user, "5 EUR", "ubs-0005"))
+    if response.Status != shim.ERROR {
+        t.Error("Cross-currency deposits should be rejected")
     }
 
-    response = stub.MockInvoke(uuid, util.ToChaincodeArgs("updateBalance", user, "user", "-10"))
-    updatedBalance, _ = strconv.Atoi(string(response.Payload))
+    // the user can read the balance
+    response = stub.MockInvoke(uuid, util.ToChaincodeArgs("readBalance", user, "user"))
+    balance := Money {}
+    json.Unmarshal(response.Payload, &balance)
 
-    if updatedBalance != -5 {
+    if balance != NewMoney(500) {
         t.Error("Wrong balance")
     }
 
@@ -86,7 +118,7 @@ func TestUser(t *testing.T) {
         return
     }
 
-    if userObject.Balance != -5 {
+    if userObject.Balance != NewMoney(500) {
         fmt.Println(userObject.Balance)
         t.Error("User balance not transferred successfully after deleting user")
     }
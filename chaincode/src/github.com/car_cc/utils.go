@@ -2,10 +2,28 @@ package main
 
 import (
     "encoding/json"
+    "fmt"
+    "time"
 
     "github.com/hyperledger/fabric/core/chaincode/shim"
 )
 
+/*
+ * Returns the time of the transaction proposal in unix seconds.
+ *
+ * All endorsing peers agree on this time, unlike on their own
+ * clocks, so validity decisions have to be based on it.
+ * Outside of a transaction, e.g. in tests, the local time is used.
+ */
+func txTimestamp(stub shim.ChaincodeStubInterface) int64 {
+    ts, err := stub.GetTxTimestamp()
+    if err != nil || ts == nil {
+        return time.Now().Unix()
+    }
+
+    return ts.GetSeconds()
+}
+
 /*
  * Clears an index of type 'map[string]string' on the ledger
  */
@@ -20,6 +38,24 @@ func clearStringIndex(indexStr string, stub shim.ChaincodeStubInterface) error {
     return stub.PutState(indexStr, jsonAsBytes)
 }
 
+/*
+ * Clears the authority index on the ledger,
+ * keeping the given DOT users of the federal office
+ */
+func clearAuthorityIndex(indexStr string, federalUsers []string, stub shim.ChaincodeStubInterface) error {
+    index := make(map[string]string)
+    for _, username := range federalUsers {
+        index[username] = federalOffice
+    }
+
+    jsonAsBytes, err := json.Marshal(index)
+    if err != nil {
+        return err
+    }
+
+    return stub.PutState(indexStr, jsonAsBytes)
+}
+
 /*
  * Clears an index of type 'map[string]Insurer' on the ledger
  */
@@ -47,3 +83,164 @@ func clearRegistrationProposalIndex(indexStr string, stub shim.ChaincodeStubInte
 
     return stub.PutState(indexStr, jsonAsBytes)
 }
+
+/*
+ * Clears an index of type 'map[string]Lien' on the ledger
+ */
+func clearLienIndex(indexStr string, stub shim.ChaincodeStubInterface) error {
+    index := make(map[string]Lien)
+
+    jsonAsBytes, err := json.Marshal(index)
+    if err != nil {
+        return err
+    }
+
+    return stub.PutState(indexStr, jsonAsBytes)
+}
+
+/*
+ * Returns the time of the transaction proposal in unix nanoseconds,
+ * used to keep the entries of append-only logs in order.
+ */
+func txTimestampNanos(stub shim.ChaincodeStubInterface) int64 {
+    ts, err := stub.GetTxTimestamp()
+    if err != nil || ts == nil {
+        return time.Now().UnixNano()
+    }
+
+    return ts.GetSeconds()*int64(time.Second) + int64(ts.GetNanos())
+}
+
+/*
+ * Returns the key of entry number 'sequence' of the running
+ * transaction in an append-only log on the ledger.
+ *
+ * Every entry is stored under its own composite key of timestamp,
+ * transaction and sequence number, so appending does not rewrite
+ * the log and a range query returns the entries oldest first.
+ */
+func logEntryKey(logStr string, sequence int, stub shim.ChaincodeStubInterface) (string, error) {
+    attributes := []string{fmt.Sprintf("%019d", txTimestampNanos(stub)), stub.GetTxID(), fmt.Sprintf("%06d", sequence)}
+    return stub.CreateCompositeKey(logStr, attributes)
+}
+
+/*
+ * Returns the values of all entries of a log, oldest entries first
+ */
+func readLog(logStr string, stub shim.ChaincodeStubInterface) ([][]byte, error) {
+    iterator, err := stub.GetStateByPartialCompositeKey(logStr, []string{})
+    if err != nil {
+        return nil, err
+    }
+    defer iterator.Close()
+
+    values := [][]byte{}
+    for iterator.HasNext() {
+        kv, err := iterator.Next()
+        if err != nil {
+            return nil, err
+        }
+        values = append(values, kv.Value)
+    }
+
+    return values, nil
+}
+
+/*
+ * Clears an append-only log on the ledger
+ */
+func clearLog(logStr string, stub shim.ChaincodeStubInterface) error {
+    iterator, err := stub.GetStateByPartialCompositeKey(logStr, []string{})
+    if err != nil {
+        return err
+    }
+    defer iterator.Close()
+
+    keys := []string{}
+    for iterator.HasNext() {
+        kv, err := iterator.Next()
+        if err != nil {
+            return err
+        }
+        keys = append(keys, kv.Key)
+    }
+
+    for _, key := range keys {
+        err = stub.DelState(key)
+        if err != nil {
+            return err
+        }
+    }
+
+    return nil
+}
+
+/*
+ * Clears an index of type 'map[string]NumberplateReservation' on the ledger
+ */
+func clearReservationIndex(indexStr string, stub shim.ChaincodeStubInterface) error {
+    index := make(map[string]NumberplateReservation)
+
+    jsonAsBytes, err := json.Marshal(index)
+    if err != nil {
+        return err
+    }
+
+    return stub.PutState(indexStr, jsonAsBytes)
+}
+
+/*
+ * Clears an index of type 'map[string]Numberplate' on the ledger
+ */
+func clearNumberplateIndex(indexStr string, stub shim.ChaincodeStubInterface) error {
+    index := make(map[string]Numberplate)
+
+    jsonAsBytes, err := json.Marshal(index)
+    if err != nil {
+        return err
+    }
+
+    return stub.PutState(indexStr, jsonAsBytes)
+}
+
+/*
+ * Clears an index of type 'map[string]TheftReport' on the ledger
+ */
+func clearTheftIndex(indexStr string, stub shim.ChaincodeStubInterface) error {
+    index := make(map[string]TheftReport)
+
+    jsonAsBytes, err := json.Marshal(index)
+    if err != nil {
+        return err
+    }
+
+    return stub.PutState(indexStr, jsonAsBytes)
+}
+
+/*
+ * Clears an index of type 'map[string]TypeApproval' on the ledger
+ */
+func clearTypeApprovalIndex(indexStr string, stub shim.ChaincodeStubInterface) error {
+    index := make(map[string]TypeApproval)
+
+    jsonAsBytes, err := json.Marshal(index)
+    if err != nil {
+        return err
+    }
+
+    return stub.PutState(indexStr, jsonAsBytes)
+}
+
+/*
+ * Clears an index of type 'map[string]Claim' on the ledger
+ */
+func clearClaimIndex(indexStr string, stub shim.ChaincodeStubInterface) error {
+    index := make(map[string]Claim)
+
+    jsonAsBytes, err := json.Marshal(index)
+    if err != nil {
+        return err
+    }
+
+    return stub.PutState(indexStr, jsonAsBytes)
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// characters allowed in a VIN, 'I', 'O' and 'Q' are
+// left out to avoid confusion with '1' and '0'
+const vinCharacters string = "0123456789ABCDEFGHJKLMNPRSTUVWXYZ"
+
+// model year codes at VIN position 10, repeating every 30 years from 1980
+const modelYearCodes string = "ABCDEFGHJKLMNPRSTVWXY123456789"
+
+// check digit weights per VIN position
+var vinWeights = []int{8, 7, 6, 5, 4, 3, 2, 10, 0, 9, 8, 7, 6, 5, 4, 3, 2}
+
+// check digit transliteration of letters
+var vinLetterValues = map[rune]int{
+	'A': 1, 'B': 2, 'C': 3, 'D': 4, 'E': 5, 'F': 6, 'G': 7, 'H': 8,
+	'J': 1, 'K': 2, 'L': 3, 'M': 4, 'N': 5, 'P': 7, 'R': 9,
+	'S': 2, 'T': 3, 'U': 4, 'V': 5, 'W': 6, 'X': 7, 'Y': 8, 'Z': 9,
+}
+
+// World Manufacturer Identifiers, 3 characters
+// or 2 characters for manufacturers with several plants
+var manufacturers = map[string]string{
+	"WVW": "Volkswagen",
+	"WVG": "Volkswagen",
+	"WV1": "Volkswagen",
+	"WV2": "Volkswagen",
+	"WAU": "Audi",
+	"WUA": "Audi",
+	"WBA": "BMW",
+	"WBS": "BMW",
+	"WDB": "Mercedes-Benz",
+	"WDD": "Mercedes-Benz",
+	"WME": "Smart",
+	"WP0": "Porsche",
+	"WP1": "Porsche",
+	"W0L": "Opel",
+	"WF0": "Ford",
+	"VF1": "Renault",
+	"VF3": "Peugeot",
+	"VF7": "Citroen",
+	"VSS": "Seat",
+	"TMB": "Skoda",
+	"ZFA": "Fiat",
+	"ZAR": "Alfa Romeo",
+	"ZFF": "Ferrari",
+	"YV1": "Volvo",
+	"YS3": "Saab",
+	"SAL": "Land Rover",
+	"SAJ": "Jaguar",
+	"SCC": "Lotus",
+	"JHM": "Honda",
+	"JMZ": "Mazda",
+	"JN1": "Nissan",
+	"JF1": "Subaru",
+	"JS":  "Suzuki",
+	"JT":  "Toyota",
+	"KMH": "Hyundai",
+	"KNA": "Kia",
+	"1FA": "Ford",
+	"1FT": "Ford",
+	"1G1": "Chevrolet",
+	"1HG": "Honda",
+	"1M8": "Motor Coach Industries",
+	"5YJ": "Tesla",
+	"LRW": "Tesla",
+}
+
+// position of the car VIN in the args of the invoked functions,
+// after the leading username and role
+var vinArgs = map[string]int{
+	"getHistory":                   0,
+	"readCar":                      0,
+	"revocationProposal":           0,
+	"insureProposal":               0,
+	"createSellingOffer":           1,
+	"sell":                         0,
+	"setKeeper":                    0,
+	"withdrawRegistrationProposal": 0,
+	"resubmitRegistrationProposal": 0,
+	"revoke":                       0,
+	"delete":                       0,
+	"reregister":                   0,
+	"deregister":                   0,
+	"scrap":                        0,
+	"export":                       0,
+	"readRegistrationProposal":     0,
+	"register":                     0,
+	"rejectRegistrationProposal":   0,
+	"confirm":                      0,
+	"confirmInterchangeable":       0,
+	"recordInspection":             0,
+	"reportStolen":                 0,
+	"reportRecovered":              0,
+	"insuranceAccept":              1,
+	"readPolicies":                 0,
+	"readCurrentPolicy":            0,
+	"fileClaim":                    0,
+	"readClaims":                   0,
+	"insuranceReject":              1,
+	"quoteProposal":                1,
+	"bindQuote":                    0,
+	"registerLien":                 0,
+	"releaseLien":                  0,
+	"acceptLien":                   0,
+	"declineLien":                  0,
+}
+
+/*
+ * Normalises the VIN argument of an invoked function,
+ * so cars are found however the VIN was typed in.
+ */
+func normalizeVinArg(function string, args []string) {
+	i, ok := vinArgs[function]
+	if ok && i < len(args) {
+		args[i] = NormalizeVin(args[i])
+	}
+}
+
+/*
+ * Normalises a VIN as printed on papers,
+ * e.g. 'wvw zzz 6rz hy26 0780' to 'WVWZZZ6RZHY260780'
+ */
+func NormalizeVin(vin string) string {
+	vin = strings.ToUpper(vin)
+	vin = strings.Replace(vin, " ", "", -1)
+	vin = strings.Replace(vin, "-", "", -1)
+
+	return vin
+}
+
+/*
+ * Checks if the check digit at position 9 is mandatory.
+ *
+ * North America and China use the check digit,
+ * other markets often fill position 9 with 'Z'.
+ */
+func requiresCheckDigit(vin string) bool {
+	return strings.ContainsRune("12345L", rune(vin[0]))
+}
+
+/*
+ * Calculates the check digit of a VIN.
+ */
+func VinCheckDigit(vin string) byte {
+	sum := 0
+	for i, c := range vin {
+		value, isLetter := vinLetterValues[c]
+		if !isLetter {
+			value = int(c - '0')
+		}
+		sum += value * vinWeights[i]
+	}
+
+	if sum%11 == 10 {
+		return 'X'
+	}
+	return byte('0' + sum%11)
+}
+
+/*
+ * Validates a normalised VIN according to ISO 3779.
+ *
+ * A VIN has 17 characters without 'I', 'O' and 'Q'.
+ * For markets using the check digit, position 9
+ * has to match the calculated check digit.
+ */
+func ValidateVin(vin string) error {
+	if len(vin) != 17 {
+		return fmt.Errorf("VIN '%s' has %d characters, expected 17", vin, len(vin))
+	}
+
+	for _, c := range vin {
+		if !strings.ContainsRune(vinCharacters, c) {
+			return fmt.Errorf("VIN '%s' contains invalid character '%c'", vin, c)
+		}
+	}
+
+	if requiresCheckDigit(vin) && VinCheckDigit(vin) != vin[8] {
+		return fmt.Errorf("VIN '%s' has an invalid check digit", vin)
+	}
+
+	return nil
+}
+
+/*
+ * Decodes the manufacturer from the World Manufacturer Identifier.
+ *
+ * Returns an empty string for unknown manufacturers.
+ */
+func DecodeManufacturer(vin string) string {
+	if manufacturer, exists := manufacturers[vin[:3]]; exists {
+		return manufacturer
+	}
+
+	return manufacturers[vin[:2]]
+}
+
+/*
+ * Decodes the model year from position 10.
+ *
+ * Year codes repeat every 30 years. North American VINs tell
+ * the cycle at position 7, a digit for 1980-2009 and a letter
+ * for 2010-2039. Otherwise the most recent year not later
+ * than next year's models is taken.
+ * Returns 0 if position 10 holds no year code.
+ */
+func DecodeModelYear(vin string) int {
+	index := strings.IndexByte(modelYearCodes, vin[9])
+	if index < 0 {
+		return 0
+	}
+
+	year := 1980 + index
+	if strings.ContainsRune("12345", rune(vin[0])) {
+		if vin[6] < '0' || vin[6] > '9' {
+			year += 30
+		}
+		return year
+	}
+
+	for year+30 <= time.Now().Year()+1 {
+		year += 30
+	}
+
+	return year
+}
+
+/*
+ * Checks if the brand on the certificate
+ * names the decoded manufacturer.
+ */
+func MatchesManufacturer(brand string, manufacturer string) bool {
+	normalize := func(name string) string {
+		name = strings.ToLower(name)
+		name = strings.Replace(name, " ", "", -1)
+		return strings.Replace(name, "-", "", -1)
+	}
+
+	return normalize(brand) == normalize(manufacturer)
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/hyperledger/fabric/common/util"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+func TestValidateVin(t *testing.T) {
+	if NormalizeVin("wvw zzz 6rz hy26-0780") != "WVWZZZ6RZHY260780" {
+		t.Error("Error normalising VIN")
+	}
+
+	valid := []string{"WVWZZZ6RZHY260780", "1M8GDM9AXKP042788", "5YJSA1E18HF000001"}
+	for _, vin := range valid {
+		err := ValidateVin(vin)
+		if err != nil {
+			t.Errorf("'%s' should be a valid VIN: %s", vin, err.Error())
+		}
+	}
+
+	invalid := []string{"", "WVWZZZ6RZHY26078", "WVWZZZ6RZHY2607800", "WVWZZZ6RZHO260780", "1M8GDM9A1KP042788"}
+	for _, vin := range invalid {
+		err := ValidateVin(vin)
+		if err == nil {
+			t.Errorf("'%s' should not be a valid VIN", vin)
+		}
+	}
+
+	if DecodeManufacturer("WVWZZZ6RZHY260780") != "Volkswagen" || DecodeManufacturer("JTDKB20U887654321") != "Toyota" {
+		t.Error("Error decoding manufacturer")
+	}
+
+	if DecodeModelYear("WVWZZZ6RZHY260780") != 2017 || DecodeModelYear("1M8GDM9AXKP042788") != 1989 {
+		t.Error("Error decoding model year")
+	}
+}
+
+func TestRegisterCarChecksBrand(t *testing.T) {
+	username := "amag"
+	vin := "WVWZZZ6RZHY260780"
+
+	// create and name a new chaincode mock
+	carChaincode := &CarChaincode{}
+	stub := shim.NewMockStub("car", carChaincode)
+
+	ccSetup(t, stub)
+
+	response := stub.MockInvoke(uuid, util.ToChaincodeArgs("create", username, "garage", `{ "vin": "WVW ZZZ 6RZ HY26 078O" }`))
+	if response.Status != shim.ERROR {
+		t.Error("Car with invalid VIN should not be created")
+	}
+
+	// spaced VINs are normalised and decoded
+	carData := `{ "vin": "wvw zzz 6rz hy26 0780", "certificate": { "brand": "BMW" } }`
+	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("create", username, "garage", carData))
+	car := Car{}
+	err := json.Unmarshal(response.Payload, &car)
+	if err != nil {
+		t.Error(response.Message)
+		return
+	}
+
+	if car.Vin != vin || car.Wmi != "WVW" || car.Manufacturer != "Volkswagen" || car.ModelYear != 2017 {
+		t.Error("VIN not normalised and decoded")
+	}
+
+	// the car is found however its VIN is typed in
+	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("readCar", username, "garage", "wvw-zzz-6rz-hy26-0780"))
+	car = Car{}
+	json.Unmarshal(response.Payload, &car)
+	if car.Vin != vin {
+		t.Error("Car not found by its VIN as printed on papers")
+	}
+
+	// the brand does not match the manufacturer
+	response = stub.MockInvoke(uuid, util.ToChaincodeArgs("register", "dot-user", "dot", vin, "individual"))
+	if response.Status != shim.ERROR {
+		t.Error("Registering a car with a wrong brand should not be possible")
+	}
+}